@@ -0,0 +1,175 @@
+// config.go loads flag defaults from SNYK_TARGET_EXPORT_* environment
+// variables and from a configuration file with named profiles (--config,
+// --profile). Precedence: flag > environment > file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// envPrefix is the prefix of environment variables that override flags.
+const envPrefix = "SNYK_TARGET_EXPORT_"
+
+// flagEnvName returns the environment variable that overrides a flag:
+// envPrefix followed by the flag name in upper snake case
+// (e.g. retryMaxBackoff -> SNYK_TARGET_EXPORT_RETRY_MAX_BACKOFF).
+func flagEnvName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == '.':
+			b.WriteByte('_')
+		case unicode.IsUpper(r):
+			// Start a new word at "aB" and at the last capital of "ABc",
+			// so includeCLI -> INCLUDE_CLI and apiURLFile -> API_URL_FILE.
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// commandLineOnly are the flags that are never read from the environment
+// or a config file: --delete turns a dedup dry run into real deletions, so
+// it must be given explicitly.
+var commandLineOnly = map[string]bool{"delete": true}
+
+// applyEnvOverrides sets every flag that was not given on the command line
+// from its SNYK_TARGET_EXPORT_* environment variable, if present.
+// Flags on the command line always win. Variables for commandLineOnly flags
+// are ignored with a warning.
+func applyEnvOverrides(fset *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fset.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		env := flagEnvName(f.Name)
+		v, ok := os.LookupEnv(env)
+		switch {
+		case !ok:
+		case commandLineOnly[f.Name]:
+			fmt.Fprintf(os.Stderr, "Warning: ignoring %s: --%s must be given on the command line\n", env, f.Name)
+		default:
+			if setErr := fset.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("%s: %w", env, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// configCommands are the subcommands that can have a table in the config file.
+var configCommands = []string{"refresh", "dedup", "doctor"}
+
+// configFlags holds the raw values of the config file flags.
+type configFlags struct {
+	path    *string
+	profile *string
+}
+
+// addConfigFlags registers the config file flags on fs.
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	return &configFlags{
+		path:    fs.String("config", "", "Read flag defaults from this TOML file (default: "+displayConfigPath()+" if it exists)"),
+		profile: fs.String("profile", "", "Use this profile from the config file (default: the file's top-level \"defaultProfile\" setting)"),
+	}
+}
+
+// defaultConfigPath returns the default config file location, or "" if the
+// user config directory is unknown.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "snyk-target-export", "config.toml")
+}
+
+func displayConfigPath() string {
+	if p := defaultConfigPath(); p != "" {
+		return p
+	}
+	return "<user config dir>/snyk-target-export/config.toml"
+}
+
+// apply sets every flag of command that was given neither on the command
+// line nor in the environment from the config file. Call it after
+// applyEnvOverrides, so --config and --profile can come from either.
+func (c *configFlags) apply(fset *flag.FlagSet, command string) error {
+	path := *c.path
+	if path == "" {
+		path = defaultConfigPath()
+		if path == "" {
+			return nil
+		}
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if *c.profile != "" {
+				return fmt.Errorf("--profile %q: no config file at %s (use --config)", *c.profile, path)
+			}
+			return nil
+		}
+	}
+	cfg, err := internal.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	profile := *c.profile
+	if profile == "" {
+		profile = cfg.DefaultProfile()
+	}
+	settings, err := cfg.Settings(profile, command, configCommands)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return applySettings(fset, settings, path)
+}
+
+// applySettings sets the flags of fset named by settings, skipping flags
+// that are already set. Later settings override earlier ones. Settings for
+// flags fset does not have are ignored, unless they come from a subcommand
+// table; settings for commandLineOnly flags are an error.
+func applySettings(fset *flag.FlagSet, settings []internal.Setting, path string) error {
+	set := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		f := fset.Lookup(s.Flag)
+		switch {
+		case f == nil && s.Command:
+			return fmt.Errorf("%s: %s: unknown setting %q for %s", path, s.Source, s.Flag, fset.Name())
+		case f != nil && commandLineOnly[s.Flag]:
+			return fmt.Errorf("%s: %s: %s must be given on the command line", path, s.Source, s.Flag)
+		case f == nil, set[s.Flag], s.Flag == "config" || s.Flag == "profile":
+			continue
+		}
+		values := s.Values
+		if list, ok := f.Value.(*stringList); ok {
+			*list = nil // a more specific table replaces the list
+		} else {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := fset.Set(s.Flag, v); err != nil {
+				return fmt.Errorf("%s: %s %s: %w", path, s.Source, s.Flag, err)
+			}
+		}
+	}
+	return nil
+}
@@ -6,9 +6,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/snyk-playground/snyk-target-export/internal"
@@ -36,22 +37,12 @@ func duplicateGroupKey(p internal.Project, considerOrigin bool) string {
 
 // findDuplicateGroups groups projects by name (and optionally by origin when considerOrigin is true)
 // and returns only groups with 2+ projects (duplicates).
-// Projects within each group are sorted by Created ascending (oldest first).
+// Projects within each group are sorted by Created ascending (oldest first)
+// and carry only the fields dedup needs (ID, Name, Origin, Created).
 func findDuplicateGroups(projects []internal.Project, considerOrigin bool) []duplicateGroup {
-	grouped := make(map[string][]internal.Project)
-	for _, p := range projects {
-		key := duplicateGroupKey(p, considerOrigin)
-		grouped[key] = append(grouped[key], p)
-	}
-	var out []duplicateGroup
-	for key, projs := range grouped {
-		if len(projs) < 2 {
-			continue
-		}
-		sort.Slice(projs, func(i, j int) bool { return projs[i].Created < projs[j].Created })
-		out = append(out, duplicateGroup{key: key, projects: projs})
-	}
-	return out
+	g := newProjectGrouper(considerOrigin)
+	g.add(g.addOrg("", ""), projects)
+	return g.orgGroups()
 }
 
 // projectInOrg attaches org context to a project for group-wide dedup.
@@ -71,18 +62,148 @@ type duplicateGroupGroupWide struct {
 // findDuplicateGroupsGroupWide groups projects from multiple orgs by name (and optionally origin).
 // Returns only groups with 2+ projects. Items within each group are sorted by Created ascending.
 func findDuplicateGroupsGroupWide(items []projectInOrg, considerOrigin bool) []duplicateGroupGroupWide {
-	grouped := make(map[string][]projectInOrg)
+	g := newProjectGrouper(considerOrigin)
+	orgs := make(map[string]int32)
 	for _, item := range items {
-		key := duplicateGroupKey(item.project, considerOrigin)
-		grouped[key] = append(grouped[key], item)
+		idx, ok := orgs[item.orgID]
+		if !ok {
+			idx = g.addOrg(item.orgID, item.orgLabel)
+			orgs[item.orgID] = idx
+		}
+		g.add(idx, []internal.Project{item.project})
 	}
-	var out []duplicateGroupGroupWide
-	for key, list := range grouped {
+	return g.groupWide()
+}
+
+// compactProject is what dedup keeps in memory per project while scanning:
+// just enough to pick the oldest copy and report or delete the others.
+type compactProject struct {
+	id      string
+	origin  string // interned
+	created string
+	org     int32 // index into projectGrouper.orgs
+}
+
+// groupedOrg identifies an org registered with a projectGrouper.
+type groupedOrg struct {
+	id    string
+	label string
+}
+
+// projectGrouper groups projects by duplicateGroupKey incrementally, page
+// by page, storing a compactProject per project instead of the full
+// internal.Project. This keeps group-wide dedup of very large groups within
+// bounded memory. It is safe for concurrent use.
+type projectGrouper struct {
+	considerOrigin bool
+
+	mu      sync.Mutex
+	orgs    []groupedOrg
+	origins map[string]string
+	byKey   map[string][]compactProject
+}
+
+func newProjectGrouper(considerOrigin bool) *projectGrouper {
+	return &projectGrouper{
+		considerOrigin: considerOrigin,
+		origins:        make(map[string]string),
+		byKey:          make(map[string][]compactProject),
+	}
+}
+
+// addOrg registers an org and returns its index for add.
+func (g *projectGrouper) addOrg(id, label string) int32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.orgs = append(g.orgs, groupedOrg{id: id, label: label})
+	return int32(len(g.orgs) - 1)
+}
+
+// add records a page of projects belonging to the org with index org.
+func (g *projectGrouper) add(org int32, projects []internal.Project) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, p := range projects {
+		origin, ok := g.origins[p.Origin]
+		if !ok {
+			origin = p.Origin
+			g.origins[origin] = origin
+		}
+		key := duplicateGroupKey(p, g.considerOrigin)
+		g.byKey[key] = append(g.byKey[key], compactProject{id: p.ID, origin: origin, created: p.Created, org: org})
+	}
+}
+
+// dropOrg removes every project recorded for the org with index org, e.g.
+// when fetching its projects failed part way through.
+func (g *projectGrouper) dropOrg(org int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, list := range g.byKey {
+		kept := list[:0]
+		for _, c := range list {
+			if c.org != org {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 0 {
+			delete(g.byKey, key)
+		} else {
+			g.byKey[key] = kept
+		}
+	}
+}
+
+// duplicateKeys returns the keys with 2+ projects, sorted, with each key's
+// projects sorted oldest first. Caller holds mu.
+func (g *projectGrouper) duplicateKeys() []string {
+	var keys []string
+	for key, list := range g.byKey {
 		if len(list) < 2 {
 			continue
 		}
-		sort.Slice(list, func(i, j int) bool { return list[i].project.Created < list[j].project.Created })
-		out = append(out, duplicateGroupGroupWide{key: key, items: list})
+		sort.SliceStable(list, func(i, j int) bool { return list[i].created < list[j].created })
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// project expands a compactProject stored under key.
+func (g *projectGrouper) project(key string, c compactProject) internal.Project {
+	name, _, _ := strings.Cut(key, duplicateKeySeparator)
+	return internal.Project{ID: c.id, Name: name, Origin: c.origin, Created: c.created}
+}
+
+// orgGroups returns the duplicate groups, ignoring which org each project is in.
+func (g *projectGrouper) orgGroups() []duplicateGroup {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []duplicateGroup
+	for _, key := range g.duplicateKeys() {
+		list := g.byKey[key]
+		projs := make([]internal.Project, len(list))
+		for i, c := range list {
+			projs[i] = g.project(key, c)
+		}
+		out = append(out, duplicateGroup{key: key, projects: projs})
+	}
+	return out
+}
+
+// groupWide returns the duplicate groups with the org of each project.
+func (g *projectGrouper) groupWide() []duplicateGroupGroupWide {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []duplicateGroupGroupWide
+	for _, key := range g.duplicateKeys() {
+		list := g.byKey[key]
+		items := make([]projectInOrg, len(list))
+		for i, c := range list {
+			org := g.orgs[c.org]
+			items[i] = projectInOrg{orgID: org.id, orgLabel: org.label, project: g.project(key, c)}
+		}
+		out = append(out, duplicateGroupGroupWide{key: key, items: items})
 	}
 	return out
 }
@@ -160,13 +281,13 @@ func cleanupEmptyTargets(ctx context.Context, api SnykAPI, doDelete bool, orgsAf
 	for orgID := range orgsAffected {
 		targets, err := api.FetchTargets(ctx, orgID)
 		if err != nil {
-			log.Printf("WARNING: Could not fetch targets for org %s: %v", orgID, err)
+			slog.Warn("could not fetch targets", "org_id", orgID, "error", err)
 			continue
 		}
 		activeTargets := make(map[string]bool)
 		projects, err := api.FetchProjects(ctx, orgID)
 		if err != nil {
-			log.Printf("WARNING: Could not re-fetch projects for org %s: %v", orgID, err)
+			slog.Warn("could not re-fetch projects", "org_id", orgID, "error", err)
 			continue
 		}
 		for _, p := range projects {
@@ -190,7 +311,8 @@ func cleanupEmptyTargets(ctx context.Context, api SnykAPI, doDelete bool, orgsAf
 					err := api.DeleteTarget(ctx, orgID, t.ID)
 					if err != nil {
 						targetsFailed++
-						log.Printf("  target %s (%s, %s): failed to delete: %v", t.ID, name, t.IntegrationType, err)
+						fmt.Printf("  target %s (%s, %s): FAILED: %v\n", t.ID, name, t.IntegrationType, err)
+						slog.Error("failed to delete target", "org_id", orgID, "target_id", t.ID, "error", err)
 					} else {
 						targetsDeleted++
 						fmt.Printf("  target %s (%s, %s): deleted\n", t.ID, name, t.IntegrationType)
@@ -206,55 +328,137 @@ func cleanupEmptyTargets(ctx context.Context, api SnykAPI, doDelete bool, orgsAf
 }
 
 // runDedup implements the dedup subcommand.
-func runDedup(args []string) {
+func runDedup(args []string) int {
 	fs := flag.NewFlagSet("dedup", flag.ExitOnError)
 	groupID := fs.String("groupId", "", "Snyk group ID (all orgs in this group will be scanned)")
 	orgID := fs.String("orgId", "", "Single Snyk org ID to scan")
+	orgQuery := addOrgFilterFlags(fs, groupID)
+	shardOf := addShardFlag(fs)
 	concurrency := fs.Int("concurrency", 5, "Number of orgs to process in parallel")
 	doDelete := fs.Bool("delete", false, "Actually delete duplicates (default is dry-run)")
-	debug := fs.Bool("debug", false, "Print detailed project info for debugging")
+	debug := fs.Bool("debug", false, "Log every scanned project (same as --logLevel=debug)")
 	considerOrigin := fs.Bool("considerOrigin", false, "Only treat as duplicates when name and integration origin match (e.g. keep same repo from github and gitlab)")
 	withinOrg := fs.Bool("withinOrg", true, "Only treat as duplicates within the same org (when false, same name across orgs in the group is deduped)")
+	filterFlags := addProjectFilterFlags(fs)
+	clientOpts := addClientFlags(fs)
+	logOpts := addLogFlags(fs)
+	progressOpts := addProgressFlags(fs)
+	telemetryOpts := addTelemetryFlags(fs)
+	summaryOpts := addSummaryFlags(fs)
+	configOpts := addConfigFlags(fs)
 	if err := fs.Parse(args); err != nil {
-		os.Exit(1)
+		return exitFatal
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if err := configOpts.apply(fs, "dedup"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if *debug {
+		*logOpts.level = "debug"
+	}
+	closeLog, err := logOpts.setup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
 	}
+	defer closeLog()
+	sum := summaryOpts.begin("dedup")
+	sum.GroupID = *groupID
+	sum.Dedup = &dedupSummary{DryRun: !*doDelete}
 
-	if err := validateGroupOrOrg(*groupID, *orgID); err != nil {
+	if err := validateGroupOrOrg(orgQuery(), *orgID); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		fs.Usage()
-		os.Exit(1)
+		return sum.fail(err)
 	}
 
-	token, err := internal.GetSnykToken()
+	sh, err := shardOf()
+	if err == nil && sh.count > 1 && !*withinOrg {
+		// Group-wide duplicates span orgs that may be in different shards.
+		err = fmt.Errorf("--shard requires --withinOrg")
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return sum.fail(err)
+	}
+	sum.Shard = sh.String()
+
+	filters, err := filterFlags.build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fs.Usage()
+		return sum.fail(err)
+	}
+	query := filterFlags.query()
+	where, err := filterFlags.whereExpr()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return sum.fail(err)
+	}
+	if where != nil {
+		// dedup works on projects only; there is no import target to evaluate against.
+		if where.UsesTarget() {
+			err := fmt.Errorf("--where for dedup cannot use target fields (orgId, integrationId, target.*)")
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return sum.fail(err)
+		}
+		filters = append(filters, func(p internal.Project) bool { return where.Match(p, nil) })
 	}
 
 	ctx := context.Background()
-	api := newSnykAPI(internal.NewHTTPClient(), token)
+	client, err := clientOpts.newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return sum.fail(err)
+	}
+	api := newSnykAPI(client)
+	ctx, tel := telemetryOpts.start(ctx, "dedup", client)
 
-	orgs, err := resolveOrgs(ctx, api, *groupID, *orgID)
+	orgs, err := resolveOrgs(ctx, api, orgQuery(), *orgID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error fetching orgs: %v\n", err)
-		os.Exit(1)
+		return tel.fail(sum, err)
+	}
+	if sh.count > 1 {
+		all := len(orgs)
+		orgs = sh.filter(orgs)
+		slog.Info("shard selected", "shard", sh.String(), "orgs", len(orgs), "of", all)
 	}
 
 	if !*doDelete {
-		log.Println("DRY RUN -- no projects will be deleted. Use --delete to remove duplicates.")
+		slog.Info("dry run: no projects will be deleted; use --delete to remove duplicates")
 	}
 
-	log.Printf("Scanning %d organization(s) for duplicates with concurrency %d...", len(orgs), *concurrency)
+	slog.Info("scanning orgs for duplicates", "orgs", len(orgs), "concurrency", *concurrency)
+	sum.Orgs.Total = len(orgs)
+	prog, err := progressOpts.start(len(orgs), client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return tel.fail(sum, err)
+	}
+	defer prog.stop()
+	scanAPI := prog.wrap(api)
 
 	type dedupResult struct {
 		orgID        string
 		orgLabel     string
-		projects     []internal.Project
 		groups       []duplicateGroup
-		projectCount int
+		projectCount int // projects left after the filters
 		err          error
 	}
 
+	// Projects are grouped page by page as they are fetched, keeping only a
+	// compact record of each: per org for --withinOrg, otherwise in one
+	// grouper shared by all orgs.
+	var groupWide *projectGrouper
+	if !*withinOrg {
+		groupWide = newProjectGrouper(*considerOrigin)
+	}
+
 	results := make(chan dedupResult, len(orgs))
 	sem := make(chan struct{}, *concurrency)
 	var wg sync.WaitGroup
@@ -267,25 +471,42 @@ func runDedup(args []string) {
 			defer func() { <-sem }() // release
 
 			res := dedupResult{orgID: o.ID, orgLabel: orgLabel(o)}
+			prog.orgStarted(o.ID)
+			orgCtx, endOrg := tel.startOrg(ctx, o)
 
-			projects, err := api.FetchProjects(ctx, o.ID)
+			grouper := groupWide
+			if grouper == nil {
+				grouper = newProjectGrouper(*considerOrigin)
+			}
+			orgIdx := grouper.addOrg(o.ID, res.orgLabel)
+			fetched := 0
+			err := scanAPI.StreamProjects(orgCtx, o.ID, query, func(page []internal.Project) error {
+				fetched += len(page)
+				page = filterProjects(page, filters)
+				res.projectCount += len(page)
+				if slog.Default().Enabled(ctx, slog.LevelDebug) {
+					for _, p := range page {
+						slog.Debug("project", "org_id", o.ID, "project_id", p.ID, "name", p.Name, "origin", p.Origin, "created", p.Created)
+					}
+				}
+				grouper.add(orgIdx, page)
+				return nil
+			})
 			if err != nil {
+				grouper.dropOrg(orgIdx)
 				res.err = fmt.Errorf("fetch projects: %w", err)
+				endOrg(res.err)
+				prog.orgFinished(o.ID, res.err)
 				results <- res
 				return
 			}
 
-			res.projects = projects
-			res.projectCount = len(projects)
-			log.Printf("Org %s: fetched %d project(s)", res.orgLabel, len(projects))
-
-			if *debug {
-				for _, p := range projects {
-					log.Printf("  [DEBUG] id=%s name=%q origin=%q created=%q", p.ID, p.Name, p.Origin, p.Created)
-				}
+			slog.Info("org scanned", orgAttrs(res.orgID, res.orgLabel), "projects", fetched, "matched", res.projectCount)
+			if groupWide == nil {
+				res.groups = grouper.orgGroups()
 			}
-
-			res.groups = findDuplicateGroups(projects, *considerOrigin)
+			endOrg(nil)
+			prog.orgFinished(o.ID, nil)
 			results <- res
 		}(org)
 	}
@@ -296,28 +517,25 @@ func runDedup(args []string) {
 	}()
 
 	var orgsWithDuplicates []dedupCollectedResult
-	var allProjectsInOrg []projectInOrg
-	failedOrgs := 0
+	failures := orgFailures{}
 
 	for res := range results {
 		if res.err != nil {
-			failedOrgs++
-			log.Printf("WARNING: Failed to process org %s: %v", res.orgLabel, res.err)
+			failures.add(res.orgLabel, res.err)
+			sum.orgFailed(res.orgID, res.orgLabel, res.err)
+			slog.Warn("failed to process org", orgAttrs(res.orgID, res.orgLabel), "error_class", internal.ClassifyError(res.err), "error", res.err)
 			continue
 		}
-		if *withinOrg {
-			if len(res.groups) > 0 {
-				orgsWithDuplicates = append(orgsWithDuplicates, dedupCollectedResult{
-					orgID: res.orgID, orgLabel: res.orgLabel, groups: res.groups,
-				})
-			}
-		} else {
-			for _, p := range res.projects {
-				allProjectsInOrg = append(allProjectsInOrg, projectInOrg{orgID: res.orgID, orgLabel: res.orgLabel, project: p})
-			}
+		sum.Orgs.Processed++
+		if len(res.groups) > 0 {
+			orgsWithDuplicates = append(orgsWithDuplicates, dedupCollectedResult{
+				orgID: res.orgID, orgLabel: res.orgLabel, groups: res.groups,
+			})
 		}
 	}
 
+	prog.stop()
+
 	var orgsAffected map[string]bool
 	var totalDuplicates, totalDeleted, totalFailed int
 
@@ -326,7 +544,7 @@ func runDedup(args []string) {
 		orgsAffected, totalDuplicates, totalDeleted, totalFailed = reportAndDeleteDuplicates(ctx, api, *doDelete, orgsWithDuplicates)
 	} else {
 		// Phase 1 (group-wide): Find duplicate groups across orgs, report and optionally delete
-		groupsWide := findDuplicateGroupsGroupWide(allProjectsInOrg, *considerOrigin)
+		groupsWide := groupWide.groupWide()
 		orgsAffected, totalDuplicates, totalDeleted, totalFailed = reportAndDeleteDuplicatesGroupWide(ctx, api, *doDelete, groupsWide)
 	}
 
@@ -341,6 +559,12 @@ func runDedup(args []string) {
 		targetsDeleted, targetsFailed = cleanupEmptyTargets(ctx, api, *doDelete, orgsAffected)
 	}
 
+	slog.Info("rate limiter", "state", client.Limiter.State())
+	tel.add(metricDuplicates, totalDuplicates)
+	tel.add(metricDuplicatesDeleted, totalDeleted)
+	tel.add(metricEmptyTargets, targetsDeleted)
+	tel.finish(sum.orgsError())
+
 	// Summary
 	fmt.Println()
 	if totalDuplicates == 0 && targetsDeleted == 0 {
@@ -360,8 +584,22 @@ func runDedup(args []string) {
 		}
 		fmt.Printf("\nRun with --delete to remove them.")
 	}
-	if failedOrgs > 0 {
-		fmt.Printf(" (%d org(s) failed to scan)", failedOrgs)
+	if n := failures.count(); n > 0 {
+		fmt.Printf(" (%d org(s) failed to scan)", n)
 	}
 	fmt.Println()
+	if len(failures) > 0 {
+		fmt.Println("\nFailed orgs by error class:")
+		failures.print(os.Stdout)
+	}
+
+	sum.Dedup.DuplicateProjects = totalDuplicates
+	sum.Dedup.ProjectsDeleted, sum.Dedup.ProjectDeleteFailures = totalDeleted, totalFailed
+	if *doDelete {
+		sum.Dedup.EmptyTargets = targetsDeleted + targetsFailed
+		sum.Dedup.TargetsDeleted, sum.Dedup.TargetDeleteFailures = targetsDeleted, targetsFailed
+	} else {
+		sum.Dedup.EmptyTargets = targetsDeleted
+	}
+	return sum.finish(totalDuplicates == 0 && targetsDeleted == 0)
 }
@@ -0,0 +1,287 @@
+// doctor.go implements the doctor subcommand: a read-only preflight of
+// connectivity, region, credentials and permissions.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// doctorAPI is the part of the Snyk API the doctor checks need beyond SnykAPI.
+type doctorAPI interface {
+	SnykAPI
+	FetchSelf(ctx context.Context) (internal.Self, error)
+	FetchGroups(ctx context.Context) ([]internal.Group, error)
+	ProbeListProjects(ctx context.Context, orgID string) error
+	ProbeProjectDelete(ctx context.Context, orgID string) (bool, error)
+}
+
+func (c *snykAPIClient) FetchSelf(ctx context.Context) (internal.Self, error) {
+	return internal.FetchSelf(ctx, c.client)
+}
+
+func (c *snykAPIClient) FetchGroups(ctx context.Context) ([]internal.Group, error) {
+	return internal.FetchGroups(ctx, c.client)
+}
+
+func (c *snykAPIClient) ProbeListProjects(ctx context.Context, orgID string) error {
+	return internal.ProbeListProjects(ctx, c.client, orgID)
+}
+
+func (c *snykAPIClient) ProbeProjectDelete(ctx context.Context, orgID string) (bool, error) {
+	return internal.ProbeProjectDelete(ctx, c.client, orgID)
+}
+
+// Doctor check outcomes.
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// doctorCheck is the outcome of one preflight check.
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+	hint   string // actionable guidance, printed for WARN and FAIL
+}
+
+// printDoctorChecks writes the checks as an aligned report.
+func printDoctorChecks(w io.Writer, checks []doctorCheck) {
+	for _, c := range checks {
+		fmt.Fprintf(w, "[%-4s] %-20s %s\n", c.status, c.name, c.detail)
+		if c.hint != "" && c.status != checkOK {
+			for _, line := range strings.Split(c.hint, "\n") {
+				fmt.Fprintf(w, "       %-20s %s\n", "", line)
+			}
+		}
+	}
+}
+
+// doctorFailed reports whether any check failed.
+func doctorFailed(checks []doctorCheck) bool {
+	for _, c := range checks {
+		if c.status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+// regionHint explains how to point the tool at another region.
+func regionHint(baseURL string) string {
+	current, _ := internal.RegionForBaseURL(baseURL)
+	var lines []string
+	lines = append(lines, "Tokens only work in the region where they were created.")
+	for _, r := range internal.Regions {
+		if r.Name == current.Name {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("If you log in at %s, set SNYK_API=%s", r.AppHost, r.APIURL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeBaseURL names the region of baseURL for the report.
+func describeBaseURL(baseURL string) string {
+	if r, ok := internal.RegionForBaseURL(baseURL); ok {
+		return fmt.Sprintf("%s (%s)", baseURL, r.Name)
+	}
+	return baseURL + " (private or single-tenant deployment)"
+}
+
+// checkBaseURL validates the configured base URL and that it can be reached.
+// Any HTTP response counts as reachable; only transport errors fail.
+func checkBaseURL(ctx context.Context, httpClient *http.Client, baseURL string) []doctorCheck {
+	checks := []doctorCheck{{name: "API base URL", status: checkOK, detail: describeBaseURL(baseURL)}}
+	if problems := internal.CheckBaseURL(baseURL); len(problems) > 0 {
+		checks[0].status = checkFail
+		checks[0].hint = strings.Join(problems, "\n")
+		return checks
+	}
+
+	reach := doctorCheck{name: "Reachability", status: checkOK}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/rest/openapi", nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = httpClient.Do(req); err == nil {
+			resp.Body.Close()
+			reach.detail = fmt.Sprintf("connected (HTTP %d)", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		reach.status = checkFail
+		reach.detail = err.Error()
+		reach.hint = "Check DNS, firewall and proxy settings (--proxy, HTTPS_PROXY, --caBundle for TLS-intercepting proxies)."
+	}
+	return append(checks, reach)
+}
+
+// runDoctorChecks validates the credentials and, for the given group or org,
+// that orgs, integrations and projects can be listed and projects deleted.
+// Nothing is modified.
+func runDoctorChecks(ctx context.Context, api doctorAPI, baseURL, groupID, orgID string) []doctorCheck {
+	var checks []doctorCheck
+
+	self, err := api.FetchSelf(ctx)
+	if err != nil {
+		c := doctorCheck{name: "Credentials", status: checkFail, detail: err.Error()}
+		if internal.ClassifyError(err) == internal.ClassAuth {
+			c.detail = "token rejected (401)"
+			c.hint = regionHint(baseURL)
+		}
+		return append(checks, c)
+	}
+	owner := self.Name
+	if self.Email != "" {
+		owner += " <" + self.Email + ">"
+	}
+	checks = append(checks, doctorCheck{name: "Credentials", status: checkOK, detail: fmt.Sprintf("%s %s (%s)", self.Type, owner, self.ID)})
+
+	groups, err := api.FetchGroups(ctx)
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{name: "Groups", status: checkWarn, detail: err.Error()})
+	case len(groups) == 0:
+		checks = append(checks, doctorCheck{name: "Groups", status: checkWarn, detail: "no groups accessible",
+			hint: "--groupId needs a group-level token or service account; use --orgId per org otherwise."})
+	default:
+		var names []string
+		found := groupID == ""
+		for _, g := range groups {
+			names = append(names, fmt.Sprintf("%s (%s)", g.Name, g.ID))
+			found = found || g.ID == groupID
+		}
+		c := doctorCheck{name: "Groups", status: checkOK, detail: strings.Join(names, ", ")}
+		if !found {
+			c.status = checkFail
+			c.detail = fmt.Sprintf("group %s is not accessible; accessible: %s", groupID, c.detail)
+			c.hint = "Check the group ID and that the token belongs to a group member or group service account."
+		}
+		checks = append(checks, c)
+	}
+
+	if groupID == "" && orgID == "" {
+		return append(checks, doctorCheck{name: "Org permissions", status: checkWarn, detail: "skipped",
+			hint: "Pass --groupId or --orgId to check org, integration, project and delete access."})
+	}
+
+	orgs, err := resolveOrgs(ctx, api, internal.OrgQuery{GroupID: groupID}, orgID)
+	if err != nil {
+		return append(checks, doctorCheck{name: "Orgs", status: checkFail, detail: err.Error(),
+			hint: "Listing a group's orgs requires group admin (or a group service account)."})
+	}
+	if len(orgs) == 0 {
+		return append(checks, doctorCheck{name: "Orgs", status: checkWarn, detail: fmt.Sprintf("group %s has no orgs", groupID)})
+	}
+	if groupID != "" {
+		checks = append(checks, doctorCheck{name: "Orgs", status: checkOK, detail: fmt.Sprintf("%d org(s) in group %s", len(orgs), groupID)})
+	}
+
+	// The remaining checks use one org as a sample.
+	org := orgs[0]
+	label := org.ID
+	if org.Name != "" {
+		label = fmt.Sprintf("%s (%s)", org.Name, org.ID)
+	}
+
+	integrations, err := api.ListIntegrations(ctx, org.ID)
+	if err != nil {
+		checks = append(checks, doctorCheck{name: "Integrations", status: checkFail, detail: fmt.Sprintf("%s: %v", label, err)})
+	} else {
+		var scm []string
+		for name := range integrations {
+			if internal.IsSCMOrigin(name) {
+				scm = append(scm, name)
+			}
+		}
+		sort.Strings(scm)
+		c := doctorCheck{name: "Integrations", status: checkOK, detail: fmt.Sprintf("%s: %d integration(s), SCM: %s", label, len(integrations), strings.Join(scm, ", "))}
+		if len(scm) == 0 {
+			c.status = checkWarn
+			c.hint = "This org has no supported SCM integration, so refresh exports nothing for it."
+		}
+		checks = append(checks, c)
+	}
+
+	// One page of one project is enough: counting would page the whole org.
+	if err := api.ProbeListProjects(ctx, org.ID); err != nil {
+		checks = append(checks, doctorCheck{name: "Projects", status: checkFail, detail: fmt.Sprintf("%s: %v", label, err)})
+	} else {
+		checks = append(checks, doctorCheck{name: "Projects", status: checkOK, detail: fmt.Sprintf("%s: can list projects", label)})
+	}
+
+	allowed, err := api.ProbeProjectDelete(ctx, org.ID)
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{name: "Delete permission", status: checkWarn, detail: fmt.Sprintf("%s: could not determine: %v", label, err)})
+	case !allowed:
+		checks = append(checks, doctorCheck{name: "Delete permission", status: checkWarn, detail: fmt.Sprintf("%s: denied (403)", label),
+			hint: "dedup --delete needs a role that can delete projects (e.g. Org Admin); refresh and dry-run dedup still work."})
+	default:
+		checks = append(checks, doctorCheck{name: "Delete permission", status: checkOK, detail: fmt.Sprintf("%s: allowed", label)})
+	}
+	return checks
+}
+
+// runDoctor implements the doctor subcommand.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	groupID := fs.String("groupId", "", "Snyk group ID to check access to")
+	orgID := fs.String("orgId", "", "Single Snyk org ID to check access to")
+	clientOpts := addClientFlags(fs)
+	logOpts := addLogFlags(fs)
+	configOpts := addConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if err := configOpts.apply(fs, "doctor"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	closeLog, err := logOpts.setup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer closeLog()
+	if *groupID != "" && *orgID != "" {
+		fmt.Fprintf(os.Stderr, "Error: --groupId and --orgId are mutually exclusive\n")
+		return exitFatal
+	}
+
+	ctx := context.Background()
+	baseURL := clientOpts.baseURL()
+	client, err := clientOpts.newClient()
+	if err != nil {
+		checks := []doctorCheck{
+			{name: "API base URL", status: checkOK, detail: describeBaseURL(baseURL)},
+			{name: "Client setup", status: checkFail, detail: err.Error()},
+		}
+		printDoctorChecks(os.Stdout, checks)
+		return exitFatal
+	}
+
+	checks := checkBaseURL(ctx, client.HTTP, client.BaseURL)
+	if !doctorFailed(checks) {
+		checks = append(checks, runDoctorChecks(ctx, newSnykAPI(client).(doctorAPI), client.BaseURL, *groupID, *orgID)...)
+	}
+	printDoctorChecks(os.Stdout, checks)
+	if doctorFailed(checks) {
+		return exitFatal
+	}
+	return exitOK
+}
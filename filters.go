@@ -0,0 +1,154 @@
+// filters.go defines the project filter flags shared by the refresh and dedup subcommands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// stringList is a repeatable string flag (e.g. --tag a=b --tag c=d).
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// projectFilterFlags holds the raw values of the project filter flags.
+type projectFilterFlags struct {
+	types               *string
+	targetIDs           *string
+	tags                stringList
+	environment         *string
+	lifecycle           *string
+	businessCriticality *string
+	status              *string
+	createdBefore       *string
+	createdAfter        *string
+	where               *string
+}
+
+// addProjectFilterFlags registers the project filter flags on fs.
+func addProjectFilterFlags(fs *flag.FlagSet) *projectFilterFlags {
+	f := &projectFilterFlags{}
+	f.types = fs.String("projectType", "", "Only include projects of these types, comma-separated (e.g. npm,maven)")
+	f.targetIDs = fs.String("targetId", "", "Only include projects of these Snyk target IDs, comma-separated")
+	fs.Var(&f.tags, "tag", "Only include projects with this tag (key=value); repeat to require several tags")
+	f.environment = fs.String("environment", "", "Only include projects with one of these environment attributes, comma-separated (e.g. frontend,backend)")
+	f.lifecycle = fs.String("lifecycle", "", "Only include projects with one of these lifecycle attributes, comma-separated (e.g. production)")
+	f.businessCriticality = fs.String("businessCriticality", "", "Only include projects with one of these business criticality attributes, comma-separated (e.g. critical,high)")
+	f.status = fs.String("status", "", "Only include projects with this status: active or inactive")
+	f.createdBefore = fs.String("createdBefore", "", "Only include projects created before this date (YYYY-MM-DD or RFC 3339)")
+	f.createdAfter = fs.String("createdAfter", "", "Only include projects created on or after this date (YYYY-MM-DD or RFC 3339)")
+	f.where = fs.String("where", "", `Only include projects matching this expression, e.g. 'origin == "github" && created < "2024-01-01" && name matches "^acme/"'`)
+	return f
+}
+
+// whereExpr compiles the --where expression, or returns nil if none was given.
+func (f *projectFilterFlags) whereExpr() (*internal.Expr, error) {
+	if *f.where == "" {
+		return nil, nil
+	}
+	return internal.CompileExpr(*f.where)
+}
+
+// build validates the flag values and returns the corresponding filters.
+func (f *projectFilterFlags) build() ([]internal.ProjectFilter, error) {
+	var filters []internal.ProjectFilter
+	if types := splitList(*f.types); len(types) > 0 {
+		filters = append(filters, internal.FilterTypes(types...))
+	}
+	if ids := splitList(*f.targetIDs); len(ids) > 0 {
+		filters = append(filters, internal.FilterTargetIDs(ids...))
+	}
+	for _, tag := range f.tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --tag %q: expected key=value", tag)
+		}
+		filters = append(filters, internal.FilterTag(key, value))
+	}
+	for name, raw := range map[string]string{
+		"environment":          *f.environment,
+		"lifecycle":            *f.lifecycle,
+		"business_criticality": *f.businessCriticality,
+	} {
+		if values := splitList(raw); len(values) > 0 {
+			filter, err := internal.FilterAttribute(name, values...)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	switch *f.status {
+	case "":
+	case "active", "inactive":
+		filters = append(filters, internal.FilterStatus(*f.status))
+	default:
+		return nil, fmt.Errorf("invalid --status %q: expected active or inactive", *f.status)
+	}
+	if *f.createdBefore != "" {
+		t, err := internal.ParseDate(*f.createdBefore)
+		if err != nil {
+			return nil, fmt.Errorf("--createdBefore: %w", err)
+		}
+		filters = append(filters, internal.FilterCreatedBefore(t))
+	}
+	if *f.createdAfter != "" {
+		t, err := internal.ParseDate(*f.createdAfter)
+		if err != nil {
+			return nil, fmt.Errorf("--createdAfter: %w", err)
+		}
+		filters = append(filters, internal.FilterCreatedAfter(t))
+	}
+	return filters, nil
+}
+
+// query returns the subset of the filters the REST projects endpoint can
+// apply server-side. Call it after build has validated the flags.
+func (f *projectFilterFlags) query() internal.ProjectQuery {
+	q := internal.ProjectQuery{
+		Types:               splitList(*f.types),
+		TargetIDs:           splitList(*f.targetIDs),
+		Environment:         splitList(*f.environment),
+		Lifecycle:           splitList(*f.lifecycle),
+		BusinessCriticality: splitList(*f.businessCriticality),
+	}
+	for _, tag := range f.tags {
+		if key, value, ok := strings.Cut(tag, "="); ok && key != "" {
+			q.Tags = append(q.Tags, internal.Tag{Key: key, Value: value})
+		}
+	}
+	return q
+}
+
+// filterProjects returns the projects that pass every filter.
+func filterProjects(projects []internal.Project, filters []internal.ProjectFilter) []internal.Project {
+	if len(filters) == 0 {
+		return projects
+	}
+	var out []internal.Project
+	for _, p := range projects {
+		if internal.MatchAll(p, filters) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
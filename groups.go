@@ -0,0 +1,146 @@
+// groups.go lets refresh scan several Snyk groups in one run (--group),
+// each optionally in its own region with its own credentials.
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// groupPlaceholder in --output writes one file per group.
+const groupPlaceholder = "{group}"
+
+// GroupMeta describes a group in the output JSON of a --group run.
+type GroupMeta struct {
+	Name   string `json:"name,omitempty"`
+	APIURL string `json:"apiUrl"`
+	Region string `json:"region,omitempty"` // e.g. SNYK-EU-01; empty for private deployments
+}
+
+// groupSpec is one --group value.
+type groupSpec struct {
+	id        string
+	name      string // used for {group} in --output; default: id
+	apiURL    string // default: --apiUrl
+	tokenEnv  string // with tokenFile, default: the global credentials
+	tokenFile string
+}
+
+// parseGroupSpec parses
+// "<groupId>[,api=<url>][,tokenEnv=<VAR>][,tokenFile=<path>][,name=<label>]".
+func parseGroupSpec(s string) (groupSpec, error) {
+	parts := strings.Split(s, ",")
+	g := groupSpec{id: strings.TrimSpace(parts[0])}
+	if g.id == "" || strings.Contains(g.id, "=") {
+		return groupSpec{}, fmt.Errorf("invalid --group %q: must start with a group ID", s)
+	}
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return groupSpec{}, fmt.Errorf("invalid --group %q: expected key=value, got %q", s, part)
+		}
+		switch key {
+		case "api":
+			g.apiURL = strings.TrimSuffix(value, "/")
+		case "tokenEnv":
+			g.tokenEnv = value
+		case "tokenFile":
+			g.tokenFile = value
+		case "name":
+			if strings.ContainsAny(value, `/\`) {
+				return groupSpec{}, fmt.Errorf("invalid --group %q: name must not contain path separators", s)
+			}
+			g.name = value
+		default:
+			return groupSpec{}, fmt.Errorf("invalid --group %q: unknown key %q (expected api, tokenEnv, tokenFile or name)", s, key)
+		}
+	}
+	return g, nil
+}
+
+// parseGroupSpecs parses the --group values, rejecting repeated groups.
+func parseGroupSpecs(values []string) ([]groupSpec, error) {
+	var specs []groupSpec
+	seen := make(map[string]bool)
+	for _, v := range values {
+		g, err := parseGroupSpec(v)
+		if err != nil {
+			return nil, err
+		}
+		if seen[g.id] {
+			return nil, fmt.Errorf("--group %s given more than once", g.id)
+		}
+		seen[g.id] = true
+		specs = append(specs, g)
+	}
+	return specs, nil
+}
+
+// label returns the group's name, or its ID if it has none.
+func (g groupSpec) label() string {
+	if g.name != "" {
+		return g.name
+	}
+	return g.id
+}
+
+// forGroup returns a copy of f with g's API URL and credentials applied.
+func (f *clientFlags) forGroup(g groupSpec) *clientFlags {
+	c := *f
+	if g.apiURL != "" {
+		c.apiURL = &g.apiURL
+	}
+	if g.tokenEnv != "" || g.tokenFile != "" {
+		c.tokenEnv, c.tokenFile = &g.tokenEnv, &g.tokenFile
+	}
+	return &c
+}
+
+// groupMeta returns the output metadata of g, reached at baseURL.
+func groupMeta(g groupSpec, baseURL string) GroupMeta {
+	m := GroupMeta{Name: g.name, APIURL: baseURL}
+	if r, ok := internal.RegionForBaseURL(baseURL); ok {
+		m.Region = r.Name
+	}
+	return m
+}
+
+// groupOutputPath returns output with {group} replaced by g's label.
+func groupOutputPath(output string, g groupSpec) string {
+	return strings.ReplaceAll(output, groupPlaceholder, g.label())
+}
+
+// validateGroups checks the org selection of a run: --group excludes
+// --groupId and --orgId; without it, see validateGroupOrOrg.
+func validateGroups(groups []groupSpec, q internal.OrgQuery, orgID string) error {
+	if len(groups) == 0 {
+		return validateGroupOrOrg(q, orgID)
+	}
+	if q.GroupID != "" || orgID != "" {
+		return fmt.Errorf("--group cannot be combined with --groupId or --orgId")
+	}
+	return nil
+}
+
+// groupScan is one group of a run, with the client that reaches it and its orgs.
+type groupScan struct {
+	spec   groupSpec
+	client *internal.Client
+	api    SnykAPI
+	orgs   []internal.Org
+}
+
+// importAPIURL returns the API URL shared by all groups, for the
+// snyk-api-import hint. ok is false without groups or if they span several
+// API URLs, which snyk-api-import cannot import from one file.
+func importAPIURL(groups map[string]GroupMeta) (apiURL string, ok bool) {
+	for _, g := range groups {
+		if apiURL != "" && g.APIURL != apiURL {
+			return "", false
+		}
+		apiURL = g.APIURL
+	}
+	return apiURL, apiURL != ""
+}
@@ -0,0 +1,137 @@
+// hook.go implements the refresh transform hook: an external executable that
+// can accept, reject or rewrite each candidate import target.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// Transform hook actions returned by the executable.
+const (
+	hookAccept = "accept"
+	hookReject = "reject"
+	hookModify = "modify"
+)
+
+// hookRequest is written as JSON to the hook's stdin, one invocation per candidate target.
+type hookRequest struct {
+	Target  internal.ImportTarget `json:"target"`
+	Project internal.Project      `json:"project"`
+	Org     hookOrg               `json:"org"`
+}
+
+// hookOrg identifies the org a candidate target belongs to.
+type hookOrg struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Slug string `json:"slug,omitempty"`
+}
+
+// hookResponse is read as JSON from the hook's stdout.
+// Target is required when Action is "modify" and ignored otherwise.
+type hookResponse struct {
+	Action string                 `json:"action"`
+	Target *internal.ImportTarget `json:"target,omitempty"`
+}
+
+// targetTransform decides what happens to a candidate target. It returns the
+// (possibly modified) target and whether to keep it.
+type targetTransform func(ctx context.Context, org internal.Org, p internal.Project, it internal.ImportTarget) (internal.ImportTarget, bool, error)
+
+// newExecTransform returns a targetTransform that runs the executable at path
+// for every candidate, killing it if it runs longer than timeout.
+func newExecTransform(path string, timeout time.Duration) (targetTransform, error) {
+	if _, err := exec.LookPath(path); err != nil {
+		return nil, fmt.Errorf("transform hook: %w", err)
+	}
+	return func(ctx context.Context, org internal.Org, p internal.Project, it internal.ImportTarget) (internal.ImportTarget, bool, error) {
+		in, err := json.Marshal(hookRequest{
+			Target:  it,
+			Project: p,
+			Org:     hookOrg{ID: org.ID, Name: org.Name, Slug: org.Slug},
+		})
+		if err != nil {
+			return it, false, fmt.Errorf("marshal hook request: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, path)
+		cmd.Stdin = bytes.NewReader(in)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return it, false, fmt.Errorf("transform hook %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+		}
+
+		var resp hookResponse
+		if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+			return it, false, fmt.Errorf("transform hook %s: decode response: %w", path, err)
+		}
+		return resp.apply(it)
+	}, nil
+}
+
+// apply interprets a hook response for the candidate target it.
+func (r hookResponse) apply(it internal.ImportTarget) (internal.ImportTarget, bool, error) {
+	switch r.Action {
+	case hookAccept:
+		return it, true, nil
+	case hookReject:
+		return it, false, nil
+	case hookModify:
+		if r.Target == nil {
+			return it, false, fmt.Errorf("transform hook: action %q without target", r.Action)
+		}
+		if r.Target.OrgID == "" || r.Target.IntegrationID == "" {
+			return it, false, fmt.Errorf("transform hook: modified target needs orgId and integrationId")
+		}
+		return *r.Target, true, nil
+	default:
+		return it, false, fmt.Errorf("transform hook: unknown action %q", r.Action)
+	}
+}
+
+// applyTransform runs transform over the candidates of org and returns the
+// kept targets, deduplicated again since a modified target may collide with
+// another. A kept target must stay in org and use one of its integrations,
+// or snyk-api-import could not import it.
+func applyTransform(ctx context.Context, transform targetTransform, org internal.Org, integrations map[string]string, cands []targetCandidate) ([]internal.ImportTarget, error) {
+	intIDs := make(map[string]bool, len(integrations))
+	for _, id := range integrations {
+		intIDs[id] = true
+	}
+	var targets []internal.ImportTarget
+	seen := make(map[string]bool)
+	for _, c := range cands {
+		it, keep, err := transform(ctx, org, c.project, c.target)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		if it.OrgID != org.ID {
+			return nil, fmt.Errorf("transform hook: target %s moved to org %q, want %q", it.Target.Name, it.OrgID, org.ID)
+		}
+		if !intIDs[it.IntegrationID] {
+			return nil, fmt.Errorf("transform hook: target %s uses integration %q, which org %s does not have", it.Target.Name, it.IntegrationID, org.ID)
+		}
+		tid := internal.TargetID(it.OrgID, it.IntegrationID, it.Target)
+		if seen[tid] {
+			continue
+		}
+		seen[tid] = true
+		targets = append(targets, it)
+	}
+	return targets, nil
+}
@@ -11,96 +11,102 @@ import (
 
 // Org represents a Snyk organization.
 type Org struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	GroupID string `json:"groupId,omitempty"`
+	Created string `json:"created,omitempty"` // ISO 8601 timestamp from Snyk API
 }
 
 // Project represents a Snyk project with the fields we need for refresh.
 type Project struct {
-	ID              string
-	Name            string
-	Origin          string
-	Branch          string
-	TargetReference string
-	Created         string // ISO 8601 timestamp from Snyk API
-	TargetID        string // Snyk target ID from relationships
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Origin          string `json:"origin"`
+	Branch          string `json:"branch,omitempty"`
+	TargetReference string `json:"targetReference,omitempty"`
+	Created         string `json:"created,omitempty"`       // ISO 8601 timestamp from Snyk API
+	TargetID        string `json:"targetId,omitempty"`      // Snyk target ID from relationships
+	RemoteRepoURL   string `json:"remoteRepoUrl,omitempty"` // Remote repository URL reported by `snyk monitor` (CLI projects)
+	Type            string `json:"type,omitempty"`          // Package manager / project type (e.g. npm, maven, sast)
+	TargetFile      string `json:"targetFile,omitempty"`
+	Status          string `json:"status,omitempty"` // "active" or "inactive" (deactivated)
+	Tags            []Tag  `json:"tags,omitempty"`
+	// Project attributes set in the Snyk UI/API.
+	Environment         []string `json:"environment,omitempty"`
+	Lifecycle           []string `json:"lifecycle,omitempty"`
+	BusinessCriticality []string `json:"businessCriticality,omitempty"`
 }
 
-// FetchOrgs fetches all organizations in a Snyk group, handling pagination.
-func FetchOrgs(ctx context.Context, client *http.Client, token, groupID string) ([]Org, error) {
-	baseURL := GetSnykAPIBaseURL()
-	var allOrgs []Org
-	page := 1
-	perPage := 100
+// Tag is a key/value project tag.
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
 
-	for {
-		apiURL := fmt.Sprintf("%s/v1/group/%s/orgs?perPage=%d&page=%d",
-			baseURL, url.PathEscape(groupID), perPage, page)
+// OrgQuery selects orgs for FetchOrgs. Empty fields are not sent.
+type OrgQuery struct {
+	GroupID string // orgs in this group; "" lists every org the token can see
+	Name    string // orgs whose name contains this (server-side, case-insensitive)
+	Slug    string // the org with exactly this slug
+}
 
-		req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Authorization", "token "+token)
-		req.Header.Set("Accept", "application/json")
+// orgAttributes are the attributes of a REST org resource.
+type orgAttributes struct {
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	GroupID   string `json:"group_id"`
+	CreatedAt string `json:"created_at"`
+}
 
-		resp, body, err := DoWithRetry(ctx, client, req)
+// FetchOrgs lists the orgs matching q from /rest/orgs, following cursor
+// pagination. Without a group ID it returns the orgs the credentials can
+// access directly, so it also works for org-scoped tokens.
+func FetchOrgs(ctx context.Context, c *Client, q OrgQuery) ([]Org, error) {
+	filters := url.Values{}
+	if q.GroupID != "" {
+		filters.Set("group_id", q.GroupID)
+	}
+	if q.Name != "" {
+		filters.Set("name", q.Name)
+	}
+	if q.Slug != "" {
+		filters.Set("slug", q.Slug)
+	}
+	var orgs []Org
+	for o, err := range Paginate[Resource[orgAttributes, struct{}]](ctx, c, "/rest/orgs", ListOptions{Filters: filters}) {
 		if err != nil {
-			return nil, fmt.Errorf("fetch orgs page %d: %w", page, err)
-		}
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("fetch orgs: status %d, body: %s", resp.StatusCode, string(body))
-		}
-
-		var response struct {
-			Orgs []struct {
-				ID   string `json:"id"`
-				Name string `json:"name"`
-				Slug string `json:"slug"`
-			} `json:"orgs"`
-		}
-		if err := json.Unmarshal(body, &response); err != nil {
-			return nil, fmt.Errorf("decode orgs response: %w", err)
+			return nil, fmt.Errorf("fetch orgs: %w", err)
 		}
-
-		for _, o := range response.Orgs {
-			allOrgs = append(allOrgs, Org{
-				ID:   o.ID,
-				Name: o.Name,
-				Slug: o.Slug,
-			})
-		}
-
-		// If we got fewer than perPage results, we've reached the last page
-		if len(response.Orgs) < perPage {
-			break
-		}
-		page++
+		orgs = append(orgs, Org{
+			ID:      o.ID,
+			Name:    o.Attributes.Name,
+			Slug:    o.Attributes.Slug,
+			GroupID: o.Attributes.GroupID,
+			Created: o.Attributes.CreatedAt,
+		})
 	}
-
-	return allOrgs, nil
+	return orgs, nil
 }
 
 // ListIntegrations lists integrations for a Snyk org.
 // Returns a map of integration type name to integration ID.
-func ListIntegrations(ctx context.Context, client *http.Client, token, orgID string) (map[string]string, error) {
-	baseURL := GetSnykAPIBaseURL()
+func ListIntegrations(ctx context.Context, c *Client, orgID string) (map[string]string, error) {
+	baseURL := c.BaseURL
 	apiURL := fmt.Sprintf("%s/v1/org/%s/integrations", baseURL, url.PathEscape(orgID))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/json")
 
-	resp, body, err := DoWithRetry(ctx, client, req)
+	resp, body, err := DoWithRetry(ctx, c, req)
 	if err != nil {
 		return nil, fmt.Errorf("list integrations: %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("list integrations: status %d, body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("list integrations: %w", newAPIError(resp, body))
 	}
 
 	var data map[string]string
@@ -110,108 +116,109 @@ func ListIntegrations(ctx context.Context, client *http.Client, token, orgID str
 	return data, nil
 }
 
+// projectAttributes are the attributes of a REST project resource. Some
+// fields appear in both snake_case and camelCase depending on the API version.
+type projectAttributes struct {
+	Name                 string   `json:"name"`
+	Origin               string   `json:"origin"`
+	Created              string   `json:"created"`
+	Branch               string   `json:"branch"`
+	TargetReference      string   `json:"target_reference"`
+	TargetReferenceCamel string   `json:"targetReference"`
+	RemoteRepoURL        string   `json:"remote_repo_url"`
+	RemoteRepoURLCamel   string   `json:"remoteRepoUrl"`
+	Type                 string   `json:"type"`
+	TargetFile           string   `json:"target_file"`
+	Status               string   `json:"status"`
+	Tags                 []Tag    `json:"tags"`
+	Environment          []string `json:"environment"`
+	Lifecycle            []string `json:"lifecycle"`
+	BusinessCriticality  []string `json:"business_criticality"`
+}
+
+// projectRelationships are the relationships of a REST project resource.
+type projectRelationships struct {
+	Target Relationship[struct{}] `json:"target"`
+}
+
+// projectResource is a REST project as returned by /rest/orgs/{id}/projects.
+type projectResource = Resource[projectAttributes, projectRelationships]
+
+// projectFromResource converts a REST project resource into a Project.
+func projectFromResource(r projectResource) Project {
+	a := r.Attributes
+	// Branch: prefer targetReference, fall back to branch
+	targetRef := a.TargetReferenceCamel
+	if targetRef == "" {
+		targetRef = a.TargetReference
+	}
+	branch := a.Branch
+	if branch == "" {
+		branch = targetRef
+	}
+	remoteURL := a.RemoteRepoURL
+	if remoteURL == "" {
+		remoteURL = a.RemoteRepoURLCamel
+	}
+	return Project{
+		ID:                  r.ID,
+		Name:                a.Name,
+		Origin:              a.Origin,
+		Branch:              branch,
+		TargetReference:     targetRef,
+		Created:             a.Created,
+		TargetID:            r.Relationships.Target.ID(),
+		RemoteRepoURL:       remoteURL,
+		Type:                a.Type,
+		TargetFile:          a.TargetFile,
+		Status:              a.Status,
+		Tags:                a.Tags,
+		Environment:         a.Environment,
+		Lifecycle:           a.Lifecycle,
+		BusinessCriticality: a.BusinessCriticality,
+	}
+}
+
 // FetchProjects fetches all projects for a Snyk org via the REST API,
 // including the origin and targetReference fields needed for refresh.
-func FetchProjects(ctx context.Context, client *http.Client, token, orgID string) ([]Project, error) {
-	baseURL := GetSnykAPIBaseURL()
-	firstURL := fmt.Sprintf("%s/rest/orgs/%s/projects?version=2025-09-28&limit=100",
-		baseURL, url.PathEscape(orgID))
+func FetchProjects(ctx context.Context, c *Client, orgID string) ([]Project, error) {
 	var projects []Project
-	nextURL := firstURL
-
-	// Extract host for SSRF-safe pagination
-	apiHost := "api.snyk.io"
-	if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
-		apiHost = parsed.Host
+	err := StreamProjects(ctx, c, orgID, ProjectQuery{}, func(page []Project) error {
+		projects = append(projects, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return projects, nil
+}
 
-	for nextURL != "" {
-		req, err := http.NewRequestWithContext(ctx, "GET", nextURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Authorization", "token "+token)
-		req.Header.Set("Accept", "application/vnd.api+json")
-
-		resp, body, err := DoWithRetry(ctx, client, req)
+// StreamProjects calls fn with each page of an org's projects matching q as
+// it arrives, so callers can process very large orgs without holding every
+// project in memory. An error returned by fn stops the iteration and is
+// returned as is. A 404 (org not found) yields no pages and no error.
+func StreamProjects(ctx context.Context, c *Client, orgID string, q ProjectQuery, fn func([]Project) error) error {
+	path := fmt.Sprintf("/rest/orgs/%s/projects", url.PathEscape(orgID))
+	// Pages are already as large as the API allows (MaxPageSize), so
+	// filtering server-side is the only way to fetch fewer of them.
+	opts := ListOptions{Limit: MaxPageSize, Filters: q.values()}
+	for page, err := range Pages[projectResource](ctx, c, path, opts) {
 		if err != nil {
-			return nil, fmt.Errorf("fetch projects: %w", err)
-		}
-		if resp.StatusCode == 404 {
-			// Org not found or no projects
-			return projects, nil
-		}
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("fetch projects: status %d, body: %s", resp.StatusCode, string(body))
-		}
-
-		var result struct {
-			Data []struct {
-				ID            string                 `json:"id"`
-				Attributes    map[string]interface{} `json:"attributes"`
-				Relationships map[string]interface{} `json:"relationships"`
-			} `json:"data"`
-			Links map[string]interface{} `json:"links"`
-		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			return nil, fmt.Errorf("decode projects: %w", err)
-		}
-
-		for _, p := range result.Data {
-			attrs := p.Attributes
-			name, _ := attrs["name"].(string)
-			origin, _ := attrs["origin"].(string)
-			created, _ := attrs["created"].(string)
-
-			// Extract branch: prefer targetReference, fall back to branch
-			targetRef, _ := attrs["targetReference"].(string)
-			if targetRef == "" {
-				targetRef, _ = attrs["target_reference"].(string)
-			}
-			branch, _ := attrs["branch"].(string)
-			if branch == "" {
-				branch = targetRef
-			}
-
-			// Extract target ID from relationships
-			var targetID string
-			if rels := p.Relationships; rels != nil {
-				if targetRel, ok := rels["target"].(map[string]interface{}); ok {
-					if targetData, ok := targetRel["data"].(map[string]interface{}); ok {
-						targetID, _ = targetData["id"].(string)
-					}
-				}
+			if ClassifyError(err) == ClassNotFound {
+				// Org not found or no projects
+				return nil
 			}
-
-			projects = append(projects, Project{
-				ID:              p.ID,
-				Name:            name,
-				Origin:          origin,
-				Branch:          branch,
-				TargetReference: targetRef,
-				Created:         created,
-				TargetID:        targetID,
-			})
+			return fmt.Errorf("fetch projects: %w", err)
 		}
-
-		// Pagination: follow links.next with SSRF validation
-		nextURL = ""
-		if result.Links != nil {
-			if nextRaw, ok := result.Links["next"]; ok {
-				if nextStr, ok := nextRaw.(string); ok && nextStr != "" {
-					if isAllowedNextURL(nextStr, apiHost) {
-						if strings.HasPrefix(nextStr, "/") {
-							nextURL = baseURL + nextStr
-						} else {
-							nextURL = nextStr
-						}
-					}
-				}
-			}
+		projects := make([]Project, len(page.Data))
+		for i, r := range page.Data {
+			projects[i] = projectFromResource(r)
+		}
+		if err := fn(projects); err != nil {
+			return err
 		}
 	}
-
-	return projects, nil
+	return nil
 }
 
 // APITarget represents a Snyk target (repo-level entry) from the REST API.
@@ -224,117 +231,63 @@ type APITarget struct {
 	CreatedAt       string
 }
 
+// targetResource is a REST target as returned by /rest/orgs/{id}/targets.
+type targetResource = Resource[struct {
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}, struct {
+	Integration Relationship[struct {
+		IntegrationType string `json:"integration_type"`
+	}] `json:"integration"`
+}]
+
 // FetchTargets fetches all targets for a Snyk org via the REST API,
 // including empty targets (no projects). This is needed to find orphaned
 // targets left behind after project deletion.
-func FetchTargets(ctx context.Context, client *http.Client, token, orgID string) ([]APITarget, error) {
-	baseURL := GetSnykAPIBaseURL()
-	firstURL := fmt.Sprintf("%s/rest/orgs/%s/targets?version=2025-09-28&limit=100&exclude_empty=false",
-		baseURL, url.PathEscape(orgID))
+func FetchTargets(ctx context.Context, c *Client, orgID string) ([]APITarget, error) {
 	var targets []APITarget
-	nextURL := firstURL
-
-	apiHost := "api.snyk.io"
-	if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
-		apiHost = parsed.Host
-	}
-
-	for nextURL != "" {
-		req, err := http.NewRequestWithContext(ctx, "GET", nextURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Authorization", "token "+token)
-		req.Header.Set("Accept", "application/vnd.api+json")
-
-		resp, body, err := DoWithRetry(ctx, client, req)
+	path := fmt.Sprintf("/rest/orgs/%s/targets", url.PathEscape(orgID))
+	opts := ListOptions{Filters: url.Values{"exclude_empty": {"false"}}}
+	for t, err := range Paginate[targetResource](ctx, c, path, opts) {
 		if err != nil {
+			if ClassifyError(err) == ClassNotFound {
+				return targets, nil
+			}
 			return nil, fmt.Errorf("fetch targets: %w", err)
 		}
-		if resp.StatusCode == 404 {
-			return targets, nil
-		}
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("fetch targets: status %d, body: %s", resp.StatusCode, string(body))
-		}
-
-		var result struct {
-			Data []struct {
-				ID            string                 `json:"id"`
-				Attributes    map[string]interface{} `json:"attributes"`
-				Relationships map[string]interface{} `json:"relationships"`
-			} `json:"data"`
-			Links map[string]interface{} `json:"links"`
-		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			return nil, fmt.Errorf("decode targets: %w", err)
+		at := APITarget{
+			ID:            t.ID,
+			DisplayName:   t.Attributes.DisplayName,
+			IntegrationID: t.Relationships.Integration.ID(),
+			CreatedAt:     t.Attributes.CreatedAt,
 		}
-
-		for _, t := range result.Data {
-			attrs := t.Attributes
-			displayName, _ := attrs["display_name"].(string)
-			createdAt, _ := attrs["created_at"].(string)
-
-			var integrationID, integrationType string
-			if rels := t.Relationships; rels != nil {
-				if intRel, ok := rels["integration"].(map[string]interface{}); ok {
-					if intData, ok := intRel["data"].(map[string]interface{}); ok {
-						integrationID, _ = intData["id"].(string)
-						if intAttrs, ok := intData["attributes"].(map[string]interface{}); ok {
-							integrationType, _ = intAttrs["integration_type"].(string)
-						}
-					}
-				}
-			}
-
-			targets = append(targets, APITarget{
-				ID:              t.ID,
-				DisplayName:     displayName,
-				IntegrationID:   integrationID,
-				IntegrationType: integrationType,
-				CreatedAt:       createdAt,
-			})
-		}
-
-		nextURL = ""
-		if result.Links != nil {
-			if nextRaw, ok := result.Links["next"]; ok {
-				if nextStr, ok := nextRaw.(string); ok && nextStr != "" {
-					if isAllowedNextURL(nextStr, apiHost) {
-						if strings.HasPrefix(nextStr, "/") {
-							nextURL = baseURL + nextStr
-						} else {
-							nextURL = nextStr
-						}
-					}
-				}
-			}
+		if d := t.Relationships.Integration.Data; d != nil {
+			at.IntegrationType = d.Attributes.IntegrationType
 		}
+		targets = append(targets, at)
 	}
-
 	return targets, nil
 }
 
 // DeleteProject deletes a single project from a Snyk org via the REST API.
-func DeleteProject(ctx context.Context, client *http.Client, token, orgID, projectID string) error {
-	baseURL := GetSnykAPIBaseURL()
-	apiURL := fmt.Sprintf("%s/rest/orgs/%s/projects/%s?version=2025-09-28",
-		baseURL, url.PathEscape(orgID), url.PathEscape(projectID))
+func DeleteProject(ctx context.Context, c *Client, orgID, projectID string) error {
+	baseURL := c.BaseURL
+	apiURL := fmt.Sprintf("%s/rest/orgs/%s/projects/%s?version=%s",
+		baseURL, url.PathEscape(orgID), url.PathEscape(projectID), RESTVersion)
 
 	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.api+json")
 
-	resp, body, err := DoWithRetry(ctx, client, req)
+	resp, body, err := DoWithRetry(ctx, c, req)
 	if err != nil {
 		return fmt.Errorf("delete project: %w", err)
 	}
 	// 204 No Content is the expected success response
 	if resp.StatusCode != 204 && resp.StatusCode != 200 {
-		return fmt.Errorf("delete project: status %d, body: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("delete project: %w", newAPIError(resp, body))
 	}
 	return nil
 }
@@ -342,24 +295,23 @@ func DeleteProject(ctx context.Context, client *http.Client, token, orgID, proje
 // DeleteTarget deletes a target from a Snyk org via the REST API.
 // This removes the repository-level entry. It will fail if the target
 // still has projects attached.
-func DeleteTarget(ctx context.Context, client *http.Client, token, orgID, targetID string) error {
-	baseURL := GetSnykAPIBaseURL()
-	apiURL := fmt.Sprintf("%s/rest/orgs/%s/targets/%s?version=2025-09-28",
-		baseURL, url.PathEscape(orgID), url.PathEscape(targetID))
+func DeleteTarget(ctx context.Context, c *Client, orgID, targetID string) error {
+	baseURL := c.BaseURL
+	apiURL := fmt.Sprintf("%s/rest/orgs/%s/targets/%s?version=%s",
+		baseURL, url.PathEscape(orgID), url.PathEscape(targetID), RESTVersion)
 
 	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.api+json")
 
-	resp, body, err := DoWithRetry(ctx, client, req)
+	resp, body, err := DoWithRetry(ctx, c, req)
 	if err != nil {
 		return fmt.Errorf("delete target: %w", err)
 	}
 	if resp.StatusCode != 204 && resp.StatusCode != 200 {
-		return fmt.Errorf("delete target: status %d, body: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("delete target: %w", newAPIError(resp, body))
 	}
 	return nil
 }
@@ -383,3 +335,115 @@ func isAllowedNextURL(nextURL, allowedHost string) bool {
 	host := u.Hostname()
 	return host == allowedHost || strings.HasSuffix(host, "."+allowedHost)
 }
+
+// Self describes the user or service account that owns the API credentials.
+type Self struct {
+	ID       string
+	Type     string // "user" or "service_account"
+	Name     string
+	Username string
+	Email    string
+}
+
+// FetchSelf returns the owner of the credentials via the REST /self endpoint.
+func FetchSelf(ctx context.Context, c *Client) (Self, error) {
+	apiURL := fmt.Sprintf("%s/rest/self?version=%s", c.BaseURL, RESTVersion)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return Self{}, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+
+	resp, body, err := DoWithRetry(ctx, c, req)
+	if err != nil {
+		return Self{}, fmt.Errorf("fetch self: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return Self{}, fmt.Errorf("fetch self: %w", newAPIError(resp, body))
+	}
+
+	var result struct {
+		Data struct {
+			ID         string `json:"id"`
+			Type       string `json:"type"`
+			Attributes struct {
+				Name     string `json:"name"`
+				Username string `json:"username"`
+				Email    string `json:"email"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Self{}, fmt.Errorf("decode self: %w", err)
+	}
+	d := result.Data
+	return Self{ID: d.ID, Type: d.Type, Name: d.Attributes.Name, Username: d.Attributes.Username, Email: d.Attributes.Email}, nil
+}
+
+// Group represents a Snyk group.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug,omitempty"`
+}
+
+// FetchGroups returns the groups the credentials can access.
+func FetchGroups(ctx context.Context, c *Client) ([]Group, error) {
+	var groups []Group
+	for g, err := range Paginate[Resource[groupAttributes, struct{}]](ctx, c, "/rest/groups", ListOptions{}) {
+		if err != nil {
+			return nil, fmt.Errorf("fetch groups: %w", err)
+		}
+		groups = append(groups, Group{ID: g.ID, Name: g.Attributes.Name, Slug: g.Attributes.Slug})
+	}
+	return groups, nil
+}
+
+// groupAttributes are the attributes of a REST group resource.
+type groupAttributes struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// ProbeListProjects checks that the credentials may list an org's projects
+// by requesting a single project, without paging through the rest.
+func ProbeListProjects(ctx context.Context, c *Client, orgID string) error {
+	path := fmt.Sprintf("/rest/orgs/%s/projects", url.PathEscape(orgID))
+	for _, err := range Pages[projectResource](ctx, c, path, ListOptions{Limit: 1}) {
+		if err != nil {
+			return fmt.Errorf("list projects: %w", err)
+		}
+		break
+	}
+	return nil
+}
+
+// probeProjectID is a well-formed project ID that never exists.
+const probeProjectID = "00000000-0000-0000-0000-000000000000"
+
+// ProbeProjectDelete reports whether the credentials may delete projects in
+// an org, without deleting anything: it deletes a project ID that cannot
+// exist. Snyk checks permissions before looking the project up, so 404 means
+// allowed and 403 means denied. Other statuses are returned as errors.
+func ProbeProjectDelete(ctx context.Context, c *Client, orgID string) (bool, error) {
+	apiURL := fmt.Sprintf("%s/rest/orgs/%s/projects/%s?version=%s",
+		c.BaseURL, url.PathEscape(orgID), probeProjectID, RESTVersion)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+
+	resp, body, err := DoWithRetry(ctx, c, req)
+	if err != nil {
+		return false, fmt.Errorf("probe delete: %w", err)
+	}
+	switch resp.StatusCode {
+	case 404:
+		return true, nil
+	case 403:
+		return false, nil
+	default:
+		return false, fmt.Errorf("probe delete: %w", newAPIError(resp, body))
+	}
+}
@@ -1,6 +1,13 @@
 package internal
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
 
 func TestIsAllowedNextURL(t *testing.T) {
 	tests := []struct {
@@ -46,3 +53,80 @@ func TestIsAllowedNextURL(t *testing.T) {
 		})
 	}
 }
+
+func TestProbeProjectDelete(t *testing.T) {
+	for _, tt := range []struct {
+		status  int
+		allowed bool
+		wantErr bool
+	}{
+		{404, true, false},
+		{403, false, false},
+		{400, false, true},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "DELETE" || !strings.HasSuffix(r.URL.Path, "/projects/"+probeProjectID) {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			w.WriteHeader(tt.status)
+		}))
+		allowed, err := ProbeProjectDelete(context.Background(), newTestClient(srv), "org-1")
+		srv.Close()
+		if allowed != tt.allowed || (err != nil) != tt.wantErr {
+			t.Errorf("status %d: allowed=%v err=%v", tt.status, allowed, err)
+		}
+	}
+}
+
+func TestProbeListProjects(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Query().Get("limit") != "1" {
+			t.Errorf("limit = %q, want 1", r.URL.Query().Get("limit"))
+		}
+		if r.URL.Path == "/rest/orgs/org-2/projects" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"p1","attributes":{"name":"a"}}],"links":{"next":"/rest/orgs/org-1/projects?starting_after=p1"}}`))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+	if err := ProbeListProjects(context.Background(), c, "org-1"); err != nil || calls.Load() != 1 {
+		t.Errorf("ProbeListProjects: err=%v after %d request(s), want one request", err, calls.Load())
+	}
+	if err := ProbeListProjects(context.Background(), c, "org-2"); ClassifyError(err) != ClassPermission {
+		t.Errorf("403: err = %v", err)
+	}
+}
+
+func TestFetchSelf(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"u1","type":"service_account","attributes":{"name":"exporter"}}}`))
+	}))
+	defer srv.Close()
+	self, err := FetchSelf(context.Background(), newTestClient(srv))
+	if err != nil || self.ID != "u1" || self.Type != "service_account" || self.Name != "exporter" {
+		t.Errorf("FetchSelf = %+v, %v", self, err)
+	}
+}
+
+func TestStreamProjects_SendsQuery(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+	q := ProjectQuery{Origins: []string{"github", "github-enterprise"}, Types: []string{"npm"}}
+	err := StreamProjects(context.Background(), newTestClient(srv), "org1", q, func([]Project) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamProjects: %v", err)
+	}
+	for _, want := range []string{"origins=github%2Cgithub-enterprise", "types=npm", "limit=100"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query %q missing %s", query, want)
+		}
+	}
+}
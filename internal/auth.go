@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authorization schemes understood by the Snyk API.
+const (
+	SchemeToken  = "token"  // Snyk API tokens
+	SchemeBearer = "bearer" // OAuth access tokens
+)
+
+// Token is an API credential and the Authorization scheme it is sent with.
+type Token struct {
+	Value  string
+	Scheme string
+	Expiry time.Time // zero if the token does not expire
+}
+
+// header returns the Authorization header value for t.
+func (t Token) header() string {
+	return t.Scheme + " " + t.Value
+}
+
+// TokenSource supplies the credential for each API request. Implementations
+// must be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// invalidator is implemented by token sources that can discard a cached
+// token, e.g. after the API rejects it with 401.
+type invalidator interface {
+	Invalidate()
+}
+
+// staticTokenSource always returns the same token.
+type staticTokenSource Token
+
+func (s staticTokenSource) Token(context.Context) (Token, error) { return Token(s), nil }
+
+// StaticTokenSource returns a TokenSource for a fixed Snyk API token.
+func StaticTokenSource(value string) TokenSource {
+	return staticTokenSource{Value: value, Scheme: SchemeToken}
+}
+
+// fileTokenSource reads an API token from a file, re-reading it when the
+// file changes so rotated mounted secrets are picked up mid-run.
+type fileTokenSource struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	token   Token
+}
+
+// FileTokenSource returns a TokenSource that reads a Snyk API token from path.
+func FileTokenSource(path string) (TokenSource, error) {
+	s := &fileTokenSource{path: path}
+	if _, err := s.Token(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileTokenSource) Token(context.Context) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("token file: %w", err)
+	}
+	if s.token.Value != "" && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("token file: %w", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return Token{}, fmt.Errorf("token file %s is empty", s.path)
+	}
+	s.token = Token{Value: value, Scheme: SchemeToken}
+	s.modTime = info.ModTime()
+	return s.token, nil
+}
+
+// oauthExpiryMargin is how long before expiry an OAuth token is refreshed.
+const oauthExpiryMargin = time.Minute
+
+// oauthTokenSource exchanges service-account client credentials for a
+// bearer token and refreshes it shortly before it expires.
+type oauthTokenSource struct {
+	http         *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	token Token
+}
+
+// OAuthClientCredentialsTokenSource returns a TokenSource that uses the OAuth
+// 2.0 client-credentials grant against tokenURL (e.g. https://api.snyk.io/oauth2/token).
+func OAuthClientCredentialsTokenSource(httpClient *http.Client, tokenURL, clientID, clientSecret string) TokenSource {
+	return &oauthTokenSource{
+		http:         httpClient,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+func (s *oauthTokenSource) Token(ctx context.Context) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.Value != "" && (s.token.Expiry.IsZero() || time.Until(s.token.Expiry) > oauthExpiryMargin) {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("oauth token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("read oauth token response: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return Token{}, fmt.Errorf("oauth token request: %w", newAPIError(resp, body))
+	}
+
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return Token{}, fmt.Errorf("decode oauth token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return Token{}, fmt.Errorf("oauth token response has no access_token")
+	}
+	s.token = Token{Value: tr.AccessToken, Scheme: SchemeBearer}
+	if tr.ExpiresIn > 0 {
+		s.token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return s.token, nil
+}
+
+// Invalidate discards the cached access token so the next call fetches a new one.
+func (s *oauthTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.token = Token{}
+	s.mu.Unlock()
+}
+
+// SnykCLIConfigPath returns the path of the Snyk CLI's stored configuration
+// (written by `snyk auth` / `snyk config set api=...`).
+func SnykCLIConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "configstore", "snyk.json")
+}
+
+// SnykCLIConfigToken reads the credential stored by the Snyk CLI at path:
+// an API token ("api"), or an OAuth access token stored by `snyk auth`
+// ("INTERNAL_OAUTH_TOKEN_STORAGE"). The CLI's OAuth token cannot be
+// refreshed by this tool, so an expired one is reported as an error.
+func SnykCLIConfigToken(path string) (Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Token{}, fmt.Errorf("snyk CLI config: %w", err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Token{}, fmt.Errorf("decode snyk CLI config %s: %w", path, err)
+	}
+	if api, _ := cfg["api"].(string); api != "" {
+		return Token{Value: api, Scheme: SchemeToken}, nil
+	}
+	if raw, _ := cfg["INTERNAL_OAUTH_TOKEN_STORAGE"].(string); raw != "" {
+		var stored struct {
+			AccessToken string    `json:"access_token"`
+			Expiry      time.Time `json:"expiry"`
+		}
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return Token{}, fmt.Errorf("decode snyk CLI OAuth token: %w", err)
+		}
+		if stored.AccessToken != "" {
+			if !stored.Expiry.IsZero() && time.Now().After(stored.Expiry) {
+				return Token{}, fmt.Errorf("snyk CLI OAuth token expired at %s: run `snyk auth` again", stored.Expiry.Format(time.RFC3339))
+			}
+			return Token{Value: stored.AccessToken, Scheme: SchemeBearer, Expiry: stored.Expiry}, nil
+		}
+	}
+	return Token{}, fmt.Errorf("snyk CLI config %s has no credentials: run `snyk auth`", path)
+}
+
+// TokenOptions selects where credentials come from. See ResolveTokenSource.
+type TokenOptions struct {
+	TokenFile         string
+	TokenEnv          string // name of an environment variable holding the token
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthTokenURL     string // default: <API base URL>/oauth2/token
+	CLIConfigPath     string // default: SnykCLIConfigPath()
+}
+
+// ResolveTokenSource picks a credential source, in order of precedence:
+//
+//  1. opts.TokenFile
+//  2. the environment variable named by opts.TokenEnv
+//  3. OAuth client credentials from opts or SNYK_OAUTH_CLIENT_ID/SNYK_OAUTH_CLIENT_SECRET
+//  4. SNYK_TOKEN / SNYK_API_TOKEN
+//  5. SNYK_OAUTH_TOKEN (a bearer token obtained elsewhere)
+//  6. the Snyk CLI's stored config
+//
+// httpClient is used for OAuth token requests and baseURL to derive the
+// default token endpoint.
+func ResolveTokenSource(opts TokenOptions, httpClient *http.Client, baseURL string) (TokenSource, error) {
+	if opts.TokenFile != "" {
+		return FileTokenSource(opts.TokenFile)
+	}
+	if opts.TokenEnv != "" {
+		t := strings.TrimSpace(os.Getenv(opts.TokenEnv))
+		if t == "" {
+			return nil, fmt.Errorf("token environment variable %s is not set", opts.TokenEnv)
+		}
+		return StaticTokenSource(t), nil
+	}
+
+	clientID := opts.OAuthClientID
+	if clientID == "" {
+		clientID = os.Getenv("SNYK_OAUTH_CLIENT_ID")
+	}
+	clientSecret := opts.OAuthClientSecret
+	if clientSecret == "" {
+		clientSecret = os.Getenv("SNYK_OAUTH_CLIENT_SECRET")
+	}
+	if clientID != "" || clientSecret != "" {
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("OAuth client credentials need both a client ID and a client secret")
+		}
+		tokenURL := opts.OAuthTokenURL
+		if tokenURL == "" {
+			tokenURL = baseURL + "/oauth2/token"
+		}
+		return OAuthClientCredentialsTokenSource(httpClient, tokenURL, clientID, clientSecret), nil
+	}
+
+	if t, err := GetSnykToken(); err == nil {
+		return StaticTokenSource(t), nil
+	}
+	if t := os.Getenv("SNYK_OAUTH_TOKEN"); t != "" {
+		return staticTokenSource{Value: t, Scheme: SchemeBearer}, nil
+	}
+
+	path := opts.CLIConfigPath
+	if path == "" {
+		path = SnykCLIConfigPath()
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			t, err := SnykCLIConfigToken(path)
+			if err != nil {
+				return nil, err
+			}
+			return staticTokenSource(t), nil
+		}
+	}
+	return nil, fmt.Errorf("no Snyk credentials found: set SNYK_TOKEN, use --tokenFile or OAuth client credentials, or run `snyk auth`")
+}
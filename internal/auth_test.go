@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("  abc123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := FileTokenSource(path)
+	if err != nil {
+		t.Fatalf("FileTokenSource: %v", err)
+	}
+	tok, err := src.Token(context.Background())
+	if err != nil || tok.Value != "abc123" || tok.Scheme != SchemeToken {
+		t.Fatalf("Token() = %+v, %v", tok, err)
+	}
+
+	// A rotated file is picked up.
+	if err := os.WriteFile(path, []byte("def456"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	if tok, _ := src.Token(context.Background()); tok.Value != "def456" {
+		t.Errorf("after rotation Token() = %q, want def456", tok.Value)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(empty, []byte("\n"), 0o600)
+	if _, err := FileTokenSource(empty); err == nil {
+		t.Error("empty token file: want error")
+	}
+}
+
+func TestSnykCLIConfigToken(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tok, err := SnykCLIConfigToken(write("api.json", `{"api":"cli-token"}`))
+	if err != nil || tok.Value != "cli-token" || tok.Scheme != SchemeToken {
+		t.Errorf("api key: got %+v, %v", tok, err)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	stored := fmt.Sprintf(`{"INTERNAL_OAUTH_TOKEN_STORAGE":"{\"access_token\":\"oauth-at\",\"expiry\":\"%s\"}"}`, future)
+	tok, err = SnykCLIConfigToken(write("oauth.json", stored))
+	if err != nil || tok.Value != "oauth-at" || tok.Scheme != SchemeBearer {
+		t.Errorf("oauth: got %+v, %v", tok, err)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	stored = fmt.Sprintf(`{"INTERNAL_OAUTH_TOKEN_STORAGE":"{\"access_token\":\"oauth-at\",\"expiry\":\"%s\"}"}`, past)
+	if _, err := SnykCLIConfigToken(write("expired.json", stored)); err == nil {
+		t.Error("expired oauth token: want error")
+	}
+
+	if _, err := SnykCLIConfigToken(write("none.json", `{"org":"x"}`)); err == nil {
+		t.Error("no credentials: want error")
+	}
+}
+
+func TestOAuthClientCredentialsTokenSource(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "id" || r.Form.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := calls.Add(1)
+		fmt.Fprintf(w, `{"access_token":"at-%d","expires_in":3600,"token_type":"bearer"}`, n)
+	}))
+	defer srv.Close()
+
+	src := OAuthClientCredentialsTokenSource(srv.Client(), srv.URL, "id", "secret")
+	tok, err := src.Token(context.Background())
+	if err != nil || tok.Value != "at-1" || tok.Scheme != SchemeBearer {
+		t.Fatalf("Token() = %+v, %v", tok, err)
+	}
+	if tok, _ := src.Token(context.Background()); tok.Value != "at-1" {
+		t.Errorf("cached Token() = %q, want at-1", tok.Value)
+	}
+	src.(invalidator).Invalidate()
+	if tok, _ := src.Token(context.Background()); tok.Value != "at-2" {
+		t.Errorf("after Invalidate Token() = %q, want at-2", tok.Value)
+	}
+
+	bad := OAuthClientCredentialsTokenSource(srv.Client(), srv.URL, "id", "wrong")
+	if _, err := bad.Token(context.Background()); err == nil {
+		t.Error("bad secret: want error")
+	}
+}
+
+func TestDoWithRetry_RefreshesTokenOn401(t *testing.T) {
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"fresh","expires_in":3600}`)
+	}))
+	defer tokenSrv.Close()
+
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		if len(seen) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	src := OAuthClientCredentialsTokenSource(tokenSrv.Client(), tokenSrv.URL, "id", "secret").(*oauthTokenSource)
+	src.token = Token{Value: "stale", Scheme: SchemeBearer}
+	c.Auth = src
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, _, err := DoWithRetry(context.Background(), c, req); err != nil {
+		t.Fatalf("DoWithRetry: %v", err)
+	}
+	want := []string{"bearer stale", "bearer fresh"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("Authorization headers = %q, want %q", seen, want)
+	}
+}
+
+func TestDoWithRetry_StaticToken401FailsFast(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "token abc" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	c.Auth = StaticTokenSource("abc")
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, _, err := DoWithRetry(context.Background(), c, req); err == nil {
+		t.Fatal("want 401 error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestResolveTokenSource(t *testing.T) {
+	for _, k := range []string{"SNYK_TOKEN", "SNYK_API_TOKEN", "SNYK_OAUTH_TOKEN", "SNYK_OAUTH_CLIENT_ID", "SNYK_OAUTH_CLIENT_SECRET"} {
+		t.Setenv(k, "")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	ctx := context.Background()
+
+	if _, err := ResolveTokenSource(TokenOptions{CLIConfigPath: missing}, http.DefaultClient, "https://api.snyk.io"); err == nil {
+		t.Error("no credentials: want error")
+	}
+
+	t.Setenv("SNYK_OAUTH_TOKEN", "ext-bearer")
+	src, err := ResolveTokenSource(TokenOptions{CLIConfigPath: missing}, http.DefaultClient, "https://api.snyk.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, _ := src.Token(ctx); tok.header() != "bearer ext-bearer" {
+		t.Errorf("SNYK_OAUTH_TOKEN: header %q", tok.header())
+	}
+
+	t.Setenv("SNYK_TOKEN", "env-token")
+	src, _ = ResolveTokenSource(TokenOptions{CLIConfigPath: missing}, http.DefaultClient, "https://api.snyk.io")
+	if tok, _ := src.Token(ctx); tok.header() != "token env-token" {
+		t.Errorf("SNYK_TOKEN beats SNYK_OAUTH_TOKEN: header %q", tok.header())
+	}
+
+	src, _ = ResolveTokenSource(TokenOptions{OAuthClientID: "id", OAuthClientSecret: "secret"}, http.DefaultClient, "https://api.snyk.io")
+	if o, ok := src.(*oauthTokenSource); !ok || o.tokenURL != "https://api.snyk.io/oauth2/token" {
+		t.Errorf("client credentials: got %T", src)
+	}
+	if _, err := ResolveTokenSource(TokenOptions{OAuthClientID: "id"}, http.DefaultClient, "https://api.snyk.io"); err == nil {
+		t.Error("client ID without secret: want error")
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("file-token"), 0o600)
+	src, _ = ResolveTokenSource(TokenOptions{TokenFile: path, OAuthClientID: "id", OAuthClientSecret: "secret"}, http.DefaultClient, "https://api.snyk.io")
+	if tok, _ := src.Token(ctx); tok.Value != "file-token" {
+		t.Errorf("token file beats everything: got %q", tok.Value)
+	}
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache stores successful GET responses on disk so repeated
+// read-only runs (refresh, then dedup dry-runs) don't refetch every page.
+// Entries are keyed by request URL (which includes the API host) and the
+// credential it was sent with, and grouped by org, so a delete in one org
+// drops only that org's entries. It is safe for concurrent use.
+type ResponseCache struct {
+	dir     string
+	ttl     time.Duration
+	refresh bool // ignore stored entries, but still store new ones
+	now     func() time.Time
+
+	// mu serialises stores with invalidations; gens counts the
+	// invalidations of each org, so a GET that was in flight when its org
+	// was invalidated does not store the stale response afterwards.
+	mu   sync.Mutex
+	gens map[string]uint64
+}
+
+// NewResponseCache returns a cache in dir whose entries expire after ttl.
+// With refresh set, stored entries are never read, so every response is
+// fetched again and rewritten.
+func NewResponseCache(dir string, ttl time.Duration, refresh bool) (*ResponseCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache TTL must be > 0, got %v", ttl)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	return &ResponseCache{dir: dir, ttl: ttl, refresh: refresh, now: time.Now, gens: make(map[string]uint64)}, nil
+}
+
+// cacheEntry is the on-disk form of a cached response.
+type cacheEntry struct {
+	URL         string    `json:"url"`
+	Stored      time.Time `json:"stored"`
+	StatusCode  int       `json:"statusCode"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        []byte    `json:"body"`
+}
+
+// globalCacheScope holds entries that don't belong to an org (orgs, groups, self).
+const globalCacheScope = "_global"
+
+// cacheScope returns the org ID a request path belongs to, or globalCacheScope.
+func cacheScope(path string) string {
+	if id := orgIDFromPath(path); id != "" {
+		return id
+	}
+	return globalCacheScope
+}
+
+// orgIDFromPath returns the org ID in an API path (/rest/orgs/{id}/...,
+// /v1/org/{id}/...), or "" if the path is not org-scoped.
+func orgIDFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "orgs" || parts[i] == "org" {
+			if id := parts[i+1]; id != "" && id != "." && id != ".." {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// credentialKey identifies the credential ts sends, so responses fetched
+// with one token are never served to another. OAuth clients are identified
+// by client ID, as their access tokens rotate; other sources by their
+// current token.
+func credentialKey(ctx context.Context, ts TokenSource) (string, error) {
+	switch s := ts.(type) {
+	case nil:
+		return "", nil
+	case *oauthTokenSource:
+		return "oauth:" + s.tokenURL + "\x00" + s.clientID, nil
+	}
+	tok, err := ts.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return tok.Scheme + ":" + tok.Value, nil
+}
+
+// path returns the file an entry for u, fetched with the credential cred
+// (see credentialKey), is stored in.
+func (c *ResponseCache) path(u *url.URL, cred string) string {
+	sum := sha256.Sum256([]byte(cred + "\x00" + u.String()))
+	return filepath.Join(c.dir, cacheScope(u.Path), hex.EncodeToString(sum[:])+".json")
+}
+
+// generation returns the number of times the org req belongs to has been
+// invalidated. Take it before sending req and pass it to put.
+func (c *ResponseCache) generation(req *http.Request) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[cacheScope(req.URL.Path)]
+}
+
+// get returns a fresh cached response for req, fetched with cred, if any.
+func (c *ResponseCache) get(req *http.Request, cred string) (*http.Response, []byte, bool) {
+	if c.refresh || req.Method != http.MethodGet {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(c.path(req.URL, cred))
+	if err != nil {
+		return nil, nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != req.URL.String() {
+		return nil, nil, false
+	}
+	if c.now().Sub(e.Stored) > c.ttl {
+		return nil, nil, false
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode: e.StatusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(e.Body)),
+		Request:    req,
+	}
+	if e.ContentType != "" {
+		resp.Header.Set("Content-Type", e.ContentType)
+	}
+	return resp, e.Body, true
+}
+
+// put stores a successful GET response fetched with cred, unless its org
+// was invalidated since gen was taken. Write failures are logged and
+// otherwise ignored: the cache is only an optimisation.
+func (c *ResponseCache) put(req *http.Request, cred string, gen uint64, resp *http.Response, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[cacheScope(req.URL.Path)] != gen {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{
+		URL:         req.URL.String(),
+		Stored:      c.now(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+	})
+	if err == nil {
+		err = writeFileAtomic(c.path(req.URL, cred), data)
+	}
+	if err != nil {
+		slog.Warn("response cache write failed", "error", err)
+	}
+}
+
+// InvalidateOrg drops every cached response for an org, whatever
+// credential fetched it, and discards responses still in flight.
+func (c *ResponseCache) InvalidateOrg(orgID string) error {
+	scope := cacheScope("/orgs/" + orgID)
+	if scope == globalCacheScope {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[scope]++
+	if err := os.RemoveAll(filepath.Join(c.dir, scope)); err != nil {
+		return fmt.Errorf("invalidate cache for org %s: %w", orgID, err)
+	}
+	return nil
+}
+
+// afterWrite invalidates the org a successful non-GET request modified.
+func (c *ResponseCache) afterWrite(req *http.Request) {
+	if req.Method == http.MethodGet {
+		return
+	}
+	if scope := cacheScope(req.URL.Path); scope != globalCacheScope {
+		if err := c.InvalidateOrg(scope); err != nil {
+			slog.Warn("response cache invalidation failed", "org_id", scope, "error", err)
+		}
+	}
+}
+
+// writeFileAtomic writes data to path via a temporary file in the same
+// directory, so concurrent readers never see a partial entry.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheScope(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/rest/orgs/org-1/projects", "org-1"},
+		{"/rest/orgs/org-1/projects/p1", "org-1"},
+		{"/v1/org/org-2/integrations", "org-2"},
+		{"/rest/orgs", globalCacheScope},
+		{"/rest/groups", globalCacheScope},
+		{"/rest/orgs/../x", globalCacheScope},
+	}
+	for _, tt := range tests {
+		if got := cacheScope(tt.path); got != tt.want {
+			t.Errorf("cacheScope(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// cachedServer counts GETs and accepts DELETEs.
+func cachedServer(t *testing.T, gets *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		gets.Add(1)
+		w.Write([]byte(`{"data":[{"id":"p1"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func cachedGet(t *testing.T, c *Client, path string) []byte {
+	t.Helper()
+	req, _ := http.NewRequest("GET", c.BaseURL+path, nil)
+	resp, body, err := DoWithRetry(context.Background(), c, req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return body
+}
+
+func TestResponseCache_ServesFreshEntries(t *testing.T) {
+	var gets atomic.Int32
+	c := newTestClient(cachedServer(t, &gets))
+	cache, err := NewResponseCache(t.TempDir(), time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Cache = cache
+
+	first := cachedGet(t, c, "/rest/orgs/org-1/projects?limit=100")
+	second := cachedGet(t, c, "/rest/orgs/org-1/projects?limit=100")
+	if gets.Load() != 1 || string(first) != string(second) {
+		t.Errorf("gets = %d, bodies %q / %q", gets.Load(), first, second)
+	}
+	cachedGet(t, c, "/rest/orgs/org-1/projects?limit=50")
+	if gets.Load() != 2 {
+		t.Errorf("different query should miss the cache, gets = %d", gets.Load())
+	}
+
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	cachedGet(t, c, "/rest/orgs/org-1/projects?limit=100")
+	if gets.Load() != 3 {
+		t.Errorf("expired entry should be refetched, gets = %d", gets.Load())
+	}
+}
+
+func TestResponseCache_Refresh(t *testing.T) {
+	var gets atomic.Int32
+	c := newTestClient(cachedServer(t, &gets))
+	dir := t.TempDir()
+	c.Cache, _ = NewResponseCache(dir, time.Hour, false)
+	cachedGet(t, c, "/rest/orgs/org-1/projects")
+
+	c.Cache, _ = NewResponseCache(dir, time.Hour, true)
+	cachedGet(t, c, "/rest/orgs/org-1/projects")
+	if gets.Load() != 2 {
+		t.Errorf("refresh should bypass stored entries, gets = %d", gets.Load())
+	}
+}
+
+func TestResponseCache_DeleteInvalidatesOrg(t *testing.T) {
+	var gets atomic.Int32
+	c := newTestClient(cachedServer(t, &gets))
+	c.Cache, _ = NewResponseCache(t.TempDir(), time.Hour, false)
+	cachedGet(t, c, "/rest/orgs/org-1/projects")
+	cachedGet(t, c, "/rest/orgs/org-2/projects")
+
+	if err := DeleteProject(context.Background(), c, "org-1", "p1"); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	cachedGet(t, c, "/rest/orgs/org-1/projects")
+	cachedGet(t, c, "/rest/orgs/org-2/projects")
+	if gets.Load() != 3 {
+		t.Errorf("only org-1 should be refetched after the delete, gets = %d", gets.Load())
+	}
+}
+
+func TestResponseCache_SeparatesCredentials(t *testing.T) {
+	var gets atomic.Int32
+	srv := cachedServer(t, &gets)
+	cache, _ := NewResponseCache(t.TempDir(), time.Hour, false)
+	a, b := newTestClient(srv), newTestClient(srv)
+	a.Auth, b.Auth = StaticTokenSource("token-a"), StaticTokenSource("token-b")
+	a.Cache, b.Cache = cache, cache
+
+	cachedGet(t, a, "/rest/orgs/org-1/projects")
+	cachedGet(t, b, "/rest/orgs/org-1/projects")
+	if gets.Load() != 2 {
+		t.Errorf("a different token should miss the cache, gets = %d", gets.Load())
+	}
+	cachedGet(t, a, "/rest/orgs/org-1/projects")
+	if gets.Load() != 2 {
+		t.Errorf("the same token should hit the cache, gets = %d", gets.Load())
+	}
+}
+
+func TestResponseCache_SkipsStoreStartedBeforeInvalidation(t *testing.T) {
+	cache, _ := NewResponseCache(t.TempDir(), time.Hour, false)
+	req, _ := http.NewRequest("GET", "https://api.snyk.io/rest/orgs/org-1/projects", nil)
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+
+	gen := cache.generation(req)
+	if err := cache.InvalidateOrg("org-1"); err != nil {
+		t.Fatal(err)
+	}
+	cache.put(req, "", gen, resp, []byte(`{"data":[]}`))
+	if _, _, ok := cache.get(req, ""); ok {
+		t.Error("a response fetched before the invalidation was stored")
+	}
+
+	cache.put(req, "", cache.generation(req), resp, []byte(`{"data":[]}`))
+	if _, _, ok := cache.get(req, ""); !ok {
+		t.Error("a response fetched after the invalidation was not stored")
+	}
+}
+
+func TestNewResponseCache_InvalidTTL(t *testing.T) {
+	if _, err := NewResponseCache(t.TempDir(), 0, false); err == nil {
+		t.Error("want error for zero TTL")
+	}
+}
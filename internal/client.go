@@ -5,10 +5,14 @@ package internal
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -38,11 +42,84 @@ func GetSnykToken() (string, error) {
 	return "", fmt.Errorf("SNYK_TOKEN or SNYK_API_TOKEN environment variable not set")
 }
 
-// NewHTTPClient returns an *http.Client with sensible defaults.
-func NewHTTPClient() *http.Client {
-	return &http.Client{
-		Timeout: 30 * time.Second,
+// HTTPOptions configures the transport used to reach the Snyk API.
+type HTTPOptions struct {
+	Timeout time.Duration // per-request timeout, including reading the body
+	// ProxyURL is an explicit HTTP(S) proxy. When empty, the standard
+	// HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables apply.
+	ProxyURL string
+	// CABundle is a PEM file of extra CA certificates trusted in addition to
+	// the system pool (e.g. for a TLS-intercepting corporate proxy).
+	CABundle string
+	// ClientCert and ClientKey are PEM files for mutual TLS. Both or neither.
+	ClientCert string
+	ClientKey  string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // 0 = unlimited
+	IdleConnTimeout     time.Duration
+}
+
+// DefaultHTTPOptions returns the default transport settings.
+func DefaultHTTPOptions() HTTPOptions {
+	return HTTPOptions{
+		Timeout:             30 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// NewHTTPClient returns an *http.Client configured from opts.
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.MaxIdleConns
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+
+	if opts.ProxyURL != "" {
+		proxy, err := url.Parse(opts.ProxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.CABundle != "" || opts.ClientCert != "" || opts.ClientKey != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.CABundle != "" {
+			pem, err := os.ReadFile(opts.CABundle)
+			if err != nil {
+				return nil, fmt.Errorf("read CA bundle: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", opts.CABundle)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if opts.ClientCert != "" || opts.ClientKey != "" {
+			if opts.ClientCert == "" || opts.ClientKey == "" {
+				return nil, fmt.Errorf("client certificate and key must be given together")
+			}
+			cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
 	}
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}, nil
 }
 
 // RetryConfig holds retry configuration.
@@ -51,6 +128,13 @@ type RetryConfig struct {
 	InitialBackoff time.Duration
 	MaxBackoff     time.Duration
 	BackoffFactor  float64
+	// Jitter enables "full jitter": each wait is a random duration between
+	// zero and the exponential backoff, so concurrent workers don't retry
+	// in lockstep.
+	Jitter bool
+	// MaxElapsed caps the total time spent retrying one request, including
+	// waits. Zero means no cap beyond MaxRetries.
+	MaxElapsed time.Duration
 }
 
 // DefaultRetryConfig returns sensible defaults for Snyk API.
@@ -60,7 +144,25 @@ func DefaultRetryConfig() RetryConfig {
 		InitialBackoff: 1 * time.Second,
 		MaxBackoff:     30 * time.Second,
 		BackoffFactor:  2.0,
+		Jitter:         true,
+	}
+}
+
+// Validate reports configuration values that would make retries misbehave.
+func (cfg RetryConfig) Validate() error {
+	switch {
+	case cfg.MaxRetries < 0:
+		return fmt.Errorf("max retries must be >= 0, got %d", cfg.MaxRetries)
+	case cfg.InitialBackoff <= 0:
+		return fmt.Errorf("initial backoff must be > 0, got %v", cfg.InitialBackoff)
+	case cfg.MaxBackoff < cfg.InitialBackoff:
+		return fmt.Errorf("max backoff (%v) must be >= initial backoff (%v)", cfg.MaxBackoff, cfg.InitialBackoff)
+	case cfg.BackoffFactor < 1:
+		return fmt.Errorf("backoff factor must be >= 1, got %v", cfg.BackoffFactor)
+	case cfg.MaxElapsed < 0:
+		return fmt.Errorf("max elapsed retry time must be >= 0, got %v", cfg.MaxElapsed)
 	}
+	return nil
 }
 
 // isRetryableStatus returns true if the HTTP status code is retryable.
@@ -73,18 +175,30 @@ func isRetryableStatus(code int) bool {
 	}
 }
 
-// getRetryAfter extracts the Retry-After header value in seconds.
+// timeNow is the clock used for Retry-After dates; replaced in tests.
+var timeNow = time.Now
+
+// getRetryAfter extracts the Retry-After header value, given either as
+// delay seconds or as an HTTP date. Dates in the past yield 0.
 func getRetryAfter(resp *http.Response) time.Duration {
 	if resp == nil {
 		return 0
 	}
-	ra := resp.Header.Get("Retry-After")
+	ra := strings.TrimSpace(resp.Header.Get("Retry-After"))
 	if ra == "" {
 		return 0
 	}
 	if secs, err := strconv.Atoi(ra); err == nil {
+		if secs < 0 {
+			return 0
+		}
 		return time.Duration(secs) * time.Second
 	}
+	if t, err := http.ParseTime(ra); err == nil {
+		if d := t.Sub(timeNow()); d > 0 {
+			return d
+		}
+	}
 	return 0
 }
 
@@ -100,37 +214,140 @@ func calculateBackoff(attempt int, cfg RetryConfig) time.Duration {
 	return time.Duration(backoff)
 }
 
-// rateLimiter is a simple token-bucket rate limiter using a time.Ticker.
-// It ensures at most ~requestsPerSecond sustained throughput.
-type rateLimiter struct {
-	ticker *time.Ticker
-}
-
-var globalLimiter *rateLimiter
-
-func initRateLimiter() {
-	if globalLimiter == nil {
-		// ~2 requests per second (500ms between requests)
-		globalLimiter = &rateLimiter{
-			ticker: time.NewTicker(500 * time.Millisecond),
-		}
+// retryBackoff returns the wait before retrying after the given attempt,
+// applying full jitter when enabled.
+func retryBackoff(attempt int, cfg RetryConfig) time.Duration {
+	d := calculateBackoff(attempt, cfg)
+	if cfg.Jitter && d > 0 {
+		d = time.Duration(rand.Int64N(int64(d) + 1))
 	}
+	return d
 }
 
-func (rl *rateLimiter) wait(ctx context.Context) error {
+// sleepCtx waits for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
 	select {
-	case <-rl.ticker.C:
+	case <-t.C:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
 
+// Client bundles the HTTP client, API base URL, credentials and rate limiter
+// used for Snyk API calls. Each Client has its own limiter, so independent
+// clients (e.g. in tests) don't throttle each other.
+type Client struct {
+	HTTP    *http.Client
+	BaseURL string
+	Auth    TokenSource // sets the Authorization header; nil sends none
+	Limiter *RateLimiter
+	Retry   RetryConfig
+	Cache   *ResponseCache // optional; serves and stores GET responses
+	// OnRequest, if set, is called after every attempt that reaches the
+	// network, including ones that are retried. It must be safe for
+	// concurrent use.
+	OnRequest func(ctx context.Context, info RequestInfo)
+}
+
+// RequestInfo describes one attempt of an API request, for OnRequest.
+type RequestInfo struct {
+	Method   string
+	Path     string
+	OrgID    string // "" if the path is not org-scoped
+	Attempt  int    // 1 for the first attempt
+	Status   int    // 0 if no response was received
+	Start    time.Time
+	Duration time.Duration
+	Err      error // transport or body read error
+}
+
+// NewClient returns a Client for the base URL from GetSnykAPIBaseURL with
+// DefaultRetryConfig. A nil limiter gets the default rate (DefaultRPS, DefaultBurst).
+func NewClient(httpClient *http.Client, limiter *RateLimiter) *Client {
+	if limiter == nil {
+		limiter = NewRateLimiter(DefaultRPS, DefaultBurst)
+	}
+	return &Client{
+		HTTP:    httpClient,
+		BaseURL: GetSnykAPIBaseURL(),
+		Limiter: limiter,
+		Retry:   DefaultRetryConfig(),
+	}
+}
+
 // DoWithRetry performs an HTTP request with rate limiting and automatic retries.
-// It handles 429 (rate limit) and 5xx (server error) responses with exponential backoff.
-func DoWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, []byte, error) {
-	initRateLimiter()
-	cfg := DefaultRetryConfig()
+// It handles 429 (rate limit) and 5xx (server error) responses with exponential
+// backoff (honouring Retry-After), following c.Retry. All waits end early if
+// ctx is cancelled. The Authorization header is set from c.Auth on every
+// attempt; a 401 is retried once with a fresh token if c.Auth can refresh.
+// With c.Cache set, fresh GET responses cached for the same credential are
+// returned without a request, and a successful write (e.g. a DELETE)
+// invalidates its org.
+func DoWithRetry(ctx context.Context, c *Client, req *http.Request) (*http.Response, []byte, error) {
+	if c.Cache == nil {
+		return doWithRetry(ctx, c, req)
+	}
+	cred, err := credentialKey(ctx, c.Auth)
+	if err != nil {
+		// doWithRetry reports the credential error.
+		return doWithRetry(ctx, c, req)
+	}
+	if resp, body, ok := c.Cache.get(req, cred); ok {
+		return resp, body, nil
+	}
+	gen := c.Cache.generation(req)
+	resp, body, err := doWithRetry(ctx, c, req)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if req.Method == http.MethodGet {
+			c.Cache.put(req, cred, gen, resp, body)
+		} else {
+			c.Cache.afterWrite(req)
+		}
+	}
+	return resp, body, err
+}
+
+// requestAttrs returns the standard log attributes for one attempt of req.
+func requestAttrs(req *http.Request, attempt int, cfg RetryConfig) slog.Attr {
+	attrs := []any{
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.Int("attempt", attempt+1),
+		slog.Int("max_attempts", cfg.MaxRetries+1),
+	}
+	if orgID := orgIDFromPath(req.URL.Path); orgID != "" {
+		attrs = append(attrs, slog.String("org_id", orgID))
+	}
+	return slog.Group("", attrs...)
+}
+
+// observe reports one attempt of req to c.OnRequest.
+func (c *Client) observe(ctx context.Context, req *http.Request, attempt int, start time.Time, status int, err error) {
+	if c.OnRequest == nil {
+		return
+	}
+	c.OnRequest(ctx, RequestInfo{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		OrgID:    orgIDFromPath(req.URL.Path),
+		Attempt:  attempt + 1,
+		Status:   status,
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// doWithRetry implements DoWithRetry without the cache.
+func doWithRetry(ctx context.Context, c *Client, req *http.Request) (*http.Response, []byte, error) {
+	cfg := c.Retry
+	start := time.Now()
 
 	// Store original body for retries
 	var bodyBytes []byte
@@ -146,6 +363,7 @@ func DoWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*
 	var lastErr error
 	var lastResp *http.Response
 	var lastBody []byte
+	reauthed := false
 
 	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
 		if ctx.Err() != nil {
@@ -153,7 +371,7 @@ func DoWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*
 		}
 
 		// Rate limit
-		if err := globalLimiter.wait(ctx); err != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
 			return nil, nil, fmt.Errorf("rate limiter: %w", err)
 		}
 
@@ -165,75 +383,101 @@ func DoWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*
 		for k, v := range req.Header {
 			reqClone.Header[k] = v
 		}
+		if c.Auth != nil {
+			tok, err := c.Auth.Token(ctx)
+			if err != nil {
+				return nil, nil, fmt.Errorf("get token: %w", err)
+			}
+			reqClone.Header.Set("Authorization", tok.header())
+		}
 		if bodyBytes != nil {
 			reqClone.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 			reqClone.ContentLength = int64(len(bodyBytes))
 		}
 
-		resp, err := client.Do(reqClone)
+		var wait time.Duration
+		attemptStart := time.Now()
+		resp, err := c.HTTP.Do(reqClone)
 		if err != nil {
-			lastErr = err
-			log.Printf("[DEBUG] Request failed (attempt %d/%d): %v", attempt+1, cfg.MaxRetries+1, err)
-			if attempt < cfg.MaxRetries {
-				time.Sleep(calculateBackoff(attempt, cfg))
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
 			}
-			continue
-		}
+			lastErr = err
+			wait = retryBackoff(attempt, cfg)
+			slog.Debug("request failed", requestAttrs(req, attempt, cfg), "error", err)
+			c.observe(ctx, req, attempt, attemptStart, 0, err)
+		} else {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			c.observe(ctx, req, attempt, attemptStart, resp.StatusCode, err)
+			if err != nil {
+				lastErr = fmt.Errorf("read response: %w", err)
+				wait = retryBackoff(attempt, cfg)
+			} else {
+				lastErr = nil
+				lastResp = resp
+				lastBody = body
+				c.Limiter.Observe(resp.Header)
+				slog.Debug("api response", requestAttrs(req, attempt, cfg), "status", resp.StatusCode,
+					"request_id", resp.Header.Get("snyk-request-id"), "duration", time.Since(attemptStart))
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			lastErr = fmt.Errorf("read response: %w", err)
-			if attempt < cfg.MaxRetries {
-				time.Sleep(calculateBackoff(attempt, cfg))
-			}
-			continue
-		}
+				switch {
+				case resp.StatusCode >= 200 && resp.StatusCode < 300:
+					return resp, body, nil
 
-		lastResp = resp
-		lastBody = body
+				case resp.StatusCode == 401:
+					// Retry once with a fresh token if the source can refresh
+					// (e.g. an OAuth token revoked early), otherwise fail fast.
+					if inv, ok := c.Auth.(invalidator); ok && !reauthed {
+						reauthed = true
+						inv.Invalidate()
+						slog.Info("authentication failed (401), retrying with a new token", requestAttrs(req, attempt, cfg))
+						attempt--
+						continue
+					}
+					return resp, body, fmt.Errorf("authentication failed: %w", newAPIError(resp, body))
 
-		// 2xx success
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			return resp, body, nil
-		}
+				case resp.StatusCode == 429:
+					wait = getRetryAfter(resp)
+					if wait == 0 {
+						wait = retryBackoff(attempt, cfg)
+					}
+					slog.Info("rate limited (429)", requestAttrs(req, attempt, cfg), "wait", wait,
+						"request_id", resp.Header.Get("snyk-request-id"), "limiter", c.Limiter.State())
 
-		// 401 -- not retryable, fail fast
-		if resp.StatusCode == 401 {
-			return resp, body, fmt.Errorf("authentication failed (401): check your SNYK_TOKEN")
-		}
+				case isRetryableStatus(resp.StatusCode):
+					wait = getRetryAfter(resp)
+					if wait == 0 {
+						wait = retryBackoff(attempt, cfg)
+					}
+					slog.Info("server error, retrying", requestAttrs(req, attempt, cfg), "status", resp.StatusCode, "wait", wait,
+						"request_id", resp.Header.Get("snyk-request-id"))
 
-		// 429 rate limit
-		if resp.StatusCode == 429 {
-			retryAfter := getRetryAfter(resp)
-			if retryAfter == 0 {
-				retryAfter = calculateBackoff(attempt, cfg)
+				default:
+					// Non-retryable error -- return as-is for caller to handle
+					return resp, body, nil
+				}
 			}
-			log.Printf("[INFO] Rate limited (429), waiting %v (attempt %d/%d)", retryAfter, attempt+1, cfg.MaxRetries+1)
-			if attempt < cfg.MaxRetries {
-				time.Sleep(retryAfter)
-			}
-			continue
 		}
 
-		// Retryable server errors
-		if isRetryableStatus(resp.StatusCode) {
-			log.Printf("[INFO] Server error (%d), retrying (attempt %d/%d)", resp.StatusCode, attempt+1, cfg.MaxRetries+1)
-			if attempt < cfg.MaxRetries {
-				time.Sleep(calculateBackoff(attempt, cfg))
-			}
-			continue
+		if attempt == cfg.MaxRetries {
+			break
+		}
+		if cfg.MaxElapsed > 0 && time.Since(start)+wait > cfg.MaxElapsed {
+			slog.Info("giving up: next retry would exceed the retry budget", requestAttrs(req, attempt, cfg),
+				"elapsed", time.Since(start).Round(time.Millisecond), "budget", cfg.MaxElapsed)
+			break
+		}
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, nil, err
 		}
-
-		// Non-retryable error -- return as-is for caller to handle
-		return resp, body, nil
 	}
 
 	if lastErr != nil {
 		return lastResp, lastBody, fmt.Errorf("max retries exceeded: %w", lastErr)
 	}
 	if lastResp != nil {
-		return lastResp, lastBody, fmt.Errorf("max retries exceeded: status %d", lastResp.StatusCode)
+		return lastResp, lastBody, fmt.Errorf("max retries exceeded: %w", newAPIError(lastResp, lastBody))
 	}
 	return nil, nil, fmt.Errorf("max retries exceeded")
 }
@@ -1,8 +1,16 @@
 package internal
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -41,10 +49,164 @@ func TestGetRetryAfter(t *testing.T) {
 		t.Errorf("getRetryAfter(5) = %v, want 5s", d)
 	}
 
-	// Non-integer header (e.g. HTTP date) returns 0
+	// HTTP date in the past returns 0
+	saveNow := timeNow
+	defer func() { timeNow = saveNow }()
+	timeNow = func() time.Time { return time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC) }
 	resp.Header.Set("Retry-After", "Thu, 01 Jan 2026 00:00:00 GMT")
 	if d := getRetryAfter(resp); d != 0 {
-		t.Errorf("getRetryAfter(date) = %v, want 0", d)
+		t.Errorf("getRetryAfter(past date) = %v, want 0", d)
+	}
+
+	// HTTP date in the future returns the remaining time
+	resp.Header.Set("Retry-After", "Mon, 01 Jun 2026 00:00:42 GMT")
+	if d := getRetryAfter(resp); d != 42*time.Second {
+		t.Errorf("getRetryAfter(future date) = %v, want 42s", d)
+	}
+
+	// Garbage returns 0
+	resp.Header.Set("Retry-After", "soon")
+	if d := getRetryAfter(resp); d != 0 {
+		t.Errorf("getRetryAfter(garbage) = %v, want 0", d)
+	}
+}
+
+func TestRetryBackoff_Jitter(t *testing.T) {
+	cfg := RetryConfig{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second, BackoffFactor: 2.0}
+	if d := retryBackoff(2, cfg); d != 4*time.Second {
+		t.Errorf("without jitter: got %v, want 4s", d)
+	}
+	cfg.Jitter = true
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		d := retryBackoff(2, cfg)
+		if d < 0 || d > 4*time.Second {
+			t.Fatalf("jittered backoff %v outside [0, 4s]", d)
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("jittered backoff returned the same value every time")
+	}
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	if err := DefaultRetryConfig().Validate(); err != nil {
+		t.Errorf("default config: %v", err)
+	}
+	bad := []RetryConfig{
+		{MaxRetries: -1, InitialBackoff: time.Second, MaxBackoff: time.Second, BackoffFactor: 2},
+		{MaxRetries: 1, InitialBackoff: 0, MaxBackoff: time.Second, BackoffFactor: 2},
+		{MaxRetries: 1, InitialBackoff: time.Second, MaxBackoff: time.Millisecond, BackoffFactor: 2},
+		{MaxRetries: 1, InitialBackoff: time.Second, MaxBackoff: time.Second, BackoffFactor: 0.5},
+		{MaxRetries: 1, InitialBackoff: time.Second, MaxBackoff: time.Second, BackoffFactor: 2, MaxElapsed: -time.Second},
+	}
+	for _, cfg := range bad {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v): want error", cfg)
+		}
+	}
+}
+
+// newTestClient returns a Client for srv with no rate limit and millisecond backoffs.
+func newTestClient(srv *httptest.Server) *Client {
+	c := NewClient(srv.Client(), NewRateLimiter(0, 1))
+	c.BaseURL = srv.URL
+	c.Retry = RetryConfig{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, BackoffFactor: 2}
+	return c
+}
+
+func TestDoWithRetry_RetriesThenSucceeds(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, body, err := DoWithRetry(context.Background(), c, req)
+	if err != nil {
+		t.Fatalf("DoWithRetry: %v", err)
+	}
+	if resp.StatusCode != 200 || string(body) != "ok" || calls.Load() != 3 {
+		t.Errorf("status=%d body=%q calls=%d", resp.StatusCode, body, calls.Load())
+	}
+}
+
+func TestDoWithRetry_OnRequest(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+	var infos []RequestInfo
+	c.OnRequest = func(ctx context.Context, info RequestInfo) { infos = append(infos, info) }
+
+	req, _ := http.NewRequest("GET", srv.URL+"/rest/orgs/org-1/projects", nil)
+	if _, _, err := DoWithRetry(context.Background(), c, req); err != nil {
+		t.Fatalf("DoWithRetry: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("OnRequest calls = %d, want 2", len(infos))
+	}
+	first, second := infos[0], infos[1]
+	if first.Status != 429 || first.Attempt != 1 || first.OrgID != "org-1" || first.Path != "/rest/orgs/org-1/projects" || first.Method != "GET" {
+		t.Errorf("first attempt = %+v", first)
+	}
+	if second.Status != 200 || second.Attempt != 2 || second.Start.IsZero() {
+		t.Errorf("second attempt = %+v", second)
+	}
+}
+
+func TestDoWithRetry_MaxElapsed(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+	c.Retry.MaxElapsed = time.Second
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	if _, _, err := DoWithRetry(context.Background(), c, req); err == nil {
+		t.Fatal("want error when the retry budget is exhausted")
+	}
+	if calls.Load() != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("calls=%d elapsed=%v: should give up instead of waiting 60s", calls.Load(), time.Since(start))
+	}
+}
+
+func TestDoWithRetry_ContextCancelledDuringWait(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	_, _, err := DoWithRetry(ctx, c, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("DoWithRetry ignored cancellation (took %v)", time.Since(start))
 	}
 }
 
@@ -153,3 +315,118 @@ func TestGetSnykToken(t *testing.T) {
 		t.Errorf("got %q, %v", tok, err)
 	}
 }
+
+// writePEM writes a PEM block of the given type to a temp file and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewHTTPClient_Defaults(t *testing.T) {
+	c, err := NewHTTPClient(DefaultHTTPOptions())
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	if c.Timeout != 30*time.Second {
+		t.Errorf("Timeout = %v, want 30s", c.Timeout)
+	}
+	tr := c.Transport.(*http.Transport)
+	if tr.Proxy == nil {
+		t.Error("default transport should use proxy settings from the environment")
+	}
+	if tr.TLSClientConfig != nil && tr.TLSClientConfig.RootCAs != nil {
+		t.Error("default transport should use the system CA pool")
+	}
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	opts := DefaultHTTPOptions()
+	opts.ProxyURL = "http://proxy.internal:3128"
+	c, err := NewHTTPClient(opts)
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://api.snyk.io/rest/self", nil)
+	u, err := c.Transport.(*http.Transport).Proxy(req)
+	if err != nil || u == nil || u.Host != "proxy.internal:3128" {
+		t.Errorf("proxy for request = %v, %v", u, err)
+	}
+
+	opts.ProxyURL = "::not a url"
+	if _, err := NewHTTPClient(opts); err == nil {
+		t.Error("invalid proxy URL: want error")
+	}
+}
+
+func TestNewHTTPClient_CABundleAndClientCert(t *testing.T) {
+	var sawClientCert atomic.Bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawClientCert.Store(r.TLS != nil && len(r.TLS.PeerCertificates) > 0)
+		w.Write([]byte("ok"))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(srv.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePEM(t, dir, "key.pem", "PRIVATE KEY", keyDER)
+
+	// Without the CA bundle the server's self-signed cert is rejected
+	plain, err := NewHTTPClient(DefaultHTTPOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(srv.URL); err == nil {
+		t.Error("request without CA bundle should fail TLS verification")
+	}
+
+	opts := DefaultHTTPOptions()
+	opts.CABundle = caFile
+	opts.ClientCert = caFile
+	opts.ClientKey = keyFile
+	c, err := NewHTTPClient(opts)
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle: %v", err)
+	}
+	resp.Body.Close()
+	if !sawClientCert.Load() {
+		t.Error("server did not receive the client certificate")
+	}
+}
+
+func TestNewHTTPClient_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts func(*HTTPOptions)
+	}{
+		{"missing CA bundle", func(o *HTTPOptions) { o.CABundle = filepath.Join(dir, "missing.pem") }},
+		{"CA bundle without certificates", func(o *HTTPOptions) { o.CABundle = notPEM }},
+		{"cert without key", func(o *HTTPOptions) { o.ClientCert = notPEM }},
+		{"invalid key pair", func(o *HTTPOptions) { o.ClientCert = notPEM; o.ClientKey = notPEM }},
+	}
+	for _, tt := range tests {
+		opts := DefaultHTTPOptions()
+		tt.opts(&opts)
+		if _, err := NewHTTPClient(opts); err == nil {
+			t.Errorf("%s: want error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is a parsed configuration file. The format is a subset of TOML:
+// tables ([a.b]), bare, quoted and dotted keys, and string, integer, float,
+// boolean, date and array values. Inline tables, arrays of tables and
+// multi-line strings are not supported.
+//
+// Settings are flag names. Keys at the top level and in [profile.<name>]
+// apply to every subcommand that has the flag; keys in [<command>] and
+// [profile.<name>.<command>] apply to that subcommand only. The top-level
+// key "defaultProfile" names the profile used when none is given.
+type Config struct {
+	root map[string]any // tables are map[string]any
+}
+
+// Setting is a flag value from a Config.
+type Setting struct {
+	Flag    string
+	Values  []string // one per array element; a single value otherwise
+	Source  string   // table it came from, e.g. "[profile.eu-prod.refresh]"
+	Command bool     // from a subcommand table, so the flag must exist
+}
+
+// LoadConfig reads and parses the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := ParseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Profiles returns the names of the profiles defined in c, sorted.
+func (c *Config) Profiles() []string {
+	profiles, _ := c.root["profile"].(map[string]any)
+	var names []string
+	for name, v := range profiles {
+		if _, ok := v.(map[string]any); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultProfile returns the top-level "defaultProfile" setting, if any.
+func (c *Config) DefaultProfile() string {
+	s, _ := c.root["defaultProfile"].(string)
+	return s
+}
+
+// Settings returns the settings for command with the given profile ("" for
+// none), in increasing precedence: top level, [command], [profile.<name>],
+// [profile.<name>.<command>]. commands lists every subcommand, so their
+// tables are not mistaken for settings.
+func (c *Config) Settings(profile, command string, commands []string) ([]Setting, error) {
+	isCommand := make(map[string]bool)
+	for _, cmd := range commands {
+		isCommand[cmd] = true
+	}
+	var out []Setting
+	add := func(table map[string]any, source string, commandOnly bool) error {
+		keys := make([]string, 0, len(table))
+		for k := range table {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := table[k]
+			if _, ok := v.(map[string]any); ok {
+				if commandOnly || isCommand[k] || (source == "" && k == "profile") {
+					if commandOnly {
+						return fmt.Errorf("%s: unexpected table %q", source, k)
+					}
+					continue
+				}
+				return fmt.Errorf("unknown table [%s]", strings.TrimPrefix(strings.Trim(source, "[]")+"."+k, "."))
+			}
+			if source == "" && k == "defaultProfile" {
+				continue
+			}
+			values, err := configValues(v)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", sourceName(source), k, err)
+			}
+			out = append(out, Setting{Flag: k, Values: values, Source: sourceName(source), Command: commandOnly})
+		}
+		return nil
+	}
+
+	if err := add(c.root, "", false); err != nil {
+		return nil, err
+	}
+	if t, ok := c.root[command].(map[string]any); ok {
+		if err := add(t, "["+command+"]", true); err != nil {
+			return nil, err
+		}
+	}
+	if profile == "" {
+		return out, nil
+	}
+	profiles, _ := c.root["profile"].(map[string]any)
+	p, ok := profiles[profile].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (defined: %s)", profile, strings.Join(c.Profiles(), ", "))
+	}
+	if err := add(p, "[profile."+profile+"]", false); err != nil {
+		return nil, err
+	}
+	if t, ok := p[command].(map[string]any); ok {
+		if err := add(t, "[profile."+profile+"."+command+"]", true); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func sourceName(source string) string {
+	if source == "" {
+		return "top level"
+	}
+	return source
+}
+
+// configValues converts a parsed value to flag values.
+func configValues(v any) ([]string, error) {
+	if arr, ok := v.([]any); ok {
+		out := make([]string, 0, len(arr))
+		for _, e := range arr {
+			if _, nested := e.([]any); nested {
+				return nil, fmt.Errorf("nested arrays are not supported")
+			}
+			out = append(out, configValueString(e))
+		}
+		return out, nil
+	}
+	return []string{configValueString(v)}, nil
+}
+
+func configValueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// ParseConfig parses a configuration file; see Config.
+func ParseConfig(data string) (*Config, error) {
+	p := &configParser{src: data, line: 1}
+	root := make(map[string]any)
+	current := root
+	defined := make(map[string]bool) // explicitly defined tables
+	for {
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			break
+		}
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables are not supported")
+			}
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if !p.consume(']') {
+				return nil, p.errorf("expected ] after table name")
+			}
+			name := strings.Join(path, ".")
+			if defined[name] {
+				return nil, p.errorf("table [%s] defined twice", name)
+			}
+			defined[name] = true
+			if current, err = descend(root, path); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		} else {
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if !p.consume('=') {
+				return nil, p.errorf("expected = after key %q", strings.Join(path, "."))
+			}
+			p.skipSpace()
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			table, err := descend(current, path[:len(path)-1])
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			key := path[len(path)-1]
+			if _, dup := table[key]; dup {
+				return nil, p.errorf("key %q defined twice", strings.Join(path, "."))
+			}
+			table[key] = v
+		}
+		p.skipSpace()
+		p.skipComment()
+		if !p.eof() && !p.consume('\n') {
+			return nil, p.errorf("unexpected %q at end of line", p.peek())
+		}
+		if p.src[p.pos-1] == '\n' {
+			p.line++
+		}
+	}
+	return &Config{root: root}, nil
+}
+
+// descend returns the table at path below t, creating missing tables.
+func descend(t map[string]any, path []string) (map[string]any, error) {
+	for _, k := range path {
+		switch next := t[k].(type) {
+		case nil:
+			m := make(map[string]any)
+			t[k] = m
+			t = m
+		case map[string]any:
+			t = next
+		default:
+			return nil, fmt.Errorf("%q is a value, not a table", k)
+		}
+	}
+	return t, nil
+}
+
+type configParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *configParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *configParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *configParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *configParser) consume(c byte) bool {
+	if p.peek() == c && !p.eof() {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *configParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.pos++
+	}
+}
+
+func (p *configParser) skipComment() {
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipSpaceAndComments skips blanks, comments and, with newlines set, line breaks.
+func (p *configParser) skipSpaceAndComments(newlines bool) {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		if newlines && p.peek() == '\n' {
+			p.pos++
+			p.line++
+			continue
+		}
+		return
+	}
+}
+
+var bareKeyChar = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+// parseKey parses a possibly dotted key.
+func (p *configParser) parseKey() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '"', '\'':
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, s)
+		default:
+			m := bareKeyChar.FindString(p.src[p.pos:])
+			if m == "" {
+				return nil, p.errorf("expected a key")
+			}
+			p.pos += len(m)
+			path = append(path, m)
+		}
+		p.skipSpace()
+		if !p.consume('.') {
+			return path, nil
+		}
+	}
+}
+
+var (
+	configNumber = regexp.MustCompile(`^[+-]?[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9]+)?`)
+	configDate   = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}([Tt ][0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?([Zz]|[+-][0-9]{2}:[0-9]{2})?)?`)
+)
+
+func (p *configParser) parseValue() (any, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, "'''"):
+		return nil, p.errorf("multi-line strings are not supported")
+	case p.peek() == '"' || p.peek() == '\'':
+		return p.parseString()
+	case p.peek() == '[':
+		return p.parseArray()
+	case p.peek() == '{':
+		return nil, p.errorf("inline tables are not supported")
+	case strings.HasPrefix(rest, "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(rest, "false"):
+		p.pos += 5
+		return false, nil
+	}
+	if m := configDate.FindString(rest); m != "" {
+		p.pos += len(m)
+		return m, nil
+	}
+	if m := configNumber.FindString(rest); m != "" {
+		p.pos += len(m)
+		clean := strings.ReplaceAll(m, "_", "")
+		if strings.ContainsAny(clean, ".eE") {
+			f, err := strconv.ParseFloat(clean, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number %q", m)
+			}
+			return f, nil
+		}
+		n, err := strconv.ParseInt(clean, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %q", m)
+		}
+		return n, nil
+	}
+	return nil, p.errorf("invalid value (strings must be quoted)")
+}
+
+// parseString parses a basic ("...") or literal ('...') string.
+func (p *configParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return "", p.errorf("invalid \\u escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid \\u escape")
+				}
+				p.pos += 4
+				b.WriteRune(rune(r))
+			default:
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// parseArray parses an array, which may span lines and have a trailing comma.
+func (p *configParser) parseArray() ([]any, error) {
+	p.pos++ // [
+	out := []any{}
+	for {
+		p.skipSpaceAndComments(true)
+		if p.consume(']') {
+			return out, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		p.skipSpaceAndComments(true)
+		if p.consume(']') {
+			return out, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
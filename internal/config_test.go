@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# defaults for every profile
+defaultProfile = "eu-prod"
+concurrency = 4
+
+[refresh]
+output = "targets.json"
+
+[profile.eu-prod]
+apiUrl = "https://api.eu.snyk.io"
+tokenEnv = 'SNYK_TOKEN_EU'
+groupId = "g-eu"
+createdAfter = 2024-01-01
+tag = [
+  "team=payments", # trailing comment
+  "env=prod",
+]
+
+[profile.eu-prod.refresh]
+concurrency = 8
+includeCLI = true
+rps = 2.5
+
+[profile."us-sandbox"]
+apiUrl = "https://api.snyk.io"
+dedup.withinOrg = false
+`
+
+func TestParseConfig_Settings(t *testing.T) {
+	cfg, err := ParseConfig(testConfig)
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if got := cfg.Profiles(); !reflect.DeepEqual(got, []string{"eu-prod", "us-sandbox"}) {
+		t.Errorf("Profiles = %v", got)
+	}
+	if got := cfg.DefaultProfile(); got != "eu-prod" {
+		t.Errorf("DefaultProfile = %q", got)
+	}
+
+	settings, err := cfg.Settings("eu-prod", "refresh", []string{"refresh", "dedup"})
+	if err != nil {
+		t.Fatalf("Settings: %v", err)
+	}
+	var got []string
+	for _, s := range settings {
+		got = append(got, s.Source+" "+s.Flag+"="+strings.Join(s.Values, "|"))
+	}
+	want := []string{
+		"top level concurrency=4",
+		"[refresh] output=targets.json",
+		"[profile.eu-prod] apiUrl=https://api.eu.snyk.io",
+		"[profile.eu-prod] createdAfter=2024-01-01",
+		"[profile.eu-prod] groupId=g-eu",
+		"[profile.eu-prod] tag=team=payments|env=prod",
+		"[profile.eu-prod] tokenEnv=SNYK_TOKEN_EU",
+		"[profile.eu-prod.refresh] concurrency=8",
+		"[profile.eu-prod.refresh] includeCLI=true",
+		"[profile.eu-prod.refresh] rps=2.5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("settings:\n got %q\nwant %q", got, want)
+	}
+	if settings[0].Command || !settings[1].Command {
+		t.Errorf("Command: top level = %v, [refresh] = %v", settings[0].Command, settings[1].Command)
+	}
+
+	settings, err = cfg.Settings("us-sandbox", "dedup", []string{"refresh", "dedup"})
+	if err != nil {
+		t.Fatalf("Settings: %v", err)
+	}
+	last := settings[len(settings)-1]
+	if last.Flag != "withinOrg" || last.Values[0] != "false" || last.Source != "[profile.us-sandbox.dedup]" {
+		t.Errorf("last setting = %+v", last)
+	}
+
+	if _, err := cfg.Settings("missing", "refresh", []string{"refresh", "dedup"}); err == nil || !strings.Contains(err.Error(), "eu-prod, us-sandbox") {
+		t.Errorf("unknown profile: err = %v", err)
+	}
+}
+
+func TestParseConfig_Values(t *testing.T) {
+	cfg, err := ParseConfig(`
+a = "tab\there \"q\" \u00e9"
+b = 'C:\path'
+c = -1_000
+d = 1e3
+e = []
+"quoted key" = "x # not a comment"
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := map[string]any{
+		"a":          "tab\there \"q\" é",
+		"b":          `C:\path`,
+		"c":          int64(-1000),
+		"d":          1000.0,
+		"e":          []any{},
+		"quoted key": "x # not a comment",
+	}
+	if !reflect.DeepEqual(cfg.root, want) {
+		t.Errorf("root = %#v", cfg.root)
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := map[string]string{
+		"a = 1\na = 2":             "line 2: key \"a\" defined twice",
+		"[x]\n[x]":                 "line 2: table [x] defined twice",
+		"a = bare":                 "strings must be quoted",
+		"a = \"open":               "unterminated string",
+		"[[x]]":                    "arrays of tables are not supported",
+		"a = {b = 1}":              "inline tables are not supported",
+		"a = 1 b":                  "unexpected",
+		"a = 1\n[a]":               "\"a\" is a value, not a table",
+		"a = [1 2]":                "expected , or ]",
+		"a = \"\"\"x\"\"\"":        "multi-line strings are not supported",
+		"\n\n= 1":                  "line 3: expected a key",
+		"a = \"bad \\q escape\"":   "invalid escape",
+		"a = 99999999999999999999": "invalid integer",
+	}
+	for src, want := range tests {
+		_, err := ParseConfig(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseConfig(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestConfig_SettingsErrors(t *testing.T) {
+	cfg, err := ParseConfig("[profile.p.refresh.extra]\na = 1\n[bogus]\nb = 2")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if _, err := cfg.Settings("", "refresh", []string{"refresh"}); err == nil || !strings.Contains(err.Error(), "unknown table [bogus]") {
+		t.Errorf("unknown table: err = %v", err)
+	}
+}
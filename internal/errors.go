@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrorClass groups API failures by what the user can do about them.
+type ErrorClass string
+
+const (
+	ClassAuth       ErrorClass = "auth"       // 401: credentials rejected
+	ClassPermission ErrorClass = "permission" // 403: credentials lack a role
+	ClassNotFound   ErrorClass = "not_found"  // 404
+	ClassRateLimit  ErrorClass = "rate_limit" // 429 after all retries
+	ClassServer     ErrorClass = "server"     // 5xx after all retries
+	ClassClient     ErrorClass = "client"     // other 4xx: bad request, conflict, ...
+	ClassNetwork    ErrorClass = "network"    // no HTTP response
+	ClassCanceled   ErrorClass = "canceled"   // context cancelled or deadline exceeded
+	ClassOther      ErrorClass = "other"      // e.g. an undecodable response
+)
+
+// JSONAPIError is one entry of a JSON:API "errors" array.
+type JSONAPIError struct {
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// APIError is a non-success response from the Snyk API.
+type APIError struct {
+	Method     string
+	Path       string // URL path, without query string
+	StatusCode int
+	RequestID  string // snyk-request-id response header, for Snyk support
+	Errors     []JSONAPIError
+	Body       string // raw body when it is not a JSON:API error document
+	Retryable  bool   // the status is one DoWithRetry retries (see isRetryableStatus)
+}
+
+// newAPIError builds an APIError from a response and its body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("snyk-request-id"),
+		Retryable:  isRetryableStatus(resp.StatusCode),
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.Path = resp.Request.URL.Path
+	}
+	var doc struct {
+		Errors []JSONAPIError `json:"errors"`
+	}
+	if json.Unmarshal(body, &doc) == nil && len(doc.Errors) > 0 {
+		e.Errors = doc.Errors
+	} else {
+		e.Body = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: status %d", e.Method, e.Path, e.StatusCode)
+	if len(e.Errors) > 0 {
+		for i, je := range e.Errors {
+			if i == 0 {
+				b.WriteString(": ")
+			} else {
+				b.WriteString("; ")
+			}
+			b.WriteString(je.Title)
+			if je.Detail != "" {
+				if je.Title != "" {
+					b.WriteString(" - ")
+				}
+				b.WriteString(je.Detail)
+			}
+		}
+	} else if e.Body != "" {
+		b.WriteString(", body: ")
+		b.WriteString(e.Body)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+	if e.StatusCode == http.StatusUnauthorized {
+		b.WriteString(": check your Snyk credentials and API region")
+	}
+	return b.String()
+}
+
+// Class returns the error class for e's status code.
+func (e *APIError) Class() ErrorClass {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ClassAuth
+	case e.StatusCode == http.StatusForbidden:
+		return ClassPermission
+	case e.StatusCode == http.StatusNotFound:
+		return ClassNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ClassRateLimit
+	case e.StatusCode >= 500:
+		return ClassServer
+	default:
+		return ClassClient
+	}
+}
+
+// ClassifyError returns the class of any error returned by this package:
+// the APIError's class if err wraps one, ClassCanceled for context errors,
+// ClassNetwork for transport failures and ClassOther otherwise.
+func ClassifyError(err error) ErrorClass {
+	var apiErr *APIError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Class()
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ClassCanceled
+	case errors.As(err, &urlErr):
+		return ClassNetwork
+	default:
+		return ClassOther
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAPIError_FromResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("snyk-request-id", "req-123")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"jsonapi":{"version":"1.0"},"errors":[{"status":"403","code":"SNYK-0003","title":"Forbidden","detail":"not allowed"}]}`))
+	}))
+	defer srv.Close()
+
+	_, err := FetchProjects(context.Background(), newTestClient(srv), "org-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Method != "GET" || apiErr.Path != "/rest/orgs/org-1/projects" || apiErr.StatusCode != 403 {
+		t.Errorf("apiErr = %+v", apiErr)
+	}
+	if apiErr.RequestID != "req-123" || len(apiErr.Errors) != 1 || apiErr.Errors[0].Code != "SNYK-0003" {
+		t.Errorf("apiErr = %+v", apiErr)
+	}
+	if apiErr.Retryable || apiErr.Class() != ClassPermission {
+		t.Errorf("Retryable=%v Class=%s", apiErr.Retryable, apiErr.Class())
+	}
+	msg := err.Error()
+	for _, want := range []string{"fetch projects", "status 403", "Forbidden - not allowed", "request ID req-123"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Error() = %q, missing %q", msg, want)
+		}
+	}
+}
+
+func TestAPIError_RetriesExhausted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("down"))
+	}))
+	defer srv.Close()
+
+	_, err := FetchTargets(context.Background(), newTestClient(srv), "org-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Retryable || apiErr.Body != "down" {
+		t.Fatalf("err = %v", err)
+	}
+	if got := ClassifyError(err); got != ClassServer {
+		t.Errorf("ClassifyError = %s, want server", got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&APIError{StatusCode: 401}, ClassAuth},
+		{fmt.Errorf("wrap: %w", &APIError{StatusCode: 404}), ClassNotFound},
+		{&APIError{StatusCode: 429}, ClassRateLimit},
+		{&APIError{StatusCode: 409}, ClassClient},
+		{fmt.Errorf("rate limiter: %w", context.Canceled), ClassCanceled},
+		{fmt.Errorf("max retries exceeded: %w", &url.Error{Op: "Get", URL: "https://x", Err: errors.New("connection refused")}), ClassNetwork},
+		{errors.New("decode projects: bad json"), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
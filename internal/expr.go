@@ -0,0 +1,554 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled --where expression evaluated against a project and,
+// optionally, the import target it converts to.
+//
+// Grammar (lowest to highest precedence):
+//
+//	expr   = and { "||" and }
+//	and    = unary { "&&" unary }
+//	unary  = "!" unary | cmp
+//	cmp    = operand [ op operand ]
+//	op     = "==" | "!=" | "<" | "<=" | ">" | ">=" | "matches" | "contains" | "startsWith" | "in"
+//	operand = string | "true" | "false" | field | "[" [ string { "," string } ] "]" | "(" expr ")"
+//
+// Strings are double- or single-quoted. Comparisons with < and > are
+// lexicographic, except on created: there both sides are parsed as a date
+// (YYYY-MM-DD, midnight UTC) or RFC 3339 timestamp and compared as times, so
+// `created < "2024-01-01"` works as expected, and a project whose creation
+// time cannot be parsed matches no ordering comparison. Expressions are type
+// checked at compile time, so evaluation cannot fail.
+type Expr struct {
+	src        string
+	root       exprNode
+	usesTarget bool
+}
+
+// exprType is the static type of an expression node.
+type exprType int
+
+const (
+	typeString exprType = iota
+	typeBool
+	typeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeString:
+		return "string"
+	case typeBool:
+		return "bool"
+	default:
+		return "list"
+	}
+}
+
+// exprEnv is the evaluation environment: a project and an optional target.
+type exprEnv struct {
+	p *Project
+	t *ImportTarget
+}
+
+type exprNode interface {
+	typ() exprType
+	eval(env exprEnv) interface{}
+}
+
+// exprField describes a field that can be referenced in an expression.
+type exprField struct {
+	typ    exprType
+	target bool // needs an ImportTarget
+	date   bool // a timestamp, ordered as a time by < and >
+	get    func(env exprEnv) interface{}
+}
+
+func projectString(f func(p *Project) string) exprField {
+	return exprField{typ: typeString, get: func(env exprEnv) interface{} { return f(env.p) }}
+}
+
+func projectDate(f func(p *Project) string) exprField {
+	field := projectString(f)
+	field.date = true
+	return field
+}
+
+func projectList(f func(p *Project) []string) exprField {
+	return exprField{typ: typeList, get: func(env exprEnv) interface{} { return f(env.p) }}
+}
+
+func targetString(f func(t *ImportTarget) string) exprField {
+	return exprField{typ: typeString, target: true, get: func(env exprEnv) interface{} {
+		if env.t == nil {
+			return ""
+		}
+		return f(env.t)
+	}}
+}
+
+// exprFields lists the fields available to --where expressions.
+var exprFields = map[string]exprField{
+	"id":                  projectString(func(p *Project) string { return p.ID }),
+	"name":                projectString(func(p *Project) string { return p.Name }),
+	"origin":              projectString(func(p *Project) string { return p.Origin }),
+	"branch":              projectString(func(p *Project) string { return p.Branch }),
+	"targetReference":     projectString(func(p *Project) string { return p.TargetReference }),
+	"created":             projectDate(func(p *Project) string { return p.Created }),
+	"targetId":            projectString(func(p *Project) string { return p.TargetID }),
+	"remoteRepoUrl":       projectString(func(p *Project) string { return p.RemoteRepoURL }),
+	"type":                projectString(func(p *Project) string { return p.Type }),
+	"targetFile":          projectString(func(p *Project) string { return p.TargetFile }),
+	"status":              projectString(func(p *Project) string { return p.Status }),
+	"environment":         projectList(func(p *Project) []string { return p.Environment }),
+	"lifecycle":           projectList(func(p *Project) []string { return p.Lifecycle }),
+	"businessCriticality": projectList(func(p *Project) []string { return p.BusinessCriticality }),
+	"tags": projectList(func(p *Project) []string {
+		out := make([]string, len(p.Tags))
+		for i, t := range p.Tags {
+			out[i] = t.Key + "=" + t.Value
+		}
+		return out
+	}),
+	"orgId":             targetString(func(t *ImportTarget) string { return t.OrgID }),
+	"integrationId":     targetString(func(t *ImportTarget) string { return t.IntegrationID }),
+	"target.name":       targetString(func(t *ImportTarget) string { return t.Target.Name }),
+	"target.owner":      targetString(func(t *ImportTarget) string { return t.Target.Owner }),
+	"target.branch":     targetString(func(t *ImportTarget) string { return t.Target.Branch }),
+	"target.projectKey": targetString(func(t *ImportTarget) string { return t.Target.ProjectKey }),
+	"target.repoSlug":   targetString(func(t *ImportTarget) string { return t.Target.RepoSlug }),
+}
+
+// CompileExpr parses and type checks a --where expression.
+func CompileExpr(src string) (*Expr, error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("where %q: %w", src, err)
+	}
+	ps := &exprParser{toks: toks}
+	root, err := ps.parseOr()
+	if err == nil && ps.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %s", ps.peek())
+	}
+	if err == nil && root.typ() != typeBool {
+		err = fmt.Errorf("expression is a %s, want bool", root.typ())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("where %q: %w", src, err)
+	}
+	return &Expr{src: src, root: root, usesTarget: ps.usesTarget}, nil
+}
+
+// String returns the expression source.
+func (e *Expr) String() string { return e.src }
+
+// UsesTarget reports whether the expression references import target fields
+// (orgId, integrationId, target.*), which are only known after conversion.
+func (e *Expr) UsesTarget() bool { return e.usesTarget }
+
+// Match evaluates the expression against p and t. t may be nil, in which
+// case target fields evaluate to the empty string.
+func (e *Expr) Match(p Project, t *ImportTarget) bool {
+	return e.root.eval(exprEnv{p: &p, t: t}).(bool)
+}
+
+// --- lexer ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind tokKind
+	val  string
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q at %d", t.val, t.pos)
+	default:
+		return fmt.Sprintf("%q at %d", t.val, t.pos)
+	}
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[j])
+					}
+					continue
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			toks = append(toks, exprToken{kind: tokString, val: sb.String(), pos: i})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, exprToken{kind: tokIdent, val: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, cand := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			toks = append(toks, exprToken{kind: tokOp, val: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, exprToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+// --- parser ---
+
+type exprParser struct {
+	toks       []exprToken
+	pos        int
+	usesTarget bool
+}
+
+func (ps *exprParser) peek() exprToken { return ps.toks[ps.pos] }
+
+func (ps *exprParser) next() exprToken {
+	t := ps.toks[ps.pos]
+	if t.kind != tokEOF {
+		ps.pos++
+	}
+	return t
+}
+
+func (ps *exprParser) accept(kind tokKind, val string) bool {
+	if t := ps.peek(); t.kind == kind && t.val == val {
+		ps.pos++
+		return true
+	}
+	return false
+}
+
+func (ps *exprParser) parseOr() (exprNode, error) {
+	left, err := ps.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for ps.accept(tokOp, "||") {
+		right, err := ps.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeBool || right.typ() != typeBool {
+			return nil, fmt.Errorf("|| needs bool operands")
+		}
+		left = &logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (ps *exprParser) parseAnd() (exprNode, error) {
+	left, err := ps.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for ps.accept(tokOp, "&&") {
+		right, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeBool || right.typ() != typeBool {
+			return nil, fmt.Errorf("&& needs bool operands")
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (ps *exprParser) parseUnary() (exprNode, error) {
+	if ps.accept(tokOp, "!") {
+		x, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != typeBool {
+			return nil, fmt.Errorf("! needs a bool operand")
+		}
+		return &notNode{x: x}, nil
+	}
+	return ps.parseCmp()
+}
+
+var cmpOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"matches": true, "contains": true, "startsWith": true, "in": true,
+}
+
+func (ps *exprParser) parseCmp() (exprNode, error) {
+	left, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := ps.peek()
+	if !(t.kind == tokOp || t.kind == tokIdent) || !cmpOps[t.val] {
+		return left, nil
+	}
+	ps.next()
+	right, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return newCmpNode(t, left, right)
+}
+
+func (ps *exprParser) parseOperand() (exprNode, error) {
+	t := ps.next()
+	switch t.kind {
+	case tokString:
+		return &litNode{t: typeString, v: t.val}, nil
+	case tokIdent:
+		switch t.val {
+		case "true", "false":
+			return &litNode{t: typeBool, v: t.val == "true"}, nil
+		}
+		f, ok := exprFields[t.val]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q at %d", t.val, t.pos)
+		}
+		if f.target {
+			ps.usesTarget = true
+		}
+		return &fieldNode{name: t.val, f: f}, nil
+	case tokOp:
+		switch t.val {
+		case "(":
+			x, err := ps.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !ps.accept(tokOp, ")") {
+				return nil, fmt.Errorf("expected ) but found %s", ps.peek())
+			}
+			return x, nil
+		case "[":
+			var items []string
+			for !ps.accept(tokOp, "]") {
+				if len(items) > 0 && !ps.accept(tokOp, ",") {
+					return nil, fmt.Errorf("expected , or ] but found %s", ps.peek())
+				}
+				s := ps.next()
+				if s.kind != tokString {
+					return nil, fmt.Errorf("list elements must be strings, found %s", s)
+				}
+				items = append(items, s.val)
+			}
+			return &litNode{t: typeList, v: items}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+// --- nodes ---
+
+type litNode struct {
+	t exprType
+	v interface{}
+}
+
+func (n *litNode) typ() exprType            { return n.t }
+func (n *litNode) eval(exprEnv) interface{} { return n.v }
+
+type fieldNode struct {
+	name string
+	f    exprField
+}
+
+func (n *fieldNode) typ() exprType                { return n.f.typ }
+func (n *fieldNode) eval(env exprEnv) interface{} { return n.f.get(env) }
+
+type notNode struct{ x exprNode }
+
+func (n *notNode) typ() exprType                { return typeBool }
+func (n *notNode) eval(env exprEnv) interface{} { return !n.x.eval(env).(bool) }
+
+type logicNode struct {
+	and         bool
+	left, right exprNode
+}
+
+func (n *logicNode) typ() exprType { return typeBool }
+func (n *logicNode) eval(env exprEnv) interface{} {
+	l := n.left.eval(env).(bool)
+	if n.and {
+		return l && n.right.eval(env).(bool)
+	}
+	return l || n.right.eval(env).(bool)
+}
+
+type cmpNode struct {
+	op          string
+	left, right exprNode
+	re          *regexp.Regexp
+	dates       bool // order the operands as times (see Expr)
+}
+
+// isDateField reports whether n is a date field such as created.
+func isDateField(n exprNode) bool {
+	f, ok := n.(*fieldNode)
+	return ok && f.f.date
+}
+
+func newCmpNode(opTok exprToken, left, right exprNode) (exprNode, error) {
+	n := &cmpNode{op: opTok.val, left: left, right: right}
+	lt, rt := left.typ(), right.typ()
+	mismatch := fmt.Errorf("%s cannot compare %s with %s (at %d)", opTok.val, lt, rt, opTok.pos)
+	switch n.op {
+	case "==", "!=":
+		if lt != rt || lt == typeList {
+			return nil, mismatch
+		}
+	case "<", "<=", ">", ">=", "startsWith":
+		if lt != typeString || rt != typeString {
+			return nil, mismatch
+		}
+		if n.op == "startsWith" || (!isDateField(left) && !isDateField(right)) {
+			break
+		}
+		n.dates = true
+		for _, side := range []exprNode{left, right} {
+			if lit, ok := side.(*litNode); ok {
+				if _, err := ParseDate(lit.v.(string)); err != nil {
+					return nil, fmt.Errorf("%s: %w (at %d)", opTok.val, err, opTok.pos)
+				}
+			}
+		}
+	case "matches":
+		lit, ok := right.(*litNode)
+		if lt != typeString || !ok || lit.t != typeString {
+			return nil, fmt.Errorf("matches needs a string field and a quoted regular expression (at %d)", opTok.pos)
+		}
+		re, err := regexp.Compile(lit.v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("matches: %w", err)
+		}
+		n.re = re
+	case "contains":
+		if (lt != typeString && lt != typeList) || rt != typeString {
+			return nil, mismatch
+		}
+	case "in":
+		if lt != typeString || rt != typeList {
+			return nil, mismatch
+		}
+	}
+	return n, nil
+}
+
+func (n *cmpNode) typ() exprType { return typeBool }
+
+func (n *cmpNode) eval(env exprEnv) interface{} {
+	l, r := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<", "<=", ">", ">=":
+		if n.dates {
+			return compareDates(n.op, l.(string), r.(string))
+		}
+		switch n.op {
+		case "<":
+			return l.(string) < r.(string)
+		case "<=":
+			return l.(string) <= r.(string)
+		case ">":
+			return l.(string) > r.(string)
+		default:
+			return l.(string) >= r.(string)
+		}
+	case "startsWith":
+		return strings.HasPrefix(l.(string), r.(string))
+	case "matches":
+		return n.re.MatchString(l.(string))
+	case "contains":
+		if list, ok := l.([]string); ok {
+			return containsString(list, r.(string))
+		}
+		return strings.Contains(l.(string), r.(string))
+	case "in":
+		return containsString(r.([]string), l.(string))
+	}
+	panic("unreachable: unknown operator " + strconv.Quote(n.op))
+}
+
+// compareDates applies an ordering operator to two dates (see ParseDate).
+// It is false if either cannot be parsed.
+func compareDates(op, l, r string) bool {
+	lt, err := ParseDate(l)
+	if err != nil {
+		return false
+	}
+	rt, err := ParseDate(r)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "<":
+		return lt.Before(rt)
+	case "<=":
+		return !lt.After(rt)
+	case ">":
+		return lt.After(rt)
+	default:
+		return !lt.Before(rt)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
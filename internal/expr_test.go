@@ -0,0 +1,121 @@
+package internal
+
+import "testing"
+
+func TestCompileExpr_Match(t *testing.T) {
+	p := Project{
+		ID:          "p1",
+		Name:        "acme/api:package.json",
+		Origin:      "github",
+		Created:     "2023-06-01T10:00:00.000Z",
+		Type:        "npm",
+		Status:      "active",
+		Tags:        []Tag{{Key: "team", Value: "payments"}},
+		Environment: []string{"backend"},
+	}
+	it := &ImportTarget{Target: Target{Owner: "acme", Name: "api"}, OrgID: "org-1", IntegrationID: "int-1"}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`origin == "github" && created < "2024-01-01" && name matches "^acme/"`, true},
+		{`origin == "github" && created >= "2024-01-01"`, false},
+		{`origin != 'github' || type == "npm"`, true},
+		{`!(status == "inactive")`, true},
+		{`origin in ["github", "github-cloud-app"]`, true},
+		{`tags contains "team=payments"`, true},
+		{`environment contains "frontend"`, false},
+		{`name contains "api" && name startsWith "acme/"`, true},
+		{`target.owner == "acme" && orgId == "org-1"`, true},
+		{`true && !false`, true},
+	}
+	for _, tt := range tests {
+		e, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Errorf("CompileExpr(%q): %v", tt.src, err)
+			continue
+		}
+		if got := e.Match(p, it); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExpr_CreatedComparesTimes(t *testing.T) {
+	tests := []struct {
+		created string
+		src     string
+		want    bool
+	}{
+		// Midnight UTC is the day boundary: it is <= the day, not > it.
+		{"2024-01-01T00:00:00Z", `created <= "2024-01-01"`, true},
+		{"2024-01-01T00:00:00Z", `created > "2024-01-01"`, false},
+		{"2024-01-01T00:00:00.000Z", `created >= "2024-01-01"`, true},
+		{"2024-01-01T00:00:00.001Z", `created > "2024-01-01"`, true},
+		{"2024-01-01T00:00:00.001Z", `created <= "2024-01-01"`, false},
+		// Offsets are honoured: this is 2023-12-31T23:00Z.
+		{"2024-01-01T01:00:00+02:00", `created > "2024-01-01"`, false},
+		{"2024-01-01T01:00:00+02:00", `created <= "2024-01-01"`, true},
+		{"2024-01-01T01:00:00+02:00", `"2023-12-31T22:00:00Z" < created`, true},
+		// Unparseable creation times match no ordering comparison.
+		{"", `created < "2024-01-01"`, false},
+		{"", `created >= "2024-01-01"`, false},
+	}
+	for _, tt := range tests {
+		e, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Errorf("CompileExpr(%q): %v", tt.src, err)
+			continue
+		}
+		if got := e.Match(Project{Created: tt.created}, nil); got != tt.want {
+			t.Errorf("Match(%q) with created %q = %v, want %v", tt.src, tt.created, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExpr_UsesTarget(t *testing.T) {
+	e, err := CompileExpr(`target.name == "api"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.UsesTarget() {
+		t.Error("UsesTarget() = false for target.name")
+	}
+	// Target fields are empty when no target is given
+	if e.Match(Project{}, nil) {
+		t.Error("target.name should be empty without a target")
+	}
+	e, err = CompileExpr(`origin == "github"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.UsesTarget() {
+		t.Error("UsesTarget() = true for origin")
+	}
+}
+
+func TestCompileExpr_Errors(t *testing.T) {
+	bad := []string{
+		``,
+		`origin`,                       // not a bool
+		`colour == "red"`,              // unknown field
+		`origin == "github" &&`,        // dangling operator
+		`(origin == "github"`,          // missing paren
+		`origin == "unterminated`,      // unterminated string
+		`tags == "a=b"`,                // list equality
+		`origin < true`,                // type mismatch
+		`name matches "("`,             // bad regex
+		`name matches origin`,          // regex must be literal
+		`origin in "github"`,           // in needs a list
+		`origin == "github" extra`,     // trailing tokens
+		`origin == "a" # comment`,      // bad character
+		`origin in ["github", branch]`, // list of non-strings
+		`created < "last week"`,        // not a date
+	}
+	for _, src := range bad {
+		if _, err := CompileExpr(src); err == nil {
+			t.Errorf("CompileExpr(%q): want error", src)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Command fakesnyk serves the fake Snyk API from a JSON data file, for
+// driving snyk-target-export by hand:
+//
+//	go run ./internal/fakesnyk/cmd/fakesnyk --data=testdata/fakesnyk_data.json
+//	SNYK_API=http://127.0.0.1:8089 SNYK_TOKEN=fake ./snyk-target-export --groupId=<group-id>
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/snyk-playground/snyk-target-export/internal/fakesnyk"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8089", "Listen address")
+	dataFile := flag.String("data", "testdata/fakesnyk_data.json", "JSON file with the groups, orgs, projects and targets to serve")
+	token := flag.String("token", "", "Only accept this API token (default: accept any)")
+	pageSize := flag.Int("maxPageSize", 0, "Cap REST page sizes to exercise pagination (0 = 100)")
+	rateLimitEvery := flag.Int("rateLimitEvery", 0, "Answer every Nth request with 429 (0 = never)")
+	flag.Parse()
+
+	data, err := fakesnyk.LoadData(*dataFile)
+	if err != nil {
+		log.Fatalf("load data: %v", err)
+	}
+	srv := fakesnyk.New(data)
+	srv.Token = *token
+	srv.MaxPageSize = *pageSize
+	srv.RateLimitEvery = *rateLimitEvery
+
+	log.Printf("fake Snyk API listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
@@ -0,0 +1,505 @@
+// Package fakesnyk is an in-memory fake of the Snyk API endpoints used by
+// snyk-target-export. It speaks the real wire formats (JSON:API with cursor
+// pagination for REST, plain JSON for v1), keeps deletes as state, and can
+// inject rate limiting and faults, so the CLI can be driven end to end by
+// pointing SNYK_API at it.
+package fakesnyk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Data is the fake's initial state. It can be loaded from JSON (see LoadData).
+type Data struct {
+	Self   Self    `json:"self"`
+	Groups []Group `json:"groups"`
+}
+
+// Self is the identity returned by /rest/self.
+type Self struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"` // "user" or "service_account"; default "user"
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// Group is a Snyk group and its orgs.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	Orgs []Org  `json:"orgs"`
+}
+
+// Org is a Snyk org with its integrations (type -> ID), projects and targets.
+type Org struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Slug         string            `json:"slug"`
+	Created      string            `json:"created,omitempty"`
+	Integrations map[string]string `json:"integrations,omitempty"`
+	Projects     []Project         `json:"projects,omitempty"`
+	Targets      []Target          `json:"targets,omitempty"`
+}
+
+// Project is a Snyk project.
+type Project struct {
+	ID                  string   `json:"id"`
+	Name                string   `json:"name"`
+	Origin              string   `json:"origin"`
+	Type                string   `json:"type,omitempty"`
+	TargetReference     string   `json:"targetReference,omitempty"`
+	TargetFile          string   `json:"targetFile,omitempty"`
+	Status              string   `json:"status,omitempty"`
+	Created             string   `json:"created,omitempty"`
+	TargetID            string   `json:"targetId,omitempty"`
+	RemoteRepoURL       string   `json:"remoteRepoUrl,omitempty"`
+	Tags                []Tag    `json:"tags,omitempty"`
+	Environment         []string `json:"environment,omitempty"`
+	Lifecycle           []string `json:"lifecycle,omitempty"`
+	BusinessCriticality []string `json:"businessCriticality,omitempty"`
+}
+
+// Tag is a key/value project tag.
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Target is a Snyk target (repository-level entry).
+type Target struct {
+	ID              string `json:"id"`
+	DisplayName     string `json:"displayName"`
+	IntegrationID   string `json:"integrationId"`
+	IntegrationType string `json:"integrationType"`
+	Created         string `json:"created,omitempty"`
+}
+
+// Fault makes matching requests fail with Status. Method "" matches any
+// method and Path is a prefix of the request path. Count limits how many
+// requests fail; 0 means all of them.
+type Fault struct {
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Count  int    `json:"count,omitempty"`
+}
+
+// LoadData reads Data from a JSON file.
+func LoadData(path string) (Data, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Data{}, err
+	}
+	var d Data
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return Data{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Server is the fake Snyk API. It implements http.Handler; serve it with
+// httptest.NewServer or http.ListenAndServe. Configure it before serving.
+type Server struct {
+	// Token, if set, is the only API token accepted ("Authorization: token
+	// <Token>"); other requests get 401. Empty accepts any credentials.
+	Token string
+	// MaxPageSize caps the page size of REST list endpoints, so small data
+	// sets can exercise pagination. 0 means the API maximum of 100.
+	MaxPageSize int
+	// RateLimitEvery answers every Nth request with 429 and Retry-After.
+	// 0 disables rate limiting.
+	RateLimitEvery int
+	// RetryAfter is the Retry-After value sent with injected 429s (default "0").
+	RetryAfter string
+	// Faults are checked in order before each request is served.
+	Faults []Fault
+
+	mu       sync.Mutex
+	data     Data
+	requests []string
+	count    int
+}
+
+// New returns a Server holding a copy of data.
+func New(data Data) *Server {
+	s := &Server{}
+	// Round-trip through JSON for a deep copy, so deletes never touch the caller's data.
+	raw, _ := json.Marshal(data)
+	json.Unmarshal(raw, &s.data)
+	for gi := range s.data.Groups {
+		for oi := range s.data.Groups[gi].Orgs {
+			if s.data.Groups[gi].Orgs[oi].Integrations == nil {
+				s.data.Groups[gi].Orgs[oi].Integrations = map[string]string{}
+			}
+		}
+	}
+	return s
+}
+
+// Requests returns "METHOD path" for every request received, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Projects returns the current projects of an org (after deletes).
+func (s *Server) Projects(orgID string) []Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, org := s.org(orgID); org != nil {
+		return slices.Clone(org.Projects)
+	}
+	return nil
+}
+
+// Targets returns the current targets of an org (after deletes).
+func (s *Server) Targets(orgID string) []Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, org := s.org(orgID); org != nil {
+		return slices.Clone(org.Targets)
+	}
+	return nil
+}
+
+// org returns the org with the given ID and its group ID. s.mu must be held.
+func (s *Server) org(id string) (string, *Org) {
+	for gi := range s.data.Groups {
+		g := &s.data.Groups[gi]
+		for oi := range g.Orgs {
+			if g.Orgs[oi].ID == id {
+				return g.ID, &g.Orgs[oi]
+			}
+		}
+	}
+	return "", nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.count++
+
+	if s.RateLimitEvery > 0 && s.count%s.RateLimitEvery == 0 {
+		retryAfter := s.RetryAfter
+		if retryAfter == "" {
+			retryAfter = "0"
+		}
+		w.Header().Set("Retry-After", retryAfter)
+		writeError(w, http.StatusTooManyRequests, "Too many requests")
+		return
+	}
+	for i := range s.Faults {
+		f := &s.Faults[i]
+		if (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path) && f.Count >= 0 {
+			if f.Count > 0 {
+				if f.Count--; f.Count == 0 {
+					f.Count = -1 // used up
+				}
+			}
+			writeError(w, f.Status, "injected fault")
+			return
+		}
+	}
+	if r.URL.Path == "/rest/openapi" {
+		writeJSON(w, http.StatusOK, map[string]any{"openapi": "3.0.3"})
+		return
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != "token "+s.Token {
+		writeError(w, http.StatusUnauthorized, "Invalid auth token")
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/rest/") && r.URL.Query().Get("version") == "" {
+		writeError(w, http.StatusBadRequest, "version query parameter is required")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "GET" && match(parts, "rest", "self"):
+		s.getSelf(w)
+	case r.Method == "GET" && match(parts, "rest", "groups"):
+		s.listGroups(w, r)
+	case r.Method == "GET" && match(parts, "rest", "orgs"):
+		s.listOrgs(w, r)
+	case r.Method == "GET" && match(parts, "v1", "org", "*", "integrations"):
+		s.listIntegrations(w, parts[2])
+	case r.Method == "GET" && match(parts, "rest", "orgs", "*", "projects"):
+		s.listProjects(w, r, parts[2])
+	case r.Method == "GET" && match(parts, "rest", "orgs", "*", "targets"):
+		s.listTargets(w, r, parts[2])
+	case r.Method == "DELETE" && match(parts, "rest", "orgs", "*", "projects", "*"):
+		s.deleteProject(w, parts[2], parts[4])
+	case r.Method == "DELETE" && match(parts, "rest", "orgs", "*", "targets", "*"):
+		s.deleteTarget(w, parts[2], parts[4])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// match reports whether path segments match pattern; "*" matches any segment.
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) getSelf(w http.ResponseWriter) {
+	self := s.data.Self
+	if self.Type == "" {
+		self.Type = "user"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": resource{ID: self.ID, Type: self.Type, Attributes: map[string]any{"name": self.Name, "email": self.Email}},
+	})
+}
+
+func (s *Server) listGroups(w http.ResponseWriter, r *http.Request) {
+	var items []resource
+	for _, g := range s.data.Groups {
+		items = append(items, resource{ID: g.ID, Type: "group", Attributes: map[string]any{"name": g.Name, "slug": g.Slug}})
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) listOrgs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var items []resource
+	for _, g := range s.data.Groups {
+		if id := q.Get("group_id"); id != "" && id != g.ID {
+			continue
+		}
+		for _, o := range g.Orgs {
+			if name := q.Get("name"); name != "" && !strings.Contains(strings.ToLower(o.Name), strings.ToLower(name)) {
+				continue
+			}
+			if slug := q.Get("slug"); slug != "" && slug != o.Slug {
+				continue
+			}
+			items = append(items, resource{ID: o.ID, Type: "org", Attributes: map[string]any{
+				"name": o.Name, "slug": o.Slug, "group_id": g.ID, "is_personal": false, "created_at": o.Created,
+			}})
+		}
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) listIntegrations(w http.ResponseWriter, orgID string) {
+	_, org := s.org(orgID)
+	if org == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"code": 404, "message": "Org not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, org.Integrations)
+}
+
+func (s *Server) listProjects(w http.ResponseWriter, r *http.Request, orgID string) {
+	_, org := s.org(orgID)
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Org not found")
+		return
+	}
+	q := r.URL.Query()
+	anyOf := func(param, value string) bool {
+		v := q.Get(param)
+		return v == "" || slices.Contains(strings.Split(v, ","), value)
+	}
+	var items []resource
+	for _, p := range org.Projects {
+		if !anyOf("origins", p.Origin) || !anyOf("types", p.Type) || !anyOf("target_id", p.TargetID) {
+			continue
+		}
+		if !hasTags(p.Tags, q.Get("tags")) ||
+			!hasAttribute(p.Environment, q.Get("environment")) ||
+			!hasAttribute(p.Lifecycle, q.Get("lifecycle")) ||
+			!hasAttribute(p.BusinessCriticality, q.Get("business_criticality")) {
+			continue
+		}
+		status := p.Status
+		if status == "" {
+			status = "active"
+		}
+		res := resource{ID: p.ID, Type: "project", Attributes: map[string]any{
+			"name": p.Name, "origin": p.Origin, "type": p.Type, "target_file": p.TargetFile,
+			"target_reference": p.TargetReference, "status": status, "created": p.Created,
+			"tags": p.Tags, "environment": p.Environment, "lifecycle": p.Lifecycle,
+			"business_criticality": p.BusinessCriticality,
+		}}
+		if p.RemoteRepoURL != "" {
+			res.Attributes["remote_repo_url"] = p.RemoteRepoURL
+		}
+		if p.TargetID != "" {
+			res.Relationships = map[string]any{"target": map[string]any{"data": map[string]any{"id": p.TargetID, "type": "target"}}}
+		}
+		items = append(items, res)
+	}
+	s.writePage(w, r, items)
+}
+
+// hasTags reports whether tags include every "key:value" in the comma-separated filter.
+func hasTags(tags []Tag, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, want := range strings.Split(filter, ",") {
+		key, value, _ := strings.Cut(want, ":")
+		if !slices.Contains(tags, Tag{Key: key, Value: value}) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAttribute reports whether values include filter (or filter is empty).
+func hasAttribute(values []string, filter string) bool {
+	return filter == "" || slices.Contains(values, filter)
+}
+
+func (s *Server) listTargets(w http.ResponseWriter, r *http.Request, orgID string) {
+	_, org := s.org(orgID)
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Org not found")
+		return
+	}
+	excludeEmpty := r.URL.Query().Get("exclude_empty") != "false"
+	var items []resource
+	for _, t := range org.Targets {
+		if excludeEmpty && !slices.ContainsFunc(org.Projects, func(p Project) bool { return p.TargetID == t.ID }) {
+			continue
+		}
+		items = append(items, resource{
+			ID:         t.ID,
+			Type:       "target",
+			Attributes: map[string]any{"display_name": t.DisplayName, "created_at": t.Created},
+			Relationships: map[string]any{"integration": map[string]any{"data": map[string]any{
+				"id": t.IntegrationID, "type": "integration",
+				"attributes": map[string]any{"integration_type": t.IntegrationType},
+			}}},
+		})
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) deleteProject(w http.ResponseWriter, orgID, projectID string) {
+	_, org := s.org(orgID)
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Org not found")
+		return
+	}
+	i := slices.IndexFunc(org.Projects, func(p Project) bool { return p.ID == projectID })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	org.Projects = slices.Delete(org.Projects, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteTarget(w http.ResponseWriter, orgID, targetID string) {
+	_, org := s.org(orgID)
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Org not found")
+		return
+	}
+	i := slices.IndexFunc(org.Targets, func(t Target) bool { return t.ID == targetID })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Target not found")
+		return
+	}
+	if slices.ContainsFunc(org.Projects, func(p Project) bool { return p.TargetID == targetID }) {
+		writeError(w, http.StatusConflict, "Target still has projects")
+		return
+	}
+	org.Targets = slices.Delete(org.Targets, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resource is a JSON:API resource object.
+type resource struct {
+	ID            string         `json:"id"`
+	Type          string         `json:"type"`
+	Attributes    map[string]any `json:"attributes"`
+	Relationships map[string]any `json:"relationships,omitempty"`
+}
+
+// writePage writes one page of items, honouring limit and the starting_after
+// cursor, with a relative links.next when more items follow.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items []resource) {
+	q := r.URL.Query()
+	limit := 10
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	if s.MaxPageSize > 0 && limit > s.MaxPageSize {
+		limit = s.MaxPageSize
+	}
+	start := 0
+	if after := q.Get("starting_after"); after != "" {
+		i := slices.IndexFunc(items, func(it resource) bool { return it.ID == after })
+		if i < 0 {
+			writeError(w, http.StatusBadRequest, "invalid starting_after cursor")
+			return
+		}
+		start = i + 1
+	}
+	end := min(start+limit, len(items))
+	page := items[start:end]
+	if page == nil {
+		page = []resource{}
+	}
+	links := map[string]string{"self": r.URL.RequestURI()}
+	if end < len(items) {
+		next := url.Values{}
+		for k, v := range q {
+			next[k] = v
+		}
+		next.Set("starting_after", page[len(page)-1].ID)
+		links["next"] = r.URL.Path + "?" + next.Encode()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"jsonapi": map[string]string{"version": "1.0"},
+		"data":    page,
+		"links":   links,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.Header().Set("snyk-request-id", fmt.Sprintf("fake-%d", status))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON:API error document.
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]any{
+		"jsonapi": map[string]string{"version": "1.0"},
+		"errors": []map[string]string{{
+			"status": strconv.Itoa(status),
+			"title":  http.StatusText(status),
+			"detail": detail,
+		}},
+	})
+}
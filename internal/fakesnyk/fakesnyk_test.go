@@ -0,0 +1,143 @@
+package fakesnyk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+const (
+	groupID  = "g0000001-0001-4000-8000-000000000001"
+	orgID    = "o0000001-0001-4000-8000-000000000001"
+	targetID = "t0000002-0002-4000-8000-000000000002"
+)
+
+// start serves the testdata fixture and returns a client for it.
+func start(t *testing.T, configure func(*Server)) (*Server, *internal.Client) {
+	t.Helper()
+	data, err := LoadData(filepath.Join("..", "..", "testdata", "fakesnyk_data.json"))
+	if err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	s := New(data)
+	s.Token = "test-token"
+	if configure != nil {
+		configure(s)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	c := internal.NewClient(srv.Client(), internal.NewRateLimiter(0, 1))
+	c.BaseURL = srv.URL
+	c.Auth = internal.StaticTokenSource("test-token")
+	c.Retry = internal.RetryConfig{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, BackoffFactor: 2}
+	return s, c
+}
+
+func TestFetchOrgs_PaginatesAndFilters(t *testing.T) {
+	s, c := start(t, func(s *Server) { s.MaxPageSize = 1 })
+	ctx := context.Background()
+
+	orgs, err := internal.FetchOrgs(ctx, c, internal.OrgQuery{GroupID: groupID})
+	if err != nil {
+		t.Fatalf("FetchOrgs: %v", err)
+	}
+	if len(orgs) != 2 || orgs[0].GroupID != groupID || orgs[1].Slug != "search" {
+		t.Errorf("orgs = %+v", orgs)
+	}
+	if n := strings.Count(strings.Join(s.Requests(), "\n"), "GET /rest/orgs"); n != 2 {
+		t.Errorf("GET /rest/orgs requests = %d, want 2 (one per page)", n)
+	}
+
+	orgs, err = internal.FetchOrgs(ctx, c, internal.OrgQuery{Name: "PAY"})
+	if err != nil || len(orgs) != 1 || orgs[0].ID != orgID {
+		t.Errorf("name filter: %+v, %v", orgs, err)
+	}
+}
+
+func TestStreamProjects_ServerSideFilters(t *testing.T) {
+	_, c := start(t, func(s *Server) { s.MaxPageSize = 2 })
+	var names []string
+	q := internal.ProjectQuery{Origins: []string{"github"}, Types: []string{"npm"}}
+	err := internal.StreamProjects(context.Background(), c, orgID, q, func(page []internal.Project) error {
+		for _, p := range page {
+			names = append(names, p.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamProjects: %v", err)
+	}
+	if got := strings.Join(names, ","); got != "acme/api(main):package.json,acme/web:package.json" {
+		t.Errorf("projects = %s", got)
+	}
+}
+
+func TestDeletes_AreStateful(t *testing.T) {
+	s, c := start(t, nil)
+	ctx := context.Background()
+
+	if err := internal.DeleteTarget(ctx, c, orgID, targetID); internal.ClassifyError(err) != internal.ClassClient {
+		t.Errorf("deleting a target with projects: err = %v, want 409", err)
+	}
+	if err := internal.DeleteProject(ctx, c, orgID, "p0000003-0003-4000-8000-000000000003"); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if err := internal.DeleteProject(ctx, c, orgID, "p0000003-0003-4000-8000-000000000003"); internal.ClassifyError(err) != internal.ClassNotFound {
+		t.Errorf("deleting twice: err = %v, want 404", err)
+	}
+	if err := internal.DeleteTarget(ctx, c, orgID, targetID); err != nil {
+		t.Fatalf("DeleteTarget: %v", err)
+	}
+	if len(s.Projects(orgID)) != 5 || len(s.Targets(orgID)) != 4 {
+		t.Errorf("after deletes: %d projects, %d targets", len(s.Projects(orgID)), len(s.Targets(orgID)))
+	}
+
+	targets, err := internal.FetchTargets(ctx, c, orgID)
+	if err != nil || len(targets) != 4 {
+		t.Errorf("FetchTargets = %d targets, %v", len(targets), err)
+	}
+}
+
+func TestRateLimitAndFaults(t *testing.T) {
+	s, c := start(t, func(s *Server) {
+		s.RateLimitEvery = 2
+		s.Faults = []Fault{{Method: "GET", Path: "/v1/org/", Status: http.StatusBadGateway, Count: 1}}
+	})
+	ctx := context.Background()
+
+	// The first attempt hits the fault, the second the 429; both are retried.
+	integrations, err := internal.ListIntegrations(ctx, c, orgID)
+	if err != nil || integrations["github"] == "" {
+		t.Fatalf("ListIntegrations = %v, %v", integrations, err)
+	}
+	if n := len(s.Requests()); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+
+	_, c2 := start(t, func(s *Server) { s.Faults = []Fault{{Path: "/rest/orgs/" + orgID, Status: http.StatusForbidden}} })
+	if _, err := internal.FetchProjects(ctx, c2, orgID); internal.ClassifyError(err) != internal.ClassPermission {
+		t.Errorf("FetchProjects with 403 fault: err = %v", err)
+	}
+}
+
+func TestAuthAndVersion(t *testing.T) {
+	_, c := start(t, nil)
+	c.Auth = internal.StaticTokenSource("wrong")
+	if _, err := internal.FetchSelf(context.Background(), c); internal.ClassifyError(err) != internal.ClassAuth {
+		t.Errorf("wrong token: err = %v, want 401", err)
+	}
+
+	_, c = start(t, nil)
+	req, _ := http.NewRequest("GET", c.BaseURL+"/rest/self", nil)
+	resp, _, err := internal.DoWithRetry(context.Background(), c, req)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("missing version: status %v, err %v", resp, err)
+	}
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProjectFilter reports whether a project should be kept.
+type ProjectFilter func(Project) bool
+
+// MatchAll returns true if p passes every filter. An empty filter list matches everything.
+func MatchAll(p Project, filters []ProjectFilter) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterTypes keeps projects whose type (package manager) is one of types.
+func FilterTypes(types ...string) ProjectFilter {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return func(p Project) bool { return set[p.Type] }
+}
+
+// FilterTargetIDs keeps projects that belong to one of the given Snyk targets.
+func FilterTargetIDs(ids ...string) ProjectFilter {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return func(p Project) bool { return set[p.TargetID] }
+}
+
+// FilterTag keeps projects that carry the tag key=value.
+func FilterTag(key, value string) ProjectFilter {
+	return func(p Project) bool {
+		for _, t := range p.Tags {
+			if t.Key == key && t.Value == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterAttribute keeps projects whose environment, lifecycle or
+// business_criticality attribute contains any of values.
+func FilterAttribute(name string, values ...string) (ProjectFilter, error) {
+	var get func(Project) []string
+	switch name {
+	case "environment":
+		get = func(p Project) []string { return p.Environment }
+	case "lifecycle":
+		get = func(p Project) []string { return p.Lifecycle }
+	case "business_criticality":
+		get = func(p Project) []string { return p.BusinessCriticality }
+	default:
+		return nil, fmt.Errorf("unknown project attribute %q", name)
+	}
+	return func(p Project) bool {
+		for _, have := range get(p) {
+			for _, want := range values {
+				if have == want {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+// FilterStatus keeps projects with the given status ("active" or "inactive").
+func FilterStatus(status string) ProjectFilter {
+	return func(p Project) bool { return p.Status == status }
+}
+
+// FilterCreatedBefore keeps projects created strictly before t. Projects
+// without a parseable creation time are dropped.
+func FilterCreatedBefore(t time.Time) ProjectFilter {
+	return func(p Project) bool {
+		c, err := time.Parse(time.RFC3339, p.Created)
+		return err == nil && c.Before(t)
+	}
+}
+
+// FilterCreatedAfter keeps projects created at or after t. Projects
+// without a parseable creation time are dropped.
+func FilterCreatedAfter(t time.Time) ProjectFilter {
+	return func(p Project) bool {
+		c, err := time.Parse(time.RFC3339, p.Created)
+		return err == nil && !c.Before(t)
+	}
+}
+
+// ParseDate parses a filter date given as YYYY-MM-DD (midnight UTC) or RFC 3339.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// ProjectQuery holds project filters that the REST projects endpoint can
+// apply server-side, cutting the number of pages fetched. Empty fields are
+// not sent. Servers may return a superset, so callers still apply their
+// ProjectFilters to the results.
+type ProjectQuery struct {
+	Origins   []string // any of these origins
+	Types     []string // any of these project types
+	TargetIDs []string // any of these target IDs
+	Tags      []Tag    // all of these tags
+	// Attribute filters. Each is sent only with exactly one value, since
+	// FilterAttribute matches any of several values.
+	Environment         []string
+	Lifecycle           []string
+	BusinessCriticality []string
+}
+
+// values encodes q as query parameters of /rest/orgs/{id}/projects.
+func (q ProjectQuery) values() url.Values {
+	v := url.Values{}
+	set := func(name string, values []string) {
+		if len(values) > 0 {
+			v.Set(name, strings.Join(values, ","))
+		}
+	}
+	set("origins", q.Origins)
+	set("types", q.Types)
+	set("target_id", q.TargetIDs)
+	var tags []string
+	for _, t := range q.Tags {
+		tags = append(tags, t.Key+":"+t.Value)
+	}
+	set("tags", tags)
+	for name, values := range map[string][]string{
+		"environment":          q.Environment,
+		"lifecycle":            q.Lifecycle,
+		"business_criticality": q.BusinessCriticality,
+	} {
+		if len(values) == 1 {
+			v.Set(name, values[0])
+		}
+	}
+	return v
+}
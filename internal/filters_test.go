@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectFilters(t *testing.T) {
+	p := Project{
+		Type:                "npm",
+		TargetID:            "t1",
+		Status:              "active",
+		Created:             "2024-05-10T10:00:00.000Z",
+		Tags:                []Tag{{Key: "team", Value: "payments"}},
+		Environment:         []string{"frontend", "external"},
+		Lifecycle:           []string{"production"},
+		BusinessCriticality: []string{"high"},
+	}
+	env, err := FilterAttribute("environment", "backend", "external")
+	if err != nil {
+		t.Fatalf("FilterAttribute: %v", err)
+	}
+	crit, err := FilterAttribute("business_criticality", "critical")
+	if err != nil {
+		t.Fatalf("FilterAttribute: %v", err)
+	}
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ProjectFilter
+		want   bool
+	}{
+		{"type match", FilterTypes("maven", "npm"), true},
+		{"type mismatch", FilterTypes("maven"), false},
+		{"target match", FilterTargetIDs("t2", "t1"), true},
+		{"target mismatch", FilterTargetIDs("t2"), false},
+		{"tag match", FilterTag("team", "payments"), true},
+		{"tag value mismatch", FilterTag("team", "search"), false},
+		{"environment any-of", env, true},
+		{"criticality mismatch", crit, false},
+		{"status active", FilterStatus("active"), true},
+		{"status inactive", FilterStatus("inactive"), false},
+		{"created before", FilterCreatedBefore(cutoff), true},
+		{"created after", FilterCreatedAfter(cutoff), false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter(p); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !MatchAll(p, nil) {
+		t.Error("MatchAll with no filters should match")
+	}
+	if MatchAll(p, []ProjectFilter{FilterTypes("npm"), FilterStatus("inactive")}) {
+		t.Error("MatchAll should require every filter to match")
+	}
+	if FilterCreatedBefore(cutoff)(Project{}) {
+		t.Error("project without created timestamp should not match date filters")
+	}
+	if _, err := FilterAttribute("colour", "red"); err == nil {
+		t.Error("FilterAttribute with unknown attribute: want error")
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	d, err := ParseDate("2024-01-01")
+	if err != nil || !d.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseDate(2024-01-01) = %v, %v", d, err)
+	}
+	if _, err := ParseDate("2024-01-01T10:00:00Z"); err != nil {
+		t.Errorf("ParseDate(RFC 3339): %v", err)
+	}
+	if _, err := ParseDate("01/02/2024"); err == nil {
+		t.Error("ParseDate(01/02/2024): want error")
+	}
+}
+
+func TestProjectQueryValues(t *testing.T) {
+	q := ProjectQuery{
+		Origins:     []string{"github", "cli"},
+		Types:       []string{"npm"},
+		TargetIDs:   []string{"t1", "t2"},
+		Tags:        []Tag{{Key: "team", Value: "payments"}, {Key: "env", Value: "prod"}},
+		Environment: []string{"frontend"},
+		Lifecycle:   []string{"production", "development"},
+	}
+	got := q.values()
+	want := map[string]string{
+		"origins":     "github,cli",
+		"types":       "npm",
+		"target_id":   "t1,t2",
+		"tags":        "team:payments,env:prod",
+		"environment": "frontend",
+	}
+	if len(got) != len(want) {
+		t.Errorf("values() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+	if len(ProjectQuery{}.values()) != 0 {
+		t.Errorf("empty query should send no parameters")
+	}
+}
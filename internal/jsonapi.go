@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RESTVersion is the Snyk REST API version requested by this package.
+const RESTVersion = "2025-09-28"
+
+// Resource is a JSON:API resource object with typed attributes and
+// relationships. Use struct{} for parts an endpoint does not need.
+type Resource[A, R any] struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	Attributes    A      `json:"attributes"`
+	Relationships R      `json:"relationships"`
+}
+
+// Relationship is a to-one JSON:API relationship. Some Snyk endpoints embed
+// attributes of the related resource in its linkage, so A may be a struct.
+type Relationship[A any] struct {
+	Data *struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes A      `json:"attributes"`
+	} `json:"data"`
+}
+
+// ID returns the related resource's ID, or "" if the relationship is empty.
+func (r Relationship[A]) ID() string {
+	if r.Data == nil {
+		return ""
+	}
+	return r.Data.ID
+}
+
+// ListOptions shapes a REST list request.
+type ListOptions struct {
+	// Limit is the page size; 0 uses MaxPageSize.
+	Limit int
+	// Include requests related resources in the "included" array.
+	Include []string
+	// Fields requests sparse fieldsets: resource type -> attribute names,
+	// sent as fields[type]=a,b.
+	Fields map[string][]string
+	// Filters are endpoint-specific query parameters (e.g. origins=github).
+	Filters url.Values
+}
+
+// MaxPageSize is the largest page size the Snyk REST API accepts.
+const MaxPageSize = 100
+
+// query encodes the options with the API version.
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	for k, v := range o.Filters {
+		q[k] = append([]string(nil), v...)
+	}
+	q.Set("version", RESTVersion)
+	limit := o.Limit
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	q.Set("limit", strconv.Itoa(limit))
+	if len(o.Include) > 0 {
+		q.Set("include", strings.Join(o.Include, ","))
+	}
+	types := make([]string, 0, len(o.Fields))
+	for t := range o.Fields {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		q.Set("fields["+t+"]", strings.Join(o.Fields[t], ","))
+	}
+	return q
+}
+
+// Page is one page of a REST list response.
+type Page[T any] struct {
+	Data     []T
+	Included []json.RawMessage
+}
+
+// Pages returns an iterator over the pages of the REST list endpoint at path
+// (e.g. "/rest/orgs/{id}/projects"), following links.next. Next links that
+// point at another host are not followed. An error is yielded once and ends
+// the iteration; non-2xx responses are reported as *APIError.
+func Pages[T any](ctx context.Context, c *Client, path string, opts ListOptions) iter.Seq2[Page[T], error] {
+	return func(yield func(Page[T], error) bool) {
+		baseURL := c.BaseURL
+		apiHost := "api.snyk.io"
+		if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
+			apiHost = parsed.Host
+		}
+
+		nextURL := baseURL + path + "?" + opts.query().Encode()
+		for nextURL != "" {
+			req, err := http.NewRequestWithContext(ctx, "GET", nextURL, nil)
+			if err != nil {
+				yield(Page[T]{}, fmt.Errorf("create request: %w", err))
+				return
+			}
+			req.Header.Set("Accept", "application/vnd.api+json")
+
+			resp, body, err := DoWithRetry(ctx, c, req)
+			if err != nil {
+				yield(Page[T]{}, err)
+				return
+			}
+			if resp.StatusCode != 200 {
+				yield(Page[T]{}, newAPIError(resp, body))
+				return
+			}
+
+			var doc struct {
+				Data     []T               `json:"data"`
+				Included []json.RawMessage `json:"included"`
+				Links    struct {
+					Next string `json:"next"`
+				} `json:"links"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				yield(Page[T]{}, fmt.Errorf("decode %s: %w", path, err))
+				return
+			}
+			if !yield(Page[T]{Data: doc.Data, Included: doc.Included}, nil) {
+				return
+			}
+
+			nextURL = ""
+			if next := doc.Links.Next; isAllowedNextURL(next, apiHost) {
+				if strings.HasPrefix(next, "/") {
+					nextURL = baseURL + next
+				} else {
+					nextURL = next
+				}
+			}
+		}
+	}
+}
+
+// Paginate returns an iterator over every resource of a REST list endpoint.
+// See Pages.
+func Paginate[T any](ctx context.Context, c *Client, path string, opts ListOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range Pages[T](ctx, c, path, opts) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Data {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListOptionsQuery(t *testing.T) {
+	q := ListOptions{
+		Limit:   500,
+		Include: []string{"target"},
+		Fields:  map[string][]string{"project": {"name", "origin"}},
+		Filters: url.Values{"origins": {"github"}},
+	}.query()
+	want := map[string]string{
+		"version":         RESTVersion,
+		"limit":           "100",
+		"include":         "target",
+		"fields[project]": "name,origin",
+		"origins":         "github",
+	}
+	for k, v := range want {
+		if got := q.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestPaginate_FollowsNextLinks(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch r.URL.Query().Get("starting_after") {
+		case "":
+			fmt.Fprint(w, `{"data":[{"id":"g1","type":"group","attributes":{"name":"One"}}],"links":{"next":"/rest/groups?version=x&starting_after=g1"}}`)
+		case "g1":
+			// A next link to another host must not be followed.
+			fmt.Fprint(w, `{"data":[{"id":"g2","type":"group","attributes":{"name":"Two"}}],"links":{"next":"https://evil.example.com/rest/groups"}}`)
+		}
+	}))
+	defer srv.Close()
+
+	groups, err := FetchGroups(context.Background(), newTestClient(srv))
+	if err != nil {
+		t.Fatalf("FetchGroups: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "One" || groups[1].ID != "g2" {
+		t.Errorf("groups = %+v", groups)
+	}
+	if len(requests) != 2 {
+		t.Errorf("requests = %v, want 2", requests)
+	}
+}
+
+func TestPaginate_StopsWhenConsumerBreaks(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"data":[{"id":"a%d"},{"id":"b%d"}],"links":{"next":"/rest/things?page=%d"}}`, calls, calls, calls+1)
+	}))
+	defer srv.Close()
+
+	n := 0
+	for _, err := range Paginate[Resource[struct{}, struct{}]](context.Background(), newTestClient(srv), "/rest/things", ListOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestFetchProjectsAndTargets_Testdata(t *testing.T) {
+	serve := func(name string) *httptest.Server {
+		data, err := os.ReadFile(filepath.Join("..", "testdata", name))
+		if err != nil {
+			t.Skipf("testdata: %v", err)
+		}
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+	}
+
+	srv := serve("mock_projects_response.json")
+	defer srv.Close()
+	projects, err := FetchProjects(context.Background(), newTestClient(srv), "org-1")
+	if err != nil {
+		t.Fatalf("FetchProjects: %v", err)
+	}
+	if len(projects) == 0 {
+		t.Fatal("no projects decoded")
+	}
+	p := projects[0]
+	if p.Origin != "github-enterprise" || p.Branch != "main" || p.TargetID != "t0000001-0001-4000-8000-000000000001" {
+		t.Errorf("projects[0] = %+v", p)
+	}
+
+	srv2 := serve("mock_targets_response.json")
+	defer srv2.Close()
+	targets, err := FetchTargets(context.Background(), newTestClient(srv2), "org-1")
+	if err != nil {
+		t.Fatalf("FetchTargets: %v", err)
+	}
+	if len(targets) == 0 || targets[0].IntegrationType != "github-enterprise" || targets[0].IntegrationID != "b0000001-0001-4000-8000-000000000001" {
+		t.Errorf("targets = %+v", targets)
+	}
+}
+
+func TestFetchProjects_NotFoundIsEmpty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	projects, err := FetchProjects(context.Background(), newTestClient(srv), "org-1")
+	if err != nil || len(projects) != 0 {
+		t.Errorf("got %v, %v", projects, err)
+	}
+}
+
+func TestFetchOrgs_Testdata(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "testdata", "mock_orgs_response.json"))
+	if err != nil {
+		t.Skipf("testdata: %v", err)
+	}
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/orgs" {
+			t.Errorf("path = %s, want /rest/orgs", r.URL.Path)
+		}
+		query = r.URL.Query()
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	orgs, err := FetchOrgs(context.Background(), newTestClient(srv), OrgQuery{GroupID: "g1", Slug: "mock-org"})
+	if err != nil {
+		t.Fatalf("FetchOrgs: %v", err)
+	}
+	if query.Get("group_id") != "g1" || query.Get("slug") != "mock-org" || query.Has("name") {
+		t.Errorf("query = %v", query)
+	}
+	if len(orgs) != 3 {
+		t.Fatalf("len(orgs) = %d, want 3", len(orgs))
+	}
+	want := Org{
+		ID:      "a0000001-0001-4000-8000-000000000001",
+		Name:    "Example Org",
+		Slug:    "example-org",
+		GroupID: "a0000001-0001-4000-8000-000000000001",
+		Created: "2024-01-15T12:00:00.000Z",
+	}
+	if orgs[0] != want {
+		t.Errorf("orgs[0] = %+v, want %+v", orgs[0], want)
+	}
+}
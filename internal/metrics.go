@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Names of the API request metrics recorded by Metrics.ObserveRequest.
+const (
+	MetricAPIRequests        = "snyk_target_export_api_requests_total"
+	MetricAPIRetries         = "snyk_target_export_api_retries_total"
+	MetricAPIRateLimited     = "snyk_target_export_api_rate_limited_total"
+	MetricAPIRequestDuration = "snyk_target_export_api_request_duration_seconds"
+)
+
+// DefaultLatencyBuckets are the histogram buckets, in seconds, for API request latency.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics is a minimal metrics registry rendered in the Prometheus text
+// exposition format, for a node_exporter textfile or a Pushgateway. Metrics
+// must be registered before they are updated. It is safe for concurrent use.
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name, help, kind string
+	buckets          []float64 // histograms only
+	series           map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels string    // rendered label pairs, without braces
+	value  float64   // counter or gauge value; histogram sum
+	counts []float64 // histogram bucket counts (not cumulative)
+	count  float64   // histogram observation count
+}
+
+// NewMetrics returns a registry with the API request metrics registered.
+func NewMetrics() *Metrics {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+	m.Counter(MetricAPIRequests, "Snyk API request attempts by method, endpoint and status (0 = no response).")
+	m.Counter(MetricAPIRetries, "Snyk API request attempts that were retries.")
+	m.Counter(MetricAPIRateLimited, "Snyk API responses with status 429.")
+	m.Histogram(MetricAPIRequestDuration, "Snyk API request attempt latency.", DefaultLatencyBuckets)
+	return m
+}
+
+// Counter registers a counter.
+func (m *Metrics) Counter(name, help string) { m.register(name, help, "counter", nil) }
+
+// Gauge registers a gauge.
+func (m *Metrics) Gauge(name, help string) { m.register(name, help, "gauge", nil) }
+
+// Histogram registers a histogram with the given upper bounds.
+func (m *Metrics) Histogram(name, help string, buckets []float64) {
+	m.register(name, help, "histogram", buckets)
+}
+
+func (m *Metrics) register(name, help, kind string, buckets []float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families[name] = &metricFamily{name: name, help: help, kind: kind, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// Add adds v to a counter or gauge. labels are name/value pairs.
+func (m *Metrics) Add(name string, v float64, labels ...string) {
+	m.update(name, labels, func(f *metricFamily, s *metricSeries) { s.value += v })
+}
+
+// Set sets a gauge. labels are name/value pairs.
+func (m *Metrics) Set(name string, v float64, labels ...string) {
+	m.update(name, labels, func(f *metricFamily, s *metricSeries) { s.value = v })
+}
+
+// Observe records v in a histogram. labels are name/value pairs.
+func (m *Metrics) Observe(name string, v float64, labels ...string) {
+	m.update(name, labels, func(f *metricFamily, s *metricSeries) {
+		if s.counts == nil {
+			s.counts = make([]float64, len(f.buckets))
+		}
+		for i, le := range f.buckets {
+			if v <= le {
+				s.counts[i]++
+				break
+			}
+		}
+		s.value += v
+		s.count++
+	})
+}
+
+func (m *Metrics) update(name string, labels []string, fn func(*metricFamily, *metricSeries)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.families[name]
+	if !ok {
+		panic("metrics: " + name + " is not registered")
+	}
+	key := renderLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: key}
+		f.series[key] = s
+	}
+	fn(f, s)
+}
+
+// renderLabels renders name/value pairs as `a="1",b="2"`.
+func renderLabels(pairs []string) string {
+	if len(pairs)%2 != 0 {
+		panic("metrics: labels must be name/value pairs")
+	}
+	var b strings.Builder
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// ObserveRequest records one API request attempt; use it as (part of)
+// Client.OnRequest.
+func (m *Metrics) ObserveRequest(info RequestInfo) {
+	endpoint := Endpoint(info.Path)
+	m.Add(MetricAPIRequests, 1, "method", info.Method, "endpoint", endpoint, "status", strconv.Itoa(info.Status))
+	if info.Attempt > 1 {
+		m.Add(MetricAPIRetries, 1, "endpoint", endpoint)
+	}
+	if info.Status == http.StatusTooManyRequests {
+		m.Add(MetricAPIRateLimited, 1, "endpoint", endpoint)
+	}
+	m.Observe(MetricAPIRequestDuration, info.Duration.Seconds(), "method", info.Method, "endpoint", endpoint)
+}
+
+// idParents are the path segments followed by an ID in Snyk API paths.
+var idParents = map[string]bool{"org": true, "orgs": true, "group": true, "groups": true, "projects": true, "project": true, "targets": true}
+
+// Endpoint returns path with IDs replaced by {id}, e.g.
+// /rest/orgs/{id}/projects, to keep metric label cardinality low.
+func Endpoint(path string) string {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if idParents[parts[i-1]] && parts[i] != "" {
+			parts[i] = "{id}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// WriteTo writes all metrics in the Prometheus text format, sorted by name
+// and labels.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buf bytes.Buffer
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		if len(f.series) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&buf, "%s%s %s\n", name, braces(s.labels), formatFloat(s.value))
+				continue
+			}
+			var cum float64
+			for i, le := range f.buckets {
+				cum += s.counts[i]
+				fmt.Fprintf(&buf, "%s_bucket%s %s\n", name, braces(joinLabels(s.labels, `le="`+formatFloat(le)+`"`)), formatFloat(cum))
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %s\n", name, braces(joinLabels(s.labels, `le="+Inf"`)), formatFloat(s.count))
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", name, braces(s.labels), formatFloat(s.value))
+			fmt.Fprintf(&buf, "%s_count%s %s\n", name, braces(s.labels), formatFloat(s.count))
+		}
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// WriteFile atomically replaces path with the metrics, readable by other
+// users so a node_exporter textfile collector can pick it up.
+func (m *Metrics) WriteFile(path string) error {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	return os.Chmod(path, 0o644)
+}
+
+// Push replaces the metrics of the given job and grouping labels (name/value
+// pairs) on a Prometheus Pushgateway at baseURL.
+func (m *Metrics) Push(ctx context.Context, httpClient *http.Client, baseURL, job string, grouping ...string) error {
+	u := strings.TrimSuffix(baseURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	for i := 0; i+1 < len(grouping); i += 2 {
+		u += "/" + url.PathEscape(grouping[i]) + "/" + url.PathEscape(grouping[i+1])
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, &buf)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push metrics: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
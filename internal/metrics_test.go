@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpoint(t *testing.T) {
+	for in, want := range map[string]string{
+		"/rest/orgs/o1/projects":    "/rest/orgs/{id}/projects",
+		"/rest/orgs/o1/projects/p1": "/rest/orgs/{id}/projects/{id}",
+		"/v1/org/o1/integrations":   "/v1/org/{id}/integrations",
+		"/rest/groups/g1/orgs":      "/rest/groups/{id}/orgs",
+		"/rest/orgs":                "/rest/orgs",
+		"/rest/self":                "/rest/self",
+	} {
+		if got := Endpoint(in); got != want {
+			t.Errorf("Endpoint(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest(RequestInfo{Method: "GET", Path: "/rest/orgs/o1/projects", Attempt: 1, Status: 429, Duration: 30 * time.Millisecond})
+	m.ObserveRequest(RequestInfo{Method: "GET", Path: "/rest/orgs/o2/projects", Attempt: 2, Status: 200, Duration: 2 * time.Second})
+	m.Gauge("run_info", "Label \"escaping\".")
+	m.Set("run_info", 1, "version", `a"b`)
+
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE snyk_target_export_api_requests_total counter\n",
+		`snyk_target_export_api_requests_total{method="GET",endpoint="/rest/orgs/{id}/projects",status="200"} 1` + "\n",
+		`snyk_target_export_api_requests_total{method="GET",endpoint="/rest/orgs/{id}/projects",status="429"} 1` + "\n",
+		`snyk_target_export_api_retries_total{endpoint="/rest/orgs/{id}/projects"} 1` + "\n",
+		`snyk_target_export_api_rate_limited_total{endpoint="/rest/orgs/{id}/projects"} 1` + "\n",
+		`snyk_target_export_api_request_duration_seconds_bucket{method="GET",endpoint="/rest/orgs/{id}/projects",le="0.05"} 1` + "\n",
+		`snyk_target_export_api_request_duration_seconds_bucket{method="GET",endpoint="/rest/orgs/{id}/projects",le="1"} 1` + "\n",
+		`snyk_target_export_api_request_duration_seconds_bucket{method="GET",endpoint="/rest/orgs/{id}/projects",le="2.5"} 2` + "\n",
+		`snyk_target_export_api_request_duration_seconds_bucket{method="GET",endpoint="/rest/orgs/{id}/projects",le="+Inf"} 2` + "\n",
+		`snyk_target_export_api_request_duration_seconds_sum{method="GET",endpoint="/rest/orgs/{id}/projects"} 2.03` + "\n",
+		`snyk_target_export_api_request_duration_seconds_count{method="GET",endpoint="/rest/orgs/{id}/projects"} 2` + "\n",
+		`run_info{version="a\"b"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "run_info") > strings.Index(out, "snyk_target_export_api_rate_limited_total") {
+		t.Error("families are not sorted by name")
+	}
+}
+
+func TestMetrics_WriteFileAndPush(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest(RequestInfo{Method: "GET", Path: "/rest/self", Attempt: 1, Status: 200})
+
+	path := filepath.Join(t.TempDir(), "snyk.prom")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `endpoint="/rest/self"`) {
+		t.Errorf("metrics file = %q, %v", data, err)
+	}
+
+	var gotPath, gotMethod, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotMethod, gotBody = r.URL.Path, r.Method, string(body)
+	}))
+	defer srv.Close()
+	if err := m.Push(context.Background(), srv.Client(), srv.URL+"/", "snyk_target_export", "command", "refresh"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if gotMethod != "PUT" || gotPath != "/metrics/job/snyk_target_export/command/refresh" || gotBody != string(data) {
+		t.Errorf("push: %s %s\n%s", gotMethod, gotPath, gotBody)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	if err := m.Push(context.Background(), failing.Client(), failing.URL, "job"); err == nil || !strings.Contains(err.Error(), "bad metrics") {
+		t.Errorf("push to a failing gateway: err = %v", err)
+	}
+}
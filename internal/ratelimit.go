@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default rate limit: ~2 requests per second with no burst, which keeps
+// a single run well inside Snyk's default per-token limits.
+const (
+	DefaultRPS   = 2.0
+	DefaultBurst = 1
+)
+
+// RateLimiter is a token-bucket rate limiter owned by a Client. It starts at
+// a configured rate and burst, and adapts to the rate-limit headers returned
+// by the API: when the server reports few requests remaining in the current
+// window it slows down to spread them until the reset, pauses entirely when
+// none are left, and returns to the configured rate once there is headroom.
+type RateLimiter struct {
+	mu         sync.Mutex
+	rps        float64 // configured rate; <= 0 disables limiting
+	burst      int
+	rate       float64 // current effective rate (<= rps)
+	tokens     float64
+	last       time.Time
+	pauseUntil time.Time
+
+	// Last values observed from rate-limit headers (-1 = unknown).
+	limit     int
+	remaining int
+	resetAt   time.Time
+
+	now func() time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second with the
+// given burst. rps <= 0 disables rate limiting; burst < 1 is treated as 1.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	rl := &RateLimiter{
+		rps:       rps,
+		burst:     burst,
+		rate:      rps,
+		tokens:    float64(burst),
+		limit:     -1,
+		remaining: -1,
+		now:       time.Now,
+	}
+	rl.last = rl.now()
+	return rl
+}
+
+// Wait blocks until a request may be made or ctx is done.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := rl.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token if one is available and returns 0, or returns how
+// long to wait before trying again.
+func (rl *RateLimiter) reserve() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rps <= 0 {
+		return 0
+	}
+	now := rl.now()
+	if now.Before(rl.pauseUntil) {
+		return rl.pauseUntil.Sub(now)
+	}
+	rl.refill(now)
+	if rl.tokens >= 1 {
+		rl.tokens--
+		return 0
+	}
+	return time.Duration((1 - rl.tokens) / rl.rate * float64(time.Second))
+}
+
+// refill adds tokens for the time elapsed since the last call. Caller holds mu.
+func (rl *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(rl.last).Seconds()
+	rl.last = now
+	if elapsed <= 0 {
+		return
+	}
+	rl.tokens += elapsed * rl.rate
+	if rl.tokens > float64(rl.burst) {
+		rl.tokens = float64(rl.burst)
+	}
+}
+
+// minAdaptiveRPS is the slowest rate the limiter adapts down to while the
+// server still reports requests remaining.
+const minAdaptiveRPS = 0.05
+
+// Observe updates the limiter from a response's rate-limit headers. Both the
+// X-RateLimit-* and the IETF draft RateLimit-* forms are understood; the
+// reset value may be delta seconds or a Unix timestamp.
+func (rl *RateLimiter) Observe(h http.Header) {
+	remaining, okRemaining := headerInt(h, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	limit, okLimit := headerInt(h, "X-RateLimit-Limit", "RateLimit-Limit")
+	reset, okReset := headerInt(h, "X-RateLimit-Reset", "RateLimit-Reset")
+	if !okRemaining && !okLimit && !okReset {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	rl.refill(now)
+	if okLimit {
+		rl.limit = limit
+	}
+	if okRemaining {
+		rl.remaining = remaining
+	}
+	if okReset {
+		if reset > 1_000_000_000 {
+			rl.resetAt = time.Unix(int64(reset), 0)
+		} else {
+			rl.resetAt = now.Add(time.Duration(reset) * time.Second)
+		}
+	}
+	if rl.rps <= 0 || !okRemaining {
+		return
+	}
+
+	window := rl.resetAt.Sub(now).Seconds()
+	switch {
+	case remaining <= 0 && window > 0:
+		// Out of budget: stop until the window resets.
+		rl.pauseUntil = rl.resetAt
+		rl.tokens = 0
+	case window > 0:
+		// Spread what is left over the rest of the window, never faster
+		// than configured and never slower than minAdaptiveRPS.
+		allowed := float64(remaining) / window
+		rl.rate = rl.rps
+		if allowed < rl.rps {
+			rl.rate = allowed
+			if rl.rate < minAdaptiveRPS {
+				rl.rate = minAdaptiveRPS
+			}
+		}
+	default:
+		rl.rate = rl.rps
+	}
+}
+
+// headerInt returns the first of names present in h as an int.
+func headerInt(h http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// RateLimiterState is a snapshot of a RateLimiter for logging.
+type RateLimiterState struct {
+	ConfiguredRPS float64
+	EffectiveRPS  float64
+	Burst         int
+	Tokens        float64
+	Limit         int // -1 if the server has not reported it
+	Remaining     int // -1 if the server has not reported it
+	ResetAt       time.Time
+	PausedUntil   time.Time
+}
+
+// State returns a snapshot of the limiter's current state.
+func (rl *RateLimiter) State() RateLimiterState {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.refill(rl.now())
+	return RateLimiterState{
+		ConfiguredRPS: rl.rps,
+		EffectiveRPS:  rl.rate,
+		Burst:         rl.burst,
+		Tokens:        rl.tokens,
+		Limit:         rl.limit,
+		Remaining:     rl.remaining,
+		ResetAt:       rl.resetAt,
+		PausedUntil:   rl.pauseUntil,
+	}
+}
+
+func (s RateLimiterState) String() string {
+	if s.ConfiguredRPS <= 0 {
+		return "unlimited"
+	}
+	out := fmt.Sprintf("rate=%.2f/s (configured %.2f/s, burst %d)", s.EffectiveRPS, s.ConfiguredRPS, s.Burst)
+	if s.Remaining >= 0 {
+		out += fmt.Sprintf(" remaining=%d", s.Remaining)
+		if s.Limit >= 0 {
+			out += fmt.Sprintf("/%d", s.Limit)
+		}
+	}
+	if !s.ResetAt.IsZero() {
+		out += " reset=" + s.ResetAt.Format(time.RFC3339)
+	}
+	if s.PausedUntil.After(time.Now()) {
+		out += " paused until " + s.PausedUntil.Format(time.RFC3339)
+	}
+	return out
+}
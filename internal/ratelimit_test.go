@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter driven by a fake clock.
+func newTestLimiter(rps float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter(rps, burst)
+	rl.now = func() time.Time { return now }
+	rl.last = now
+	return rl, &now
+}
+
+func TestRateLimiter_Burst(t *testing.T) {
+	rl, now := newTestLimiter(2, 3)
+	for i := 0; i < 3; i++ {
+		if d := rl.reserve(); d != 0 {
+			t.Fatalf("request %d within burst: delay %v, want 0", i, d)
+		}
+	}
+	if d := rl.reserve(); d != 500*time.Millisecond {
+		t.Errorf("after burst: delay %v, want 500ms", d)
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if d := rl.reserve(); d != 0 {
+		t.Errorf("after refill: delay %v, want 0", d)
+	}
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	rl, _ := newTestLimiter(0, 1)
+	for i := 0; i < 100; i++ {
+		if d := rl.reserve(); d != 0 {
+			t.Fatalf("unlimited limiter delayed request %d by %v", i, d)
+		}
+	}
+	if s := rl.State().String(); s != "unlimited" {
+		t.Errorf("State() = %q", s)
+	}
+}
+
+func TestRateLimiter_ObserveAdapts(t *testing.T) {
+	rl, now := newTestLimiter(10, 1)
+
+	// 5 requests left for the next 10s: slow down to 0.5 rps
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "100")
+	h.Set("X-RateLimit-Remaining", "5")
+	h.Set("X-RateLimit-Reset", "10")
+	rl.Observe(h)
+	st := rl.State()
+	if st.EffectiveRPS != 0.5 || st.Remaining != 5 || st.Limit != 100 {
+		t.Errorf("after low remaining: %+v", st)
+	}
+
+	// Budget exhausted: pause until reset
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", "30")
+	rl.Observe(h)
+	if d := rl.reserve(); d != 30*time.Second {
+		t.Errorf("exhausted: delay %v, want 30s", d)
+	}
+
+	// After the window resets with plenty remaining, return to configured rate
+	*now = now.Add(31 * time.Second)
+	h.Set("RateLimit-Remaining", "1000")
+	h.Del("X-RateLimit-Remaining")
+	h.Set("X-RateLimit-Reset", "60")
+	rl.Observe(h)
+	if st := rl.State(); st.EffectiveRPS != 10 || st.Remaining != 1000 {
+		t.Errorf("after reset: %+v", st)
+	}
+	if d := rl.reserve(); d != 0 {
+		t.Errorf("after reset: delay %v, want 0", d)
+	}
+}
+
+func TestRateLimiter_ObserveIgnoresMissingHeaders(t *testing.T) {
+	rl, _ := newTestLimiter(2, 1)
+	rl.Observe(http.Header{})
+	if st := rl.State(); st.Remaining != -1 || st.EffectiveRPS != 2 {
+		t.Errorf("state changed without headers: %+v", st)
+	}
+}
+
+func TestRateLimiter_WaitContextCancelled(t *testing.T) {
+	rl := NewRateLimiter(0.001, 1)
+	ctx := context.Background()
+	if err := rl.Wait(ctx); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(ctx); err == nil {
+		t.Error("Wait should fail when the context expires before a token is available")
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// redacted replaces credential header values in recordings.
+const redacted = "REDACTED"
+
+// redactedHeaders are never written to a recording.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Exchange is one recorded HTTP request and its response. Recordings are
+// stored one exchange per file, so they can be trimmed by hand and checked
+// in as test fixtures.
+type Exchange struct {
+	Method         string          `json:"method"`
+	URL            string          `json:"url"`
+	RequestHeader  http.Header     `json:"requestHeader,omitempty"`
+	RequestBody    string          `json:"requestBody,omitempty"`
+	StatusCode     int             `json:"status"`
+	ResponseHeader http.Header     `json:"responseHeader,omitempty"`
+	ResponseJSON   json.RawMessage `json:"responseJson,omitempty"` // body, when it is JSON
+	ResponseText   string          `json:"responseText,omitempty"` // body, otherwise
+}
+
+// key identifies the request an exchange answers: method, path and query.
+// The host is ignored so a recording can be replayed against any base URL.
+func (e Exchange) key() (string, error) {
+	req, err := http.NewRequest(e.Method, e.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	return exchangeKey(req), nil
+}
+
+func exchangeKey(req *http.Request) string {
+	return req.Method + " " + req.URL.RequestURI()
+}
+
+// redactHeader returns a copy of h without credentials.
+func redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, redacted)
+		}
+	}
+	return out
+}
+
+// recordingTransport saves every exchange made through next to dir.
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecordingTransport returns a RoundTripper that sends requests through
+// next (http.DefaultTransport if nil) and writes each request/response pair
+// to a numbered JSON file in dir, with credentials redacted. Every attempt is
+// recorded, including ones that are retried.
+func NewRecordingTransport(next http.RoundTripper, dir string) (http.RoundTripper, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create record dir: %w", err)
+	}
+	return &recordingTransport{next: next, dir: dir}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("record request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("record response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := Exchange{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeader:  redactHeader(req.Header),
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: redactHeader(resp.Header),
+	}
+	if len(reqBody) > 0 {
+		e.RequestBody = string(reqBody)
+	}
+	if json.Valid(body) {
+		e.ResponseJSON = body
+	} else {
+		e.ResponseText = string(body)
+	}
+	if err := t.write(e); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *recordingTransport) write(e Exchange) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode recording: %w", err)
+	}
+	t.mu.Lock()
+	t.seq++
+	name := filepath.Join(t.dir, fmt.Sprintf("%05d.json", t.seq))
+	t.mu.Unlock()
+	if err := os.WriteFile(name, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write recording: %w", err)
+	}
+	return nil
+}
+
+// replayTransport serves recorded exchanges instead of the network.
+type replayTransport struct {
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+}
+
+// NewReplayTransport returns a RoundTripper that answers requests from the
+// recording in dir (see NewRecordingTransport). Requests are matched on
+// method, path and query; exchanges for the same request are served in
+// recorded order and the last one is repeated once the others are used up.
+// A request with no recorded exchange fails.
+func NewReplayTransport(dir string) (http.RoundTripper, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded exchanges in %s", dir)
+	}
+	sort.Strings(files)
+	t := &replayTransport{exchanges: make(map[string][]Exchange)}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read recording: %w", err)
+		}
+		var e Exchange
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("decode recording %s: %w", f, err)
+		}
+		key, err := e.key()
+		if err != nil {
+			return nil, fmt.Errorf("recording %s: %w", f, err)
+		}
+		t.exchanges[key] = append(t.exchanges[key], e)
+	}
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := exchangeKey(req)
+	t.mu.Lock()
+	queue := t.exchanges[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for %s", key)
+	}
+	e := queue[0]
+	if len(queue) > 1 {
+		t.exchanges[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	body := []byte(e.ResponseText)
+	if len(e.ResponseJSON) > 0 {
+		body = e.ResponseJSON
+	}
+	header := e.ResponseHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
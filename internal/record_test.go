@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"data":[{"id":"p1","type":"project"}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := newTestClient(srv)
+	c.Auth = StaticTokenSource("super-secret-token")
+	rec, err := NewRecordingTransport(srv.Client().Transport, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HTTP = &http.Client{Transport: rec}
+	live, err := FetchProjects(context.Background(), c, "org-1")
+	if err != nil {
+		t.Fatalf("FetchProjects (record): %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d exchanges, want 2 (429 then 200)", len(files))
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		if strings.Contains(string(data), "super-secret-token") || strings.Contains(string(data), "session=secret") {
+			t.Errorf("%s contains a credential:\n%s", f, data)
+		}
+	}
+
+	// Replay against a base URL that doesn't exist: the network is never used.
+	replay, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = newTestClient(srv)
+	c.BaseURL = "http://replay.invalid"
+	c.HTTP = &http.Client{Transport: replay}
+	replayed, err := FetchProjects(context.Background(), c, "org-1")
+	if err != nil {
+		t.Fatalf("FetchProjects (replay): %v", err)
+	}
+	if len(replayed) != 1 || len(live) != 1 || replayed[0].ID != live[0].ID {
+		t.Errorf("replayed %+v, live %+v", replayed, live)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server calls = %d, want 2 (replay must not hit the network)", calls.Load())
+	}
+
+	// The last exchange for a request is repeated; unknown requests fail.
+	if _, err := FetchProjects(context.Background(), c, "org-1"); err != nil {
+		t.Errorf("second replay: %v", err)
+	}
+	if _, err := FetchProjects(context.Background(), c, "org-2"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("unrecorded request: err = %v", err)
+	}
+}
+
+func TestNewReplayTransport_EmptyDir(t *testing.T) {
+	if _, err := NewReplayTransport(t.TempDir()); err == nil {
+		t.Error("want error for a directory without recordings")
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Region is a Snyk multi-tenant deployment and its API host.
+type Region struct {
+	Name    string // e.g. "SNYK-EU-01"
+	APIURL  string // e.g. "https://api.eu.snyk.io"
+	AppHost string // web UI host, e.g. "app.eu.snyk.io"
+}
+
+// Regions lists the public Snyk regions.
+var Regions = []Region{
+	{Name: "SNYK-US-01", APIURL: "https://api.snyk.io", AppHost: "app.snyk.io"},
+	{Name: "SNYK-US-02", APIURL: "https://api.us.snyk.io", AppHost: "app.us.snyk.io"},
+	{Name: "SNYK-EU-01", APIURL: "https://api.eu.snyk.io", AppHost: "app.eu.snyk.io"},
+	{Name: "SNYK-AU-01", APIURL: "https://api.au.snyk.io", AppHost: "app.au.snyk.io"},
+}
+
+// RegionForBaseURL returns the public region whose API host matches baseURL.
+// ok is false for private or unknown deployments.
+func RegionForBaseURL(baseURL string) (Region, bool) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return Region{}, false
+	}
+	for _, r := range Regions {
+		if ru, _ := url.Parse(r.APIURL); ru != nil && strings.EqualFold(u.Host, ru.Host) {
+			return r, true
+		}
+	}
+	return Region{}, false
+}
+
+// CheckBaseURL returns problems with a configured API base URL that would
+// make every request fail, such as pointing at the web UI host or
+// including an API path.
+func CheckBaseURL(baseURL string) []string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return []string{fmt.Sprintf("%q is not an absolute URL; expected e.g. https://api.eu.snyk.io", baseURL)}
+	}
+	var problems []string
+	if u.Scheme != "https" {
+		problems = append(problems, fmt.Sprintf("scheme is %q; the Snyk API is only served over https", u.Scheme))
+	}
+	for _, r := range Regions {
+		if strings.EqualFold(u.Host, r.AppHost) {
+			problems = append(problems, fmt.Sprintf("%s is the web UI host; use %s", u.Host, r.APIURL))
+		}
+	}
+	if p := strings.TrimSuffix(u.Path, "/"); p == "/v1" || p == "/rest" || p == "/api" || p == "/api/v1" {
+		problems = append(problems, fmt.Sprintf("remove the %q path: set the base URL only (e.g. %s://%s)", p, u.Scheme, u.Host))
+	}
+	return problems
+}
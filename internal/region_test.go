@@ -0,0 +1,31 @@
+package internal
+
+import "testing"
+
+func TestRegionForBaseURL(t *testing.T) {
+	if r, ok := RegionForBaseURL("https://api.eu.snyk.io"); !ok || r.Name != "SNYK-EU-01" {
+		t.Errorf("eu: got %+v, %v", r, ok)
+	}
+	if _, ok := RegionForBaseURL("https://snyk.internal.example.com"); ok {
+		t.Error("private deployment: want ok=false")
+	}
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		problems int
+	}{
+		{"https://api.snyk.io", 0},
+		{"https://api.au.snyk.io", 0},
+		{"https://app.eu.snyk.io", 1},
+		{"https://api.snyk.io/v1", 1},
+		{"http://api.snyk.io/rest/", 2},
+		{"api.snyk.io", 1},
+	}
+	for _, tt := range tests {
+		if got := CheckBaseURL(tt.url); len(got) != tt.problems {
+			t.Errorf("CheckBaseURL(%q) = %q, want %d problem(s)", tt.url, got, tt.problems)
+		}
+	}
+}
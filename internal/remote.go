@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RemoteRepo is a repository parsed from a CLI project's remote repo URL.
+type RemoteRepo struct {
+	Host  string
+	Owner string // GitHub owner, Bitbucket workspace, Azure project or Bitbucket Server project key
+	Name  string
+	// IntegrationKeys lists the integration types that can import this repo,
+	// most preferred first.
+	IntegrationKeys []string
+}
+
+// ParseRemoteRepoURL parses a remote repository URL as reported by
+// `snyk monitor` (HTTPS, SSH or scp-style git URLs) into a RemoteRepo.
+// Supported hosts are GitHub, GitHub Enterprise, Bitbucket Cloud,
+// Bitbucket Server and Azure Repos. GitLab hosts (gitlab.com and any host
+// whose name contains "gitlab") are rejected. Any other host with an
+// owner/repo path is a GitHub Enterprise candidate; RemoteRepoToTarget
+// only accepts it for a known GitHub Enterprise host.
+func ParseRemoteRepoURL(raw string) (RemoteRepo, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return RemoteRepo{}, false
+	}
+	// scp-style: git@github.com:owner/repo.git
+	if !strings.Contains(raw, "://") {
+		at := strings.Index(raw, "@")
+		colon := strings.Index(raw, ":")
+		if at < 0 || colon < at {
+			return RemoteRepo{}, false
+		}
+		raw = "ssh://" + raw[:colon] + "/" + raw[colon+1:]
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return RemoteRepo{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.Trim(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	segs := strings.Split(path, "/")
+
+	switch {
+	case host == "github.com" || host == "www.github.com":
+		if len(segs) < 2 {
+			return RemoteRepo{}, false
+		}
+		return RemoteRepo{Host: host, Owner: segs[0], Name: segs[1],
+			IntegrationKeys: []string{"github-cloud-app", "github"}}, true
+
+	case host == "bitbucket.org":
+		if len(segs) < 2 {
+			return RemoteRepo{}, false
+		}
+		return RemoteRepo{Host: host, Owner: segs[0], Name: segs[1],
+			IntegrationKeys: []string{"bitbucket-connect-app", "bitbucket-cloud"}}, true
+
+	case host == "dev.azure.com" || host == "ssh.dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com"):
+		// https://dev.azure.com/{org}/{project}/_git/{repo}
+		// https://{org}.visualstudio.com/{project}/_git/{repo}
+		// git@ssh.dev.azure.com:v3/{org}/{project}/{repo}
+		for i, s := range segs {
+			if s == "_git" && i >= 1 && i+1 < len(segs) {
+				return RemoteRepo{Host: host, Owner: segs[i-1], Name: segs[i+1],
+					IntegrationKeys: []string{"azure-repos"}}, true
+			}
+		}
+		if len(segs) == 4 && segs[0] == "v3" {
+			return RemoteRepo{Host: host, Owner: segs[2], Name: segs[3],
+				IntegrationKeys: []string{"azure-repos"}}, true
+		}
+		return RemoteRepo{}, false
+
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		// gitlab.com and self-hosted GitLab (gitlab.<domain>): no importable
+		// integration. Other hosts that merely contain "gitlab" may be GHE.
+		return RemoteRepo{}, false
+
+	default:
+		// Bitbucket Server: /scm/{projectKey}/{repo}.git or /projects/{key}/repos/{repo}
+		for i, s := range segs {
+			if s == "scm" && i+2 < len(segs) {
+				return RemoteRepo{Host: host, Owner: segs[i+1], Name: segs[i+2],
+					IntegrationKeys: []string{"bitbucket-server"}}, true
+			}
+			if strings.EqualFold(s, "projects") && i+3 < len(segs) && segs[i+2] == "repos" {
+				return RemoteRepo{Host: host, Owner: segs[i+1], Name: segs[i+3],
+					IntegrationKeys: []string{"bitbucket-server"}}, true
+			}
+		}
+		if len(segs) != 2 || segs[0] == "" || segs[1] == "" {
+			return RemoteRepo{}, false
+		}
+		return RemoteRepo{Host: host, Owner: segs[0], Name: segs[1],
+			IntegrationKeys: []string{"github-enterprise"}}, true
+	}
+}
+
+// RemoteRepoToTarget converts a CLI project's remote repo URL into an SCM
+// import Target, matched against the org's integrations (as returned by
+// ListIntegrations). gheHosts are the GitHub Enterprise hosts; a repo on
+// any other unrecognized host is not converted, so a Gitea or other
+// server's repo is never pointed at the github-enterprise integration.
+// Returns the target and the integration key it was matched to, or
+// ok=false if the URL is unparseable or the org has no integration of a
+// suitable type.
+func RemoteRepoToTarget(remoteURL, branch string, integrations map[string]string, gheHosts []string) (t Target, integrationKey string, ok bool) {
+	repo, ok := ParseRemoteRepoURL(remoteURL)
+	if !ok {
+		return Target{}, "", false
+	}
+	for _, key := range repo.IntegrationKeys {
+		if integrations[key] == "" {
+			continue
+		}
+		if key == "github-enterprise" && !containsHost(gheHosts, repo.Host) {
+			continue
+		}
+		if key == "bitbucket-server" {
+			return Target{ProjectKey: repo.Owner, RepoSlug: repo.Name}, key, true
+		}
+		return Target{Owner: repo.Owner, Name: repo.Name, Branch: branch}, key, true
+	}
+	return Target{}, "", false
+}
+
+// containsHost reports whether host is in hosts, ignoring case and ports.
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if u, err := url.Parse("//" + strings.TrimSpace(h)); err == nil && strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package internal
+
+import "testing"
+
+func TestParseRemoteRepoURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		wantOK   bool
+		owner    string
+		name     string
+		firstKey string
+	}{
+		{"https://github.com/acme/api.git", true, "acme", "api", "github-cloud-app"},
+		{"git@github.com:acme/api.git", true, "acme", "api", "github-cloud-app"},
+		{"https://github.example.com/acme/api", true, "acme", "api", "github-enterprise"},
+		{"https://bitbucket.org/workspace/repo.git", true, "workspace", "repo", "bitbucket-connect-app"},
+		{"https://dev.azure.com/myorg/myproject/_git/myrepo", true, "myproject", "myrepo", "azure-repos"},
+		{"https://myorg.visualstudio.com/myproject/_git/myrepo", true, "myproject", "myrepo", "azure-repos"},
+		{"git@ssh.dev.azure.com:v3/myorg/myproject/myrepo", true, "myproject", "myrepo", "azure-repos"},
+		{"https://bitbucket.example.com/scm/PROJ/repo.git", true, "PROJ", "repo", "bitbucket-server"},
+		{"https://bitbucket.example.com/projects/PROJ/repos/repo/browse", true, "PROJ", "repo", "bitbucket-server"},
+		{"", false, "", "", ""},
+		{"not a url", false, "", "", ""},
+		{"https://github.com/acme", false, "", "", ""},
+		{"https://git.example.com/a/b/c", false, "", "", ""},
+		{"https://gitlab.com/acme/api.git", false, "", "", ""},
+		{"git@gitlab.example.com:acme/api.git", false, "", "", ""},
+		{"https://ghe-gitlab-migration.example.com/acme/api", true, "acme", "api", "github-enterprise"},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRemoteRepoURL(tt.url)
+		if ok != tt.wantOK {
+			t.Errorf("ParseRemoteRepoURL(%q) ok = %v, want %v", tt.url, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.Owner != tt.owner || got.Name != tt.name || got.IntegrationKeys[0] != tt.firstKey {
+			t.Errorf("ParseRemoteRepoURL(%q) = %+v, want owner=%q name=%q key=%q", tt.url, got, tt.owner, tt.name, tt.firstKey)
+		}
+	}
+}
+
+func TestRemoteRepoToTarget(t *testing.T) {
+	integrations := map[string]string{"github": "int-gh", "bitbucket-server": "int-bbs", "github-enterprise": "int-ghe"}
+
+	// Falls back to "github" when no github-cloud-app integration exists
+	got, key, ok := RemoteRepoToTarget("https://github.com/acme/api", "main", integrations, nil)
+	if !ok || key != "github" {
+		t.Fatalf("github: ok=%v key=%q", ok, key)
+	}
+	if want := (Target{Owner: "acme", Name: "api", Branch: "main"}); got != want {
+		t.Errorf("github: got %+v, want %+v", got, want)
+	}
+
+	// Bitbucket Server uses projectKey/repoSlug and ignores branch
+	got, key, ok = RemoteRepoToTarget("https://bb.example.com/scm/PROJ/repo.git", "main", integrations, nil)
+	if !ok || key != "bitbucket-server" {
+		t.Fatalf("bitbucket-server: ok=%v key=%q", ok, key)
+	}
+	if want := (Target{ProjectKey: "PROJ", RepoSlug: "repo"}); got != want {
+		t.Errorf("bitbucket-server: got %+v, want %+v", got, want)
+	}
+
+	// No matching integration in the org
+	if _, _, ok := RemoteRepoToTarget("https://dev.azure.com/o/p/_git/r", "", integrations, nil); ok {
+		t.Error("azure-repos without integration should not convert")
+	}
+
+	// GitHub Enterprise only for the given hosts
+	gheHosts := []string{"GitHub.Example.com:8443"}
+	if _, key, ok := RemoteRepoToTarget("git@github.example.com:acme/api.git", "", integrations, gheHosts); !ok || key != "github-enterprise" {
+		t.Errorf("ghe host: ok=%v key=%q", ok, key)
+	}
+	if _, _, ok := RemoteRepoToTarget("https://gitea.example.com/acme/api", "", integrations, gheHosts); ok {
+		t.Error("unknown host should not convert to github-enterprise")
+	}
+	if _, _, ok := RemoteRepoToTarget("https://gitlab.com/acme/api", "", integrations, []string{"gitlab.com"}); ok {
+		t.Error("gitlab.com remote should not convert")
+	}
+	if _, key, ok := RemoteRepoToTarget("https://ghe-gitlab-migration.example.com/acme/api", "", integrations, []string{"ghe-gitlab-migration.example.com"}); !ok || key != "github-enterprise" {
+		t.Errorf("listed ghe host containing gitlab: ok=%v key=%q", ok, key)
+	}
+}
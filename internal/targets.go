@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -40,6 +41,57 @@ func IsSCMOrigin(origin string) bool {
 	return scmOrigins[origin]
 }
 
+// SCMOrigins returns the supported SCM origins, sorted.
+func SCMOrigins() []string {
+	return sortedKeys(scmOrigins)
+}
+
+// Container registry origin values. snyk-api-import accepts these as
+// image-name targets ({"name": "repo:tag"}) on the matching registry
+// integration. They are opt-in: refresh only exports them when asked.
+var containerOrigins = map[string]bool{
+	"docker-hub":     true,
+	"ecr":            true,
+	"acr":            true,
+	"gcr":            true,
+	"artifactory-cr": true,
+	"harbor-cr":      true,
+	"quay-cr":        true,
+}
+
+// IsContainerOrigin returns true if the origin is a supported container registry type.
+func IsContainerOrigin(origin string) bool {
+	return containerOrigins[origin]
+}
+
+// ContainerOrigins returns the supported container registry origins, sorted.
+func ContainerOrigins() []string {
+	return sortedKeys(containerOrigins)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// OriginsForIntegration returns the project origins whose projects belong to
+// the integration with the given key (the inverse of OriginToIntegrationKey),
+// e.g. "bitbucket-connect-app" -> bitbucket-connect-app, bitbucket-cloud-app.
+func OriginsForIntegration(key string) []string {
+	origins := []string{key}
+	for origin := range scmOrigins {
+		if origin != key && OriginToIntegrationKey(origin) == key {
+			origins = append(origins, origin)
+		}
+	}
+	sort.Strings(origins[1:])
+	return origins
+}
+
 // OriginToIntegrationKey maps a project origin to the integration key
 // used by ListIntegrations. Most are 1:1. The Snyk API uses
 // "bitbucket-connect-app" as the key for the Bitbucket Cloud App
@@ -54,7 +106,8 @@ func OriginToIntegrationKey(origin string) string {
 
 // ProjectToTarget converts a Snyk project into an import Target.
 // Returns (target, true) on success, or (Target{}, false) if the
-// origin is unsupported (e.g. GitLab).
+// origin is unsupported (e.g. GitLab). Container registry projects
+// become image-name targets; branch is ignored for them.
 func ProjectToTarget(name, origin, branch string) (Target, bool) {
 	switch origin {
 	case "github", "github-cloud-app", "github-enterprise",
@@ -90,8 +143,17 @@ func ProjectToTarget(name, origin, branch string) (Target, bool) {
 			RepoSlug:   repoSlug,
 		}, true
 
+	case "docker-hub", "ecr", "acr", "gcr", "artifactory-cr", "harbor-cr", "quay-cr":
+		// Name format: "repo:tag", optionally followed by ":/path/to/app/manifest"
+		// for application projects found inside the image.
+		image := strings.SplitN(name, ":/", 2)[0]
+		if image == "" {
+			return Target{}, false
+		}
+		return Target{Name: image}, true
+
 	default:
-		// Unsupported origin (e.g. gitlab, cli, docker-hub)
+		// Unsupported origin (e.g. gitlab, cli, kubernetes)
 		return Target{}, false
 	}
 }
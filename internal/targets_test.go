@@ -1,6 +1,9 @@
 package internal
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestIsSCMOrigin(t *testing.T) {
 	supported := []string{
@@ -172,7 +175,7 @@ func TestProjectToTarget_BitbucketServer(t *testing.T) {
 }
 
 func TestProjectToTarget_Unsupported(t *testing.T) {
-	origins := []string{"gitlab", "cli", "docker-hub", ""}
+	origins := []string{"gitlab", "cli", "kubernetes", ""}
 	for _, origin := range origins {
 		_, ok := ProjectToTarget("owner/repo:file", origin, "main")
 		if ok {
@@ -181,6 +184,46 @@ func TestProjectToTarget_Unsupported(t *testing.T) {
 	}
 }
 
+func TestIsContainerOrigin(t *testing.T) {
+	for _, origin := range []string{"docker-hub", "ecr", "acr", "gcr", "artifactory-cr", "harbor-cr", "quay-cr"} {
+		if !IsContainerOrigin(origin) {
+			t.Errorf("IsContainerOrigin(%q) = false, want true", origin)
+		}
+		if IsSCMOrigin(origin) {
+			t.Errorf("IsSCMOrigin(%q) = true, want false", origin)
+		}
+	}
+	for _, origin := range []string{"github", "cli", "kubernetes", ""} {
+		if IsContainerOrigin(origin) {
+			t.Errorf("IsContainerOrigin(%q) = true, want false", origin)
+		}
+	}
+}
+
+func TestProjectToTarget_Container(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		want   Target
+	}{
+		{"library/nginx:1.25", "docker-hub", Target{Name: "library/nginx:1.25"}},
+		{"team/app:latest", "ecr", Target{Name: "team/app:latest"}},
+		// Application projects inside an image carry a ":/path" suffix
+		{"team/app:latest:/app/package.json", "acr", Target{Name: "team/app:latest"}},
+		{"project/image:v2", "gcr", Target{Name: "project/image:v2"}},
+	}
+	for _, tt := range tests {
+		got, ok := ProjectToTarget(tt.name, tt.origin, "main")
+		if !ok {
+			t.Errorf("ProjectToTarget(%q, %q) ok = false, want true", tt.name, tt.origin)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ProjectToTarget(%q, %q) = %+v, want %+v", tt.name, tt.origin, got, tt.want)
+		}
+	}
+}
+
 func TestProjectToTarget_AzureRepos(t *testing.T) {
 	got, ok := ProjectToTarget("myorg/myproject:src/package.json", "azure-repos", "develop")
 	if !ok {
@@ -219,3 +262,19 @@ func TestTargetID(t *testing.T) {
 		t.Error("TargetIDs should differ for different integrations")
 	}
 }
+
+func TestOriginsForIntegration(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"github", "github"},
+		{"bitbucket-connect-app", "bitbucket-connect-app,bitbucket-cloud-app"},
+		{"docker-hub", "docker-hub"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(OriginsForIntegration(tt.key), ","); got != tt.want {
+			t.Errorf("OriginsForIntegration(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer records spans in memory and exports them to an OpenTelemetry
+// collector with OTLP/HTTP JSON. It is safe for concurrent use.
+type Tracer struct {
+	service string
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewTracer returns a tracer whose spans carry the given service.name.
+func NewTracer(service string) *Tracer {
+	return &Tracer{service: service}
+}
+
+// Span is one timed operation. Attributes may be added until End.
+type Span struct {
+	tracer   *Tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	err      error
+}
+
+// OTLP span kinds.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+type spanContextKey struct{}
+
+// SpanFromContext returns the span stored in ctx by Tracer.Start, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// Start begins a span named name, a child of the span in ctx if any, and
+// returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := t.newSpan(SpanFromContext(ctx), name, spanKindInternal, time.Now())
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func (t *Tracer) newSpan(parent *Span, name string, kind int, start time.Time) *Span {
+	s := &Span{tracer: t, spanID: randomHex(8), name: name, kind: kind, start: start, attrs: make(map[string]any)}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+// SetAttr sets an attribute; v should be a string, bool, int or float64.
+func (s *Span) SetAttr(key string, v any) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.attrs[key] = v
+}
+
+// End finishes the span, marking it as failed if err is non-nil.
+func (s *Span) End(err error) {
+	s.finish(time.Now(), err)
+}
+
+func (s *Span) finish(end time.Time, err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.end, s.err = end, err
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// RecordRequest records a client span for one API request attempt, as a
+// child of the span in ctx; use it as (part of) Client.OnRequest.
+func (t *Tracer) RecordRequest(ctx context.Context, info RequestInfo) {
+	s := t.newSpan(SpanFromContext(ctx), info.Method+" "+Endpoint(info.Path), spanKindClient, info.Start)
+	s.attrs["http.request.method"] = info.Method
+	s.attrs["url.path"] = info.Path
+	s.attrs["http.request.resend_count"] = info.Attempt - 1
+	if info.Status != 0 {
+		s.attrs["http.response.status_code"] = info.Status
+	}
+	if info.OrgID != "" {
+		s.attrs["snyk.org_id"] = info.OrgID
+	}
+	err := info.Err
+	if err == nil && info.Status >= 400 {
+		err = fmt.Errorf("status %d", info.Status)
+	}
+	s.finish(info.Start.Add(info.Duration), err)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Export sends the finished spans to endpoint, the collector's base URL
+// (e.g. http://localhost:4318) or its full /v1/traces URL, and forgets them.
+func (t *Tracer) Export(ctx context.Context, httpClient *http.Client, endpoint string) error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	body, err := json.Marshal(t.otlpRequest(spans))
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("export traces: %w", err)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	u := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(u, "/v1/traces") {
+		u += "/v1/traces"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("export traces: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("export traces: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("export traces: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// OTLP/JSON encoding of an ExportTraceServiceRequest. IDs are hex and
+// 64-bit integers are decimal strings, as the OTLP JSON mapping requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 1 = OK, 2 = ERROR
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// otlpRequest encodes spans. Caller holds t.mu.
+func (t *Tracer) otlpRequest(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": t.service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: t.service}, Spans: out}},
+	}}}
+}
+
+// otlpAttributes encodes attrs as OTLP key/values, sorted by key.
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
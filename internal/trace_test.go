@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracer_Export(t *testing.T) {
+	var got otlpRequest
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("body is not JSON: %s", body)
+		}
+	}))
+	defer srv.Close()
+
+	tr := NewTracer("svc")
+	ctx, run := tr.Start(context.Background(), "refresh")
+	orgCtx, org := tr.Start(ctx, "org")
+	org.SetAttr("snyk.org_id", "o1")
+	start := time.Unix(100, 0)
+	tr.RecordRequest(orgCtx, RequestInfo{Method: "GET", Path: "/rest/orgs/o1/projects", OrgID: "o1", Attempt: 2, Status: 503, Start: start, Duration: time.Second})
+	org.End(errors.New("fetch projects: boom"))
+	run.End(nil)
+
+	if err := tr.Export(context.Background(), srv.Client(), srv.URL); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if gotPath != "/v1/traces" {
+		t.Errorf("path = %s", gotPath)
+	}
+	rs := got.ResourceSpans[0]
+	if rs.Resource.Attributes[0].Key != "service.name" || rs.Resource.Attributes[0].Value["stringValue"] != "svc" {
+		t.Errorf("resource = %+v", rs.Resource)
+	}
+	spans := map[string]otlpSpan{}
+	for _, s := range rs.ScopeSpans[0].Spans {
+		spans[s.Name] = s
+	}
+	req, orgSpan, runSpan := spans["GET /rest/orgs/{id}/projects"], spans["org"], spans["refresh"]
+	if len(spans) != 3 || len(runSpan.TraceID) != 32 || len(runSpan.SpanID) != 16 || runSpan.ParentSpanID != "" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if orgSpan.ParentSpanID != runSpan.SpanID || req.ParentSpanID != orgSpan.SpanID || req.TraceID != runSpan.TraceID {
+		t.Errorf("span hierarchy: run=%+v org=%+v req=%+v", runSpan, orgSpan, req)
+	}
+	if req.Kind != spanKindClient || req.StartTimeUnixNano != "100000000000" || req.EndTimeUnixNano != "101000000000" || req.Status.Code != 2 {
+		t.Errorf("request span = %+v", req)
+	}
+	if orgSpan.Status.Code != 2 || orgSpan.Status.Message != "fetch projects: boom" || runSpan.Status.Code != 1 {
+		t.Errorf("statuses: org=%+v run=%+v", orgSpan.Status, runSpan.Status)
+	}
+	if len(tr.spans) != 0 {
+		t.Error("exported spans were not forgotten")
+	}
+}
@@ -0,0 +1,95 @@
+// logging.go configures the structured diagnostic logger shared by all
+// subcommands. Logs go to stderr (or --logFile); reports stay on stdout.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logFlags holds the raw values of the logging flags.
+type logFlags struct {
+	level  *string
+	format *string
+	file   *string
+	quiet  *bool
+}
+
+// addLogFlags registers the logging flags on fs.
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		level:  fs.String("logLevel", "info", "Minimum log level: debug, info, warn or error"),
+		format: fs.String("logFormat", "text", "Log format: text or json"),
+		file:   fs.String("logFile", "", "Append logs to this file instead of stderr"),
+		quiet:  fs.Bool("quiet", false, "Only log errors (same as --logLevel=error)"),
+	}
+}
+
+// parseLogLevel converts a --logLevel value.
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid --logLevel %q: expected debug, info, warn or error", s)
+}
+
+// newLogHandler returns a handler writing to w in the given format.
+func newLogHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "text", "":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("invalid --logFormat %q: expected text or json", format)
+}
+
+// setup installs the logger described by the flags as the slog default,
+// which the standard log package also writes through. The returned
+// function closes the log file, if any.
+func (f *logFlags) setup() (func(), error) {
+	level, err := parseLogLevel(*f.level)
+	if err != nil {
+		return nil, err
+	}
+	if *f.quiet {
+		level = slog.LevelError
+	}
+	var w io.Writer = stderr
+	closeFn := func() {}
+	if *f.file != "" {
+		file, err := os.OpenFile(*f.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		w = file
+		closeFn = func() { file.Close() }
+	}
+	h, err := newLogHandler(w, *f.format, level)
+	if err != nil {
+		closeFn()
+		return nil, err
+	}
+	slog.SetDefault(slog.New(h))
+	return closeFn, nil
+}
+
+// orgAttrs returns the standard log attributes for an org.
+func orgAttrs(orgID, label string) slog.Attr {
+	if label == "" || label == orgID {
+		return slog.Group("", slog.String("org_id", orgID))
+	}
+	return slog.Group("", slog.String("org_id", orgID), slog.String("org", label))
+}
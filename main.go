@@ -7,12 +7,16 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/snyk-playground/snyk-target-export/internal"
 )
@@ -28,18 +32,31 @@ func printVersion() {
 	fmt.Printf("snyk-target-export %s (commit: %s, built: %s)\n", version, commit, date)
 }
 
-// validateGroupOrOrg ensures exactly one of groupID or orgID is set.
+// validateGroupOrOrg ensures the orgs are selected either by --orgId or by a
+// group and/or name/slug filters, not both.
 // Returns an error message suitable for stderr; caller should call fs.Usage() and os.Exit(1).
-func validateGroupOrOrg(groupID, orgID string) error {
-	if groupID == "" && orgID == "" {
-		return fmt.Errorf("either --groupId or --orgId is required")
+func validateGroupOrOrg(q internal.OrgQuery, orgID string) error {
+	listing := q != internal.OrgQuery{}
+	if !listing && orgID == "" {
+		return fmt.Errorf("either --groupId, --orgId, --orgName or --orgSlug is required")
 	}
-	if groupID != "" && orgID != "" {
-		return fmt.Errorf("provide either --groupId or --orgId, not both")
+	if listing && orgID != "" {
+		return fmt.Errorf("provide either --orgId or --groupId/--orgName/--orgSlug, not both")
 	}
 	return nil
 }
 
+// addOrgFilterFlags registers --orgName and --orgSlug on fs. groupID is the
+// value of the command's --groupId flag; call the returned function after
+// parsing to get the org query.
+func addOrgFilterFlags(fs *flag.FlagSet, groupID *string) func() internal.OrgQuery {
+	name := fs.String("orgName", "", "Only orgs whose name contains this (with --groupId, or across all orgs the token can access)")
+	slug := fs.String("orgSlug", "", "Only the org with this slug (with --groupId, or across all orgs the token can access)")
+	return func() internal.OrgQuery {
+		return internal.OrgQuery{GroupID: *groupID, Name: *name, Slug: *slug}
+	}
+}
+
 // orgLabel returns a human-readable label for an org (name + slug or just ID).
 func orgLabel(o internal.Org) string {
 	if o.Name != "" {
@@ -51,9 +68,11 @@ func orgLabel(o internal.Org) string {
 // SnykAPI abstracts Snyk API calls so they can be mocked in tests.
 // The real implementation wraps internal.FetchOrgs, ListIntegrations, etc.
 type SnykAPI interface {
-	FetchOrgs(ctx context.Context, groupID string) ([]internal.Org, error)
+	FetchOrgs(ctx context.Context, q internal.OrgQuery) ([]internal.Org, error)
 	ListIntegrations(ctx context.Context, orgID string) (map[string]string, error)
 	FetchProjects(ctx context.Context, orgID string) ([]internal.Project, error)
+	// StreamProjects calls fn with each page of projects matching q as it is fetched.
+	StreamProjects(ctx context.Context, orgID string, q internal.ProjectQuery, fn func([]internal.Project) error) error
 	FetchTargets(ctx context.Context, orgID string) ([]internal.APITarget, error)
 	DeleteProject(ctx context.Context, orgID, projectID string) error
 	DeleteTarget(ctx context.Context, orgID, targetID string) error
@@ -61,60 +80,277 @@ type SnykAPI interface {
 
 // snykAPIClient is the real Snyk API implementation using the internal package.
 type snykAPIClient struct {
-	client *http.Client
-	token  string
+	client *internal.Client
 }
 
-func (c *snykAPIClient) FetchOrgs(ctx context.Context, groupID string) ([]internal.Org, error) {
-	return internal.FetchOrgs(ctx, c.client, c.token, groupID)
+func (c *snykAPIClient) FetchOrgs(ctx context.Context, q internal.OrgQuery) ([]internal.Org, error) {
+	return internal.FetchOrgs(ctx, c.client, q)
 }
 
 func (c *snykAPIClient) ListIntegrations(ctx context.Context, orgID string) (map[string]string, error) {
-	return internal.ListIntegrations(ctx, c.client, c.token, orgID)
+	return internal.ListIntegrations(ctx, c.client, orgID)
 }
 
 func (c *snykAPIClient) FetchProjects(ctx context.Context, orgID string) ([]internal.Project, error) {
-	return internal.FetchProjects(ctx, c.client, c.token, orgID)
+	return internal.FetchProjects(ctx, c.client, orgID)
+}
+
+func (c *snykAPIClient) StreamProjects(ctx context.Context, orgID string, q internal.ProjectQuery, fn func([]internal.Project) error) error {
+	return internal.StreamProjects(ctx, c.client, orgID, q, fn)
 }
 
 func (c *snykAPIClient) FetchTargets(ctx context.Context, orgID string) ([]internal.APITarget, error) {
-	return internal.FetchTargets(ctx, c.client, c.token, orgID)
+	return internal.FetchTargets(ctx, c.client, orgID)
 }
 
 func (c *snykAPIClient) DeleteProject(ctx context.Context, orgID, projectID string) error {
-	return internal.DeleteProject(ctx, c.client, c.token, orgID, projectID)
+	return internal.DeleteProject(ctx, c.client, orgID, projectID)
 }
 
 func (c *snykAPIClient) DeleteTarget(ctx context.Context, orgID, targetID string) error {
-	return internal.DeleteTarget(ctx, c.client, c.token, orgID, targetID)
+	return internal.DeleteTarget(ctx, c.client, orgID, targetID)
 }
 
 // newSnykAPI returns a real SnykAPI implementation for production use.
-func newSnykAPI(client *http.Client, token string) SnykAPI {
-	return &snykAPIClient{client: client, token: token}
+func newSnykAPI(client *internal.Client) SnykAPI {
+	return &snykAPIClient{client: client}
+}
+
+// clientFlags holds the flags that configure the Snyk API client, shared by all subcommands.
+type clientFlags struct {
+	rps   *float64
+	burst *int
+
+	maxRetries     *int
+	initialBackoff *time.Duration
+	maxBackoff     *time.Duration
+	backoffFactor  *float64
+	retryJitter    *bool
+	retryMaxTime   *time.Duration
+
+	timeout             *time.Duration
+	proxy               *string
+	caBundle            *string
+	clientCert          *string
+	clientKey           *string
+	maxIdleConnsPerHost *int
+	maxConnsPerHost     *int
+
+	apiURL        *string
+	tokenFile     *string
+	tokenEnv      *string
+	oauthClientID *string
+	oauthTokenURL *string
+
+	cacheDir     *string
+	cacheTTL     *time.Duration
+	refreshCache *bool
+
+	record *string
+	replay *string
+}
+
+// addClientFlags registers the API client flags on fs.
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	def := internal.DefaultRetryConfig()
+	httpDef := internal.DefaultHTTPOptions()
+	return &clientFlags{
+		rps:   fs.Float64("rps", internal.DefaultRPS, "Maximum Snyk API requests per second (0 = unlimited); lowered automatically from rate-limit headers"),
+		burst: fs.Int("burst", internal.DefaultBurst, "Number of requests that may be sent back-to-back before --rps applies"),
+
+		maxRetries:     fs.Int("maxRetries", def.MaxRetries, "Maximum retries per API request on 429, 5xx and network errors"),
+		initialBackoff: fs.Duration("retryInitialBackoff", def.InitialBackoff, "Backoff before the first retry"),
+		maxBackoff:     fs.Duration("retryMaxBackoff", def.MaxBackoff, "Upper bound for a single backoff"),
+		backoffFactor:  fs.Float64("retryBackoffFactor", def.BackoffFactor, "Multiplier applied to the backoff after each retry"),
+		retryJitter:    fs.Bool("retryJitter", def.Jitter, "Randomize each backoff between zero and its nominal value (full jitter)"),
+		retryMaxTime:   fs.Duration("retryMaxElapsed", def.MaxElapsed, "Maximum total time spent retrying one request (0 = no limit)"),
+
+		timeout:             fs.Duration("timeout", httpDef.Timeout, "Timeout for a single HTTP request"),
+		proxy:               fs.String("proxy", "", "HTTP(S) proxy URL (default: HTTPS_PROXY/HTTP_PROXY/NO_PROXY from the environment)"),
+		caBundle:            fs.String("caBundle", "", "PEM file with extra CA certificates to trust (e.g. a TLS-intercepting proxy)"),
+		clientCert:          fs.String("clientCert", "", "PEM client certificate for mutual TLS (requires --clientKey)"),
+		clientKey:           fs.String("clientKey", "", "PEM private key for --clientCert"),
+		maxIdleConnsPerHost: fs.Int("maxIdleConnsPerHost", httpDef.MaxIdleConnsPerHost, "Maximum idle keep-alive connections kept to the API host"),
+		maxConnsPerHost:     fs.Int("maxConnsPerHost", httpDef.MaxConnsPerHost, "Maximum concurrent connections to the API host (0 = unlimited)"),
+
+		apiURL:        fs.String("apiUrl", "", "Snyk API base URL, e.g. https://api.eu.snyk.io (default: SNYK_API/SNYK_API_URL, else https://api.snyk.io)"),
+		tokenFile:     fs.String("tokenFile", "", "Read the Snyk API token from this file (re-read if it changes)"),
+		tokenEnv:      fs.String("tokenEnv", "", "Read the Snyk API token from this environment variable instead of SNYK_TOKEN"),
+		oauthClientID: fs.String("oauthClientId", "", "OAuth client ID of a service account; the secret is read from SNYK_OAUTH_CLIENT_SECRET"),
+		oauthTokenURL: fs.String("oauthTokenUrl", "", "OAuth token endpoint (default: <API URL>/oauth2/token)"),
+
+		cacheDir:     fs.String("cacheDir", "", "Cache GET responses in this directory and reuse them in later runs (default: no cache)"),
+		cacheTTL:     fs.Duration("cacheTTL", time.Hour, "How long cached responses are reused"),
+		refreshCache: fs.Bool("refreshCache", false, "Ignore cached responses and fetch everything again, updating the cache"),
+
+		record: fs.String("record", "", "Save every API request/response pair (credentials redacted) to this directory"),
+		replay: fs.String("replay", "", "Serve API responses from a --record directory instead of the network; no credentials needed"),
+	}
+}
+
+// newClient builds the Snyk API client described by the flags, including the
+// credential source (see internal.ResolveTokenSource).
+func (f *clientFlags) newClient() (*internal.Client, error) {
+	retry := internal.RetryConfig{
+		MaxRetries:     *f.maxRetries,
+		InitialBackoff: *f.initialBackoff,
+		MaxBackoff:     *f.maxBackoff,
+		BackoffFactor:  *f.backoffFactor,
+		Jitter:         *f.retryJitter,
+		MaxElapsed:     *f.retryMaxTime,
+	}
+	if err := retry.Validate(); err != nil {
+		return nil, fmt.Errorf("retry configuration: %w", err)
+	}
+	httpOpts := internal.DefaultHTTPOptions()
+	httpOpts.Timeout = *f.timeout
+	httpOpts.ProxyURL = *f.proxy
+	httpOpts.CABundle = *f.caBundle
+	httpOpts.ClientCert = *f.clientCert
+	httpOpts.ClientKey = *f.clientKey
+	httpOpts.MaxIdleConnsPerHost = *f.maxIdleConnsPerHost
+	httpOpts.MaxConnsPerHost = *f.maxConnsPerHost
+	httpClient, err := internal.NewHTTPClient(httpOpts)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP client: %w", err)
+	}
+	client := internal.NewClient(httpClient, internal.NewRateLimiter(*f.rps, *f.burst))
+	client.BaseURL = f.baseURL()
+	client.Retry = retry
+	switch {
+	case *f.record != "" && *f.replay != "":
+		return nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	case *f.record != "" && *f.cacheDir != "":
+		// Cache hits never reach the transport, so the recording would have gaps.
+		return nil, fmt.Errorf("--record cannot be combined with --cacheDir")
+	case *f.replay != "":
+		// Replayed responses need no credentials and no network.
+		transport, err := internal.NewReplayTransport(*f.replay)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTP = &http.Client{Timeout: httpClient.Timeout, Transport: transport}
+		return f.withCache(client)
+	}
+	client.Auth, err = internal.ResolveTokenSource(internal.TokenOptions{
+		TokenFile:     *f.tokenFile,
+		TokenEnv:      *f.tokenEnv,
+		OAuthClientID: *f.oauthClientID,
+		OAuthTokenURL: *f.oauthTokenURL,
+	}, httpClient, client.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if *f.record != "" {
+		// Only API traffic is recorded; OAuth token requests keep using
+		// httpClient so client secrets and access tokens never hit the disk.
+		transport, err := internal.NewRecordingTransport(httpClient.Transport, *f.record)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTP = &http.Client{Timeout: httpClient.Timeout, Transport: transport}
+	}
+	return f.withCache(client)
+}
+
+// baseURL returns the Snyk API base URL: --apiUrl, else internal.GetSnykAPIBaseURL.
+func (f *clientFlags) baseURL() string {
+	if *f.apiURL != "" {
+		return strings.TrimSuffix(*f.apiURL, "/")
+	}
+	return internal.GetSnykAPIBaseURL()
+}
+
+// withCache enables the response cache on client if --cacheDir is set.
+func (f *clientFlags) withCache(client *internal.Client) (*internal.Client, error) {
+	if *f.cacheDir != "" {
+		var err error
+		client.Cache, err = internal.NewResponseCache(*f.cacheDir, *f.cacheTTL, *f.refreshCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// resolveOrgs returns the list of orgs to process: a single-org slice for
+// orgID, otherwise the orgs matching q.
+func resolveOrgs(ctx context.Context, api SnykAPI, q internal.OrgQuery, orgID string) ([]internal.Org, error) {
+	if orgID != "" {
+		return []internal.Org{{ID: orgID}}, nil
+	}
+	if q.GroupID != "" {
+		slog.Info("fetching orgs", "group_id", q.GroupID)
+	} else {
+		slog.Info("fetching orgs accessible to the token")
+	}
+	return api.FetchOrgs(ctx, q)
+}
+
+// failureHints suggests what to do about each class of org failure.
+var failureHints = map[internal.ErrorClass]string{
+	internal.ClassAuth:       "credentials rejected; run `doctor` to check the token and API region",
+	internal.ClassPermission: "the token lacks access to these orgs",
+	internal.ClassNotFound:   "the org no longer exists or is not visible to the token",
+	internal.ClassRateLimit:  "rate limited after all retries; lower --rps or raise --maxRetries",
+	internal.ClassServer:     "Snyk API server errors; retry later",
+	internal.ClassNetwork:    "network errors; check connectivity and proxy settings",
+}
+
+// orgFailures groups the orgs that failed to process by error class.
+type orgFailures map[internal.ErrorClass][]string
+
+// add records that the org with the given label failed with err.
+func (f orgFailures) add(orgLabel string, err error) {
+	class := internal.ClassifyError(err)
+	f[class] = append(f[class], orgLabel)
 }
 
-// resolveOrgs returns the list of orgs to process: either all orgs in the group or a single-org slice.
-func resolveOrgs(ctx context.Context, api SnykAPI, groupID, orgID string) ([]internal.Org, error) {
-	if groupID != "" {
-		log.Printf("Fetching organizations for group %s...", groupID)
-		return api.FetchOrgs(ctx, groupID)
+// count returns the number of failed orgs.
+func (f orgFailures) count() int {
+	n := 0
+	for _, orgs := range f {
+		n += len(orgs)
+	}
+	return n
+}
+
+// print writes one line per error class, in a stable order.
+func (f orgFailures) print(w io.Writer) {
+	classes := make([]string, 0, len(f))
+	for class := range f {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		orgs := f[internal.ErrorClass(class)]
+		fmt.Fprintf(w, "  %s (%d): %s\n", class, len(orgs), strings.Join(orgs, ", "))
+		if hint := failureHints[internal.ErrorClass(class)]; hint != "" {
+			fmt.Fprintf(w, "    %s\n", hint)
+		}
 	}
-	return []internal.Org{{ID: orgID}}, nil
 }
 
 func main() {
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run dispatches to a subcommand and returns the process exit code.
+func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
 		case "dedup":
-			runDedup(os.Args[2:])
-			return
+			return runDedup(args[1:])
+		case "doctor":
+			return runDoctor(args[1:])
+		case "merge":
+			return runMerge(args[1:])
 		case "--version", "-version":
 			printVersion()
-			return
+			return exitOK
 		}
 	}
-	runRefresh(os.Args[1:])
+	return runRefresh(args)
 }
 
 // sanitizeOutputPath validates and resolves the output file path to prevent
@@ -6,15 +6,90 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/snyk-playground/snyk-target-export/internal"
+	"github.com/snyk-playground/snyk-target-export/internal/fakesnyk"
 )
 
+// e2eArgsEnv carries the CLI arguments (JSON) when the test binary is
+// re-executed by runCLI.
+const e2eArgsEnv = "FAKESNYK_E2E_ARGS"
+
+// TestMain runs main() instead of the tests when re-executed by runCLI, so
+// end-to-end tests drive the whole CLI in its own process, exit code included.
+func TestMain(m *testing.M) {
+	if raw := os.Getenv(e2eArgsEnv); raw != "" {
+		var args []string
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Args = append([]string{"snyk-target-export"}, args...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// startFakeSnyk serves testdata/fakesnyk_data.json with small pages and
+// periodic 429s, so every run exercises pagination and retries. configure,
+// if non-nil, adjusts the server before it starts.
+func startFakeSnyk(t *testing.T, configure func(*fakesnyk.Server)) (*fakesnyk.Server, string) {
+	t.Helper()
+	data, err := fakesnyk.LoadData(filepath.Join("testdata", "fakesnyk_data.json"))
+	if err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	s := fakesnyk.New(data)
+	s.Token = "e2e-token"
+	s.MaxPageSize = 2
+	s.RateLimitEvery = 5
+	if configure != nil {
+		configure(s)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+// runCLI runs the CLI against the fake API at baseURL and returns its stdout,
+// stderr and exit code.
+func runCLI(t *testing.T, baseURL string, args ...string) (string, string, int) {
+	t.Helper()
+	if len(args) == 0 || args[0] != "merge" { // merge makes no API requests
+		args = append(args, "--rps=0", "--retryInitialBackoff=1ms", "--retryMaxBackoff=5ms")
+	}
+	raw, _ := json.Marshal(args)
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), e2eArgsEnv+"="+string(raw), "SNYK_API="+baseURL, "SNYK_TOKEN=e2e-token", "XDG_CONFIG_HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("run CLI: %v", err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
 // loadMockOrgsFromTestdata reads testdata/mock_orgs_response.json and returns
 // the orgs array as []internal.Org for use in mockSnykAPI. Skips the file if missing
 // (e.g. in CI without testdata). Returns nil if the file is missing or invalid.
@@ -27,18 +102,20 @@ func loadMockOrgsFromTestdata(t *testing.T) []internal.Org {
 		return nil
 	}
 	var response struct {
-		Orgs []struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-			Slug string `json:"slug"`
-		} `json:"orgs"`
+		Data []struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Name string `json:"name"`
+				Slug string `json:"slug"`
+			} `json:"attributes"`
+		} `json:"data"`
 	}
 	if err := json.Unmarshal(data, &response); err != nil {
 		t.Fatalf("parse mock_orgs_response.json: %v", err)
 	}
-	orgs := make([]internal.Org, len(response.Orgs))
-	for i, o := range response.Orgs {
-		orgs[i] = internal.Org{ID: o.ID, Name: o.Name, Slug: o.Slug}
+	orgs := make([]internal.Org, len(response.Data))
+	for i, o := range response.Data {
+		orgs[i] = internal.Org{ID: o.ID, Name: o.Attributes.Name, Slug: o.Attributes.Slug}
 	}
 	return orgs
 }
@@ -168,30 +245,168 @@ func loadMockTargetsFromTestdata(t *testing.T) []internal.APITarget {
 
 // --- Shared helpers (used by both refresh and dedup) ---
 
-// TestValidateGroupOrOrg ensures exactly one of groupId or orgId is required,
-// and that both cannot be set. Used by both refresh and dedup flag validation.
+// TestValidateGroupOrOrg ensures orgs are selected by orgId or by group and
+// name/slug filters, and that both cannot be set. Used by both refresh and
+// dedup flag validation.
 func TestValidateGroupOrOrg(t *testing.T) {
 	tests := []struct {
 		name    string
-		groupID string
+		query   internal.OrgQuery
 		orgID   string
 		wantErr bool
 	}{
-		{"group only", "group-1", "", false},
-		{"org only", "", "org-1", false},
-		{"both empty", "", "", true},
-		{"both set", "group-1", "org-1", true},
+		{"group only", internal.OrgQuery{GroupID: "group-1"}, "", false},
+		{"org only", internal.OrgQuery{}, "org-1", false},
+		{"name filter without group", internal.OrgQuery{Name: "payments"}, "", false},
+		{"slug filter in group", internal.OrgQuery{GroupID: "group-1", Slug: "payments"}, "", false},
+		{"both empty", internal.OrgQuery{}, "", true},
+		{"both set", internal.OrgQuery{GroupID: "group-1"}, "org-1", true},
+		{"org and slug", internal.OrgQuery{Slug: "payments"}, "org-1", true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateGroupOrOrg(tt.groupID, tt.orgID)
+			err := validateGroupOrOrg(tt.query, tt.orgID)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("validateGroupOrOrg(%q, %q) err = %v, wantErr %v", tt.groupID, tt.orgID, err, tt.wantErr)
+				t.Errorf("validateGroupOrOrg(%+v, %q) err = %v, wantErr %v", tt.query, tt.orgID, err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func TestParseGroupSpecs(t *testing.T) {
+	groups, err := parseGroupSpecs([]string{
+		"g-us",
+		"g-eu, api=https://api.eu.snyk.io/ ,tokenEnv=SNYK_TOKEN_EU,name=eu",
+		"g-au,tokenFile=/run/secrets/au",
+	})
+	if err != nil {
+		t.Fatalf("parseGroupSpecs: %v", err)
+	}
+	want := []groupSpec{
+		{id: "g-us"},
+		{id: "g-eu", apiURL: "https://api.eu.snyk.io", tokenEnv: "SNYK_TOKEN_EU", name: "eu"},
+		{id: "g-au", tokenFile: "/run/secrets/au"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %+v, want %+v", groups, want)
+	}
+	if got := groupOutputPath("out-{group}.json", groups[1]); got != "out-eu.json" {
+		t.Errorf("groupOutputPath = %q", got)
+	}
+	if got := groupMeta(groups[1], groups[1].apiURL); got.Region != "SNYK-EU-01" || got.Name != "eu" {
+		t.Errorf("groupMeta = %+v", got)
+	}
+
+	for _, values := range [][]string{
+		{""},
+		{"api=https://api.snyk.io"},
+		{"g1,region=eu"},
+		{"g1,tokenEnv"},
+		{"g1,name=a/b"},
+		{"g1", "g1,name=again"},
+	} {
+		if _, err := parseGroupSpecs(values); err == nil {
+			t.Errorf("parseGroupSpecs(%q): want error", values)
+		}
+	}
+	if err := validateGroups(want, internal.OrgQuery{GroupID: "g"}, ""); err == nil {
+		t.Error("--group with --groupId: want error")
+	}
+	if err := validateGroups(want, internal.OrgQuery{Slug: "payments"}, ""); err != nil {
+		t.Errorf("--group with --orgSlug: %v", err)
+	}
+}
+
+func TestShard(t *testing.T) {
+	var orgs []internal.Org
+	for i := 0; i < 100; i++ {
+		orgs = append(orgs, internal.Org{ID: fmt.Sprintf("org-%d", i)})
+	}
+	seen := make(map[string]int)
+	for i := 1; i <= 3; i++ {
+		sh, err := parseShard(fmt.Sprintf("%d/3", i))
+		if err != nil {
+			t.Fatalf("parseShard: %v", err)
+		}
+		part := sh.filter(orgs)
+		if len(part) < 20 {
+			t.Errorf("shard %s has %d of 100 orgs", sh, len(part))
+		}
+		for _, o := range part {
+			seen[o.ID]++
+		}
+	}
+	for _, o := range orgs {
+		if seen[o.ID] != 1 {
+			t.Errorf("org %s is in %d shards, want 1", o.ID, seen[o.ID])
+		}
+	}
+	if sh, _ := parseShard(""); len(sh.filter(orgs)) != 100 {
+		t.Error("no --shard: want every org")
+	}
+	for _, bad := range []string{"0/3", "4/3", "1", "a/b", "1/0"} {
+		if _, err := parseShard(bad); err == nil {
+			t.Errorf("parseShard(%q): want error", bad)
+		}
+	}
+}
+
+func TestMergeRefreshOutputs(t *testing.T) {
+	target := func(org, name string) internal.ImportTarget {
+		return internal.ImportTarget{OrgID: org, IntegrationID: "int-" + org, Target: internal.Target{Owner: "acme", Name: name, Branch: "main"}}
+	}
+	merged, dropped := mergeRefreshOutputs([]RefreshOutput{
+		{GroupID: "g1", Orgs: map[string]OrgMeta{"o1": {Name: "One"}}, Integrations: map[string]string{"int-o1": "github"},
+			Targets: []internal.ImportTarget{target("o1", "api"), target("o1", "web")}},
+		{GroupID: "g2", Orgs: map[string]OrgMeta{"o2": {Name: "Two"}}, Integrations: map[string]string{"int-o2": "github"},
+			Targets: []internal.ImportTarget{target("o2", "api"), target("o1", "api")}},
+	})
+	if dropped != 1 || len(merged.Targets) != 3 {
+		t.Errorf("dropped = %d, targets = %+v", dropped, merged.Targets)
+	}
+	if merged.GroupID != "" || merged.Orgs["o1"].GroupID != "g1" || merged.Orgs["o2"].GroupID != "g2" || len(merged.Integrations) != 2 {
+		t.Errorf("merged = %+v", merged)
+	}
+
+	merged, _ = mergeRefreshOutputs([]RefreshOutput{{GroupID: "g1"}, {GroupID: "g1"}})
+	if merged.GroupID != "g1" || merged.Targets == nil {
+		t.Errorf("same group: groupId = %q, targets = %v", merged.GroupID, merged.Targets)
+	}
+}
+
+func TestMergeSummaries(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	merged, err := mergeSummaries([]runSummary{
+		{Command: "dedup", Status: statusNoop, ExitCode: exitNoop, StartedAt: start.Add(time.Second), DurationSeconds: 10, Shard: "1/3",
+			Orgs: orgSummary{Total: 2, Processed: 2}, Dedup: &dedupSummary{DryRun: true}},
+		{Command: "dedup", Status: statusPartial, ExitCode: exitPartial, StartedAt: start, DurationSeconds: 5, Shard: "2/3",
+			Orgs:  orgSummary{Total: 3, Processed: 2, Failed: 1, Failures: []orgFailureSummary{{OrgID: "o3", Error: "boom"}}},
+			Dedup: &dedupSummary{DryRun: false, DuplicateProjects: 4, ProjectsDeleted: 3, ProjectDeleteFailures: 1}},
+		{Command: "dedup", Status: statusSuccess, StartedAt: start, DurationSeconds: 2, Shard: "3/3",
+			Orgs: orgSummary{Total: 1, Processed: 1}, Dedup: &dedupSummary{DryRun: true, DuplicateProjects: 1}},
+	})
+	if err != nil {
+		t.Fatalf("mergeSummaries: %v", err)
+	}
+	if merged.Status != statusPartial || merged.ExitCode != exitPartial || merged.DurationSeconds != 11 || !merged.StartedAt.Equal(start) {
+		t.Errorf("status = %s, exit = %d, duration = %v, started = %v", merged.Status, merged.ExitCode, merged.DurationSeconds, merged.StartedAt)
+	}
+	if merged.Orgs.Total != 6 || merged.Orgs.Processed != 5 || merged.Orgs.Failed != 1 || len(merged.Orgs.Failures) != 1 {
+		t.Errorf("orgs = %+v", merged.Orgs)
+	}
+	if d := merged.Dedup; d.DryRun || d.DuplicateProjects != 5 || d.ProjectsDeleted != 3 || d.ProjectDeleteFailures != 1 {
+		t.Errorf("dedup = %+v", d)
+	}
+
+	if _, err := mergeSummaries([]runSummary{{Command: "dedup"}, {Command: "refresh"}}); err == nil {
+		t.Error("mixed commands: want error")
+	}
+	merged, _ = mergeSummaries([]runSummary{{Command: "refresh", Status: statusNoop, ExitCode: exitNoop}, {Command: "refresh", Status: statusFailed, ExitCode: exitFatal, Error: "boom", Shard: "2/2"}})
+	if merged.Status != statusFailed || merged.ExitCode != exitFatal || merged.Error != "2/2: boom" {
+		t.Errorf("failed shard: %+v", merged)
+	}
+}
+
 // TestOrgLabel checks the human-readable org label used in logs and output.
 // When name/slug are set we show "Name (slug)"; otherwise the org ID.
 func TestOrgLabel(t *testing.T) {
@@ -226,7 +441,7 @@ func TestProjectsToImportTargets(t *testing.T) {
 		projects := []internal.Project{
 			{Name: "owner/repo", Origin: "gitlab", Branch: "main"},
 		}
-		targets, gitlabCount := projectsToImportTargets(org, projects, integrations, "")
+		targets, gitlabCount := projectsToImportTargets(org, projects, integrations, refreshOptions{})
 		if len(targets) != 0 {
 			t.Errorf("got %d targets, want 0 (gitlab should be skipped)", len(targets))
 		}
@@ -239,7 +454,7 @@ func TestProjectsToImportTargets(t *testing.T) {
 		projects := []internal.Project{
 			{Name: "owner/repo:package.json", Origin: "github", Branch: "main"},
 		}
-		targets, gitlabCount := projectsToImportTargets(org, projects, integrations, "")
+		targets, gitlabCount := projectsToImportTargets(org, projects, integrations, refreshOptions{})
 		if gitlabCount != 0 {
 			t.Errorf("gitlabCount = %d, want 0", gitlabCount)
 		}
@@ -260,7 +475,7 @@ func TestProjectsToImportTargets(t *testing.T) {
 			{Name: "a/b", Origin: "github", Branch: "main"},
 			{Name: "c/d", Origin: "bitbucket-cloud", Branch: "main"},
 		}
-		targets, _ := projectsToImportTargets(org, projects, integrations, "github")
+		targets, _ := projectsToImportTargets(org, projects, integrations, refreshOptions{integrationType: "github"})
 		if len(targets) != 1 {
 			t.Errorf("filter integrationType=github: got %d targets, want 1", len(targets))
 		}
@@ -269,18 +484,322 @@ func TestProjectsToImportTargets(t *testing.T) {
 		}
 	})
 
+	t.Run("cli project skipped unless includeCLI", func(t *testing.T) {
+		integrations := map[string]string{"github": "int-github", "github-cloud-app": "int-gca"}
+		projects := []internal.Project{
+			{Name: "acme/api:package.json", Origin: "cli", TargetReference: "main", RemoteRepoURL: "https://github.com/acme/api.git"},
+			{Name: "local-project", Origin: "cli"},
+		}
+		targets, _ := projectsToImportTargets(org, projects, integrations, refreshOptions{})
+		if len(targets) != 0 {
+			t.Errorf("without includeCLI: got %d targets, want 0", len(targets))
+		}
+		targets, _ = projectsToImportTargets(org, projects, integrations, refreshOptions{includeCLI: true})
+		if len(targets) != 1 {
+			t.Fatalf("with includeCLI: got %d targets, want 1", len(targets))
+		}
+		want := internal.Target{Owner: "acme", Name: "api", Branch: "main"}
+		if targets[0].Target != want || targets[0].IntegrationID != "int-gca" {
+			t.Errorf("cli target = %+v, want %+v on int-gca", targets[0], want)
+		}
+		targets, _ = projectsToImportTargets(org, projects, integrations, refreshOptions{includeCLI: true, integrationType: "github"})
+		if len(targets) != 0 {
+			t.Errorf("integrationType=github should not match cli project mapped to github-cloud-app: got %+v", targets)
+		}
+	})
+
+	t.Run("container projects opt-in", func(t *testing.T) {
+		integrations := map[string]string{"github": "int-github", "ecr": "int-ecr"}
+		projects := []internal.Project{
+			{Name: "team/app:1.0", Origin: "ecr"},
+			{Name: "team/app:1.0:/app/package.json", Origin: "ecr"},
+			{Name: "owner/repo", Origin: "github", Branch: "main"},
+		}
+		targets, _ := projectsToImportTargets(org, projects, integrations, refreshOptions{})
+		if len(targets) != 1 {
+			t.Errorf("default: got %d targets, want 1 (SCM only)", len(targets))
+		}
+		targets, _ = projectsToImportTargets(org, projects, integrations, refreshOptions{includeImages: true, integrationType: "ecr"})
+		if len(targets) != 1 {
+			t.Fatalf("includeImages+ecr: got %d targets, want 1 (image deduplicated)", len(targets))
+		}
+		if targets[0].Target != (internal.Target{Name: "team/app:1.0"}) || targets[0].IntegrationID != "int-ecr" {
+			t.Errorf("image target = %+v", targets[0])
+		}
+	})
+
+	t.Run("project filters applied before conversion", func(t *testing.T) {
+		projects := []internal.Project{
+			{Name: "a/old", Origin: "github", Created: "2023-06-01T00:00:00Z", Status: "active"},
+			{Name: "a/new", Origin: "github", Created: "2025-06-01T00:00:00Z", Status: "active"},
+			{Name: "a/off", Origin: "github", Created: "2023-06-01T00:00:00Z", Status: "inactive"},
+		}
+		cutoff, _ := internal.ParseDate("2024-01-01")
+		opts := refreshOptions{filters: []internal.ProjectFilter{
+			internal.FilterCreatedBefore(cutoff),
+			internal.FilterStatus("active"),
+		}}
+		targets, _ := projectsToImportTargets(org, projects, integrations, opts)
+		if len(targets) != 1 || targets[0].Target.Name != "old" {
+			t.Errorf("got %+v, want only a/old", targets)
+		}
+	})
+
+	t.Run("where expression sees project and target", func(t *testing.T) {
+		projects := []internal.Project{
+			{Name: "acme/api:package.json", Origin: "github", Branch: "main"},
+			{Name: "other/api:package.json", Origin: "github", Branch: "main"},
+		}
+		where, err := internal.CompileExpr(`name matches "^acme/" && target.branch == "main"`)
+		if err != nil {
+			t.Fatalf("CompileExpr: %v", err)
+		}
+		targets, _ := projectsToImportTargets(org, projects, integrations, refreshOptions{where: where})
+		if len(targets) != 1 || targets[0].Target.Owner != "acme" {
+			t.Errorf("got %+v, want only acme/api", targets)
+		}
+	})
+
 	t.Run("no integration for origin skipped", func(t *testing.T) {
 		integrations := map[string]string{"github": "int-github"}
 		projects := []internal.Project{
 			{Name: "owner/repo", Origin: "bitbucket-cloud", Branch: "main"},
 		}
-		targets, _ := projectsToImportTargets(org, projects, integrations, "")
+		targets, _ := projectsToImportTargets(org, projects, integrations, refreshOptions{})
 		if len(targets) != 0 {
 			t.Errorf("project with no matching integration should be skipped: got %d targets", len(targets))
 		}
 	})
 }
 
+// --- Project filter flags ---
+
+func TestProjectFilterFlags(t *testing.T) {
+	parse := func(args ...string) ([]internal.ProjectFilter, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		f := addProjectFilterFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return f.build()
+	}
+
+	filters, err := parse()
+	if err != nil || len(filters) != 0 {
+		t.Errorf("no flags: got %d filters, err %v", len(filters), err)
+	}
+
+	filters, err = parse("--projectType=npm,maven", "--tag=team=a", "--tag=env=prod",
+		"--environment=frontend", "--status=active", "--createdBefore=2024-01-01")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(filters) != 6 {
+		t.Errorf("got %d filters, want 6", len(filters))
+	}
+	p := internal.Project{
+		Type: "npm", Status: "active", Created: "2023-01-01T00:00:00Z",
+		Tags:        []internal.Tag{{Key: "team", Value: "a"}, {Key: "env", Value: "prod"}},
+		Environment: []string{"frontend"},
+	}
+	if !internal.MatchAll(p, filters) {
+		t.Errorf("project %+v should match all filters", p)
+	}
+
+	for _, bad := range [][]string{
+		{"--tag=novalue"},
+		{"--status=archived"},
+		{"--createdAfter=yesterday"},
+	} {
+		if _, err := parse(bad...); err == nil {
+			t.Errorf("parse(%v): want error", bad)
+		}
+	}
+}
+
+// --- Environment overrides ---
+
+func TestFlagEnvName(t *testing.T) {
+	tests := map[string]string{
+		"groupId":         "SNYK_TARGET_EXPORT_GROUP_ID",
+		"retryMaxBackoff": "SNYK_TARGET_EXPORT_RETRY_MAX_BACKOFF",
+		"includeCLI":      "SNYK_TARGET_EXPORT_INCLUDE_CLI",
+		"rps":             "SNYK_TARGET_EXPORT_RPS",
+	}
+	for name, want := range tests {
+		if got := flagEnvName(name); got != want {
+			t.Errorf("flagEnvName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("SNYK_TARGET_EXPORT_MAX_RETRIES", "9")
+	t.Setenv("SNYK_TARGET_EXPORT_RPS", "7")
+	t.Setenv("SNYK_TOKEN", "test-token")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	if err := fs.Parse([]string{"--rps=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if *cf.maxRetries != 9 {
+		t.Errorf("maxRetries = %d, want 9 from env", *cf.maxRetries)
+	}
+	if *cf.rps != 3 {
+		t.Errorf("rps = %v, want 3 (flag beats env)", *cf.rps)
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	if client.Retry.MaxRetries != 9 {
+		t.Errorf("client.Retry.MaxRetries = %d, want 9", client.Retry.MaxRetries)
+	}
+
+	// --delete is never read from the environment.
+	t.Setenv("SNYK_TARGET_EXPORT_DELETE", "true")
+	fs = flag.NewFlagSet("dedup", flag.ContinueOnError)
+	doDelete := fs.Bool("delete", false, "")
+	if err := applyEnvOverrides(fs); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if *doDelete {
+		t.Error("delete was set from SNYK_TARGET_EXPORT_DELETE")
+	}
+
+	t.Setenv("SNYK_TARGET_EXPORT_RETRY_MAX_BACKOFF", "not-a-duration")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	addClientFlags(fs)
+	if err := applyEnvOverrides(fs); err == nil {
+		t.Error("invalid env value: want error")
+	}
+}
+
+func TestConfigFlags_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(`
+defaultProfile = "eu"
+maxRetries = 1
+rps = 1
+timeout = "5s"
+
+[profile.eu]
+apiUrl = "https://api.eu.snyk.io/"
+burst = 2
+tag = ["env=prod"]
+
+[profile.eu.refresh]
+tag = ["team=a", "team=b"]
+maxRetries = 4
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SNYK_TARGET_EXPORT_CONFIG", path)
+	t.Setenv("SNYK_TARGET_EXPORT_BURST", "6")
+
+	fs := flag.NewFlagSet("refresh", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	filters := addProjectFilterFlags(fs)
+	configOpts := addConfigFlags(fs)
+	if err := fs.Parse([]string{"--rps=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if err := configOpts.apply(fs, "refresh"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if *cf.rps != 3 {
+		t.Errorf("rps = %v, want 3 (flag beats file)", *cf.rps)
+	}
+	if *cf.burst != 6 {
+		t.Errorf("burst = %d, want 6 (env beats file)", *cf.burst)
+	}
+	if *cf.maxRetries != 4 {
+		t.Errorf("maxRetries = %d, want 4 from [profile.eu.refresh]", *cf.maxRetries)
+	}
+	if *cf.timeout != 5*time.Second {
+		t.Errorf("timeout = %v, want 5s from the top level", *cf.timeout)
+	}
+	if got := cf.baseURL(); got != "https://api.eu.snyk.io" {
+		t.Errorf("baseURL = %q", got)
+	}
+	if got := strings.Join(filters.tags, " "); got != "team=a team=b" {
+		t.Errorf("tags = %q, want the [profile.eu.refresh] list", got)
+	}
+
+	for _, tt := range []struct {
+		config, profile, want string
+	}{
+		{"[refresh]\nbogus = 1", "", `unknown setting "bogus" for refresh`},
+		{"rps = \"fast\"", "", "top level rps: parse error"},
+		{"[profile.a]", "b", `profile "b" not found (defined: a)`},
+	} {
+		if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("refresh", flag.ContinueOnError)
+		addClientFlags(fs)
+		configOpts := addConfigFlags(fs)
+		if err := fs.Parse([]string{"--config=" + path, "--profile=" + tt.profile}); err != nil {
+			t.Fatal(err)
+		}
+		if err := configOpts.apply(fs, "refresh"); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("config %q: err = %v, want %q", tt.config, err, tt.want)
+		}
+	}
+
+	// --delete must be given on the command line.
+	if err := os.WriteFile(path, []byte("[dedup]\ndelete = true"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fs = flag.NewFlagSet("dedup", flag.ContinueOnError)
+	doDelete := fs.Bool("delete", false, "")
+	configOpts = addConfigFlags(fs)
+	if err := fs.Parse([]string{"--config=" + path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := configOpts.apply(fs, "dedup"); err == nil || !strings.Contains(err.Error(), "delete must be given on the command line") || *doDelete {
+		t.Errorf("delete in [dedup]: err = %v, delete = %v", err, *doDelete)
+	}
+}
+
+func TestNewClient_RecordReplay(t *testing.T) {
+	t.Setenv("SNYK_TOKEN", "")
+	t.Setenv("SNYK_API_TOKEN", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "00001.json"), []byte(`{"method":"GET","url":"https://api.snyk.io/rest/self","status":200}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func(args ...string) (*internal.Client, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cf := addClientFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cf.newClient()
+	}
+	client, err := newClient("--replay=" + dir)
+	if err != nil {
+		t.Fatalf("--replay without credentials: %v", err)
+	}
+	if client.Auth != nil {
+		t.Errorf("replay client should send no credentials")
+	}
+	if _, err := newClient("--replay="+dir, "--record="+t.TempDir()); err == nil {
+		t.Error("--record with --replay: want error")
+	}
+	if _, err := newClient("--record="+t.TempDir(), "--cacheDir="+t.TempDir()); err == nil {
+		t.Error("--record with --cacheDir: want error")
+	}
+}
+
 // --- Mock SnykAPI for unit testing (no real API) ---
 
 // mockSnykAPI implements SnykAPI with canned responses. Set Err fields to simulate API errors.
@@ -292,13 +811,17 @@ type mockSnykAPI struct {
 	IntegrationsErr  error
 	Projects         []internal.Project
 	ProjectsErr      error
+	ProjectPageSize  int                     // StreamProjects page size; 0 = one page
+	ProjectQueries   []internal.ProjectQuery // queries passed to StreamProjects
+	OrgQueries       []internal.OrgQuery     // queries passed to FetchOrgs
 	Targets          []internal.APITarget
 	TargetsErr       error
 	DeleteProjectErr error
 	DeleteTargetErr  error
 }
 
-func (m *mockSnykAPI) FetchOrgs(ctx context.Context, groupID string) ([]internal.Org, error) {
+func (m *mockSnykAPI) FetchOrgs(ctx context.Context, q internal.OrgQuery) ([]internal.Org, error) {
+	m.OrgQueries = append(m.OrgQueries, q)
 	if m.OrgsErr != nil {
 		return nil, m.OrgsErr
 	}
@@ -319,6 +842,24 @@ func (m *mockSnykAPI) FetchProjects(ctx context.Context, orgID string) ([]intern
 	return m.Projects, nil
 }
 
+func (m *mockSnykAPI) StreamProjects(ctx context.Context, orgID string, q internal.ProjectQuery, fn func([]internal.Project) error) error {
+	m.ProjectQueries = append(m.ProjectQueries, q)
+	if m.ProjectsErr != nil {
+		return m.ProjectsErr
+	}
+	size := m.ProjectPageSize
+	if size <= 0 {
+		size = len(m.Projects)
+	}
+	for start := 0; start < len(m.Projects); start += size {
+		end := min(start+size, len(m.Projects))
+		if err := fn(m.Projects[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockSnykAPI) FetchTargets(ctx context.Context, orgID string) ([]internal.APITarget, error) {
 	if m.TargetsErr != nil {
 		return nil, m.TargetsErr
@@ -344,7 +885,7 @@ func TestResolveOrgs_GroupID(t *testing.T) {
 			{ID: "org-2", Name: "Org Two", Slug: "org-two"},
 		},
 	}
-	orgs, err := resolveOrgs(ctx, mock, "group-123", "")
+	orgs, err := resolveOrgs(ctx, mock, internal.OrgQuery{GroupID: "group-123"}, "")
 	if err != nil {
 		t.Fatalf("resolveOrgs: %v", err)
 	}
@@ -359,7 +900,7 @@ func TestResolveOrgs_GroupID(t *testing.T) {
 func TestResolveOrgs_OrgIDOnly(t *testing.T) {
 	ctx := context.Background()
 	mock := &mockSnykAPI{Orgs: []internal.Org{{ID: "unused"}}}
-	orgs, err := resolveOrgs(ctx, mock, "", "my-org-id")
+	orgs, err := resolveOrgs(ctx, mock, internal.OrgQuery{}, "my-org-id")
 	if err != nil {
 		t.Fatalf("resolveOrgs: %v", err)
 	}
@@ -368,10 +909,22 @@ func TestResolveOrgs_OrgIDOnly(t *testing.T) {
 	}
 }
 
+func TestResolveOrgs_FiltersWithoutGroup(t *testing.T) {
+	mock := &mockSnykAPI{Orgs: []internal.Org{{ID: "org-1", Slug: "payments"}}}
+	q := internal.OrgQuery{Slug: "payments"}
+	orgs, err := resolveOrgs(context.Background(), mock, q, "")
+	if err != nil {
+		t.Fatalf("resolveOrgs: %v", err)
+	}
+	if len(orgs) != 1 || len(mock.OrgQueries) != 1 || mock.OrgQueries[0] != q {
+		t.Errorf("orgs = %+v, queries = %+v", orgs, mock.OrgQueries)
+	}
+}
+
 func TestResolveOrgs_GroupID_APIError(t *testing.T) {
 	ctx := context.Background()
 	mock := &mockSnykAPI{OrgsErr: fmt.Errorf("api down")}
-	_, err := resolveOrgs(ctx, mock, "group-123", "")
+	_, err := resolveOrgs(ctx, mock, internal.OrgQuery{GroupID: "group-123"}, "")
 	if err == nil {
 		t.Fatal("resolveOrgs: want error")
 	}
@@ -386,7 +939,7 @@ func TestResolveOrgs_WithTestdataOrgs(t *testing.T) {
 	}
 	ctx := context.Background()
 	mock := &mockSnykAPI{Orgs: orgs}
-	got, err := resolveOrgs(ctx, mock, "group-123", "")
+	got, err := resolveOrgs(ctx, mock, internal.OrgQuery{GroupID: "group-123"}, "")
 	if err != nil {
 		t.Fatalf("resolveOrgs: %v", err)
 	}
@@ -411,7 +964,7 @@ func TestProcessOrgForRefresh(t *testing.T) {
 			{Name: "owner/repo:package.json", Origin: "github", Branch: "main"},
 		},
 	}
-	res := processOrgForRefresh(ctx, mock, org, "")
+	res := processOrgForRefresh(ctx, mock, org, refreshOptions{})
 	if res.err != nil {
 		t.Fatalf("processOrgForRefresh: %v", res.err)
 	}
@@ -429,10 +982,66 @@ func TestProcessOrgForRefresh(t *testing.T) {
 	}
 }
 
+func TestProcessOrgForRefresh_StreamsPages(t *testing.T) {
+	mock := &mockSnykAPI{
+		Integrations: map[string]string{"github": "int-github"},
+		Projects: []internal.Project{
+			{Name: "owner/repo:package.json", Origin: "github", Branch: "main"},
+			{Name: "owner/repo:pom.xml", Origin: "github", Branch: "main"},
+			{Name: "gl/repo:package.json", Origin: "gitlab"},
+			{Name: "owner/other:go.mod", Origin: "github", Branch: "main"},
+		},
+		ProjectPageSize: 1,
+	}
+	res := processOrgForRefresh(context.Background(), mock, internal.Org{ID: "org-1"}, refreshOptions{})
+	if res.err != nil {
+		t.Fatalf("processOrgForRefresh: %v", res.err)
+	}
+	// Duplicates are removed across page boundaries.
+	if len(res.targets) != 2 || res.gitlabCount != 1 {
+		t.Errorf("targets = %+v, gitlabCount = %d", res.targets, res.gitlabCount)
+	}
+}
+
+func TestRefreshQuery(t *testing.T) {
+	types := internal.ProjectQuery{Types: []string{"npm"}}
+	tests := []struct {
+		name string
+		opts refreshOptions
+		want string
+	}{
+		{"integration type", refreshOptions{integrationType: "github"}, "github"},
+		{"bitbucket app aliases", refreshOptions{integrationType: "bitbucket-connect-app", includeCLI: true}, "bitbucket-connect-app,bitbucket-cloud-app,cli"},
+		{"all", refreshOptions{}, strings.Join(append(internal.SCMOrigins(), "gitlab"), ",")},
+		{"all with images", refreshOptions{includeImages: true}, strings.Join(append(append(internal.SCMOrigins(), "gitlab"), internal.ContainerOrigins()...), ",")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := refreshQuery(types, tt.opts)
+			if got := strings.Join(q.Origins, ","); got != tt.want {
+				t.Errorf("origins = %s, want %s", got, tt.want)
+			}
+			if len(q.Types) != 1 || q.Types[0] != "npm" {
+				t.Errorf("types = %v, want filter query kept", q.Types)
+			}
+		})
+	}
+}
+
+func TestProcessOrgForRefresh_PassesQuery(t *testing.T) {
+	mock := &mockSnykAPI{Integrations: map[string]string{"github": "int-github"}}
+	opts := refreshOptions{integrationType: "github"}
+	opts.query = refreshQuery(internal.ProjectQuery{}, opts)
+	processOrgForRefresh(context.Background(), mock, internal.Org{ID: "org-1"}, opts)
+	if len(mock.ProjectQueries) != 1 || strings.Join(mock.ProjectQueries[0].Origins, ",") != "github" {
+		t.Errorf("StreamProjects queries = %+v", mock.ProjectQueries)
+	}
+}
+
 func TestProcessOrgForRefresh_ListIntegrationsError(t *testing.T) {
 	ctx := context.Background()
 	mock := &mockSnykAPI{IntegrationsErr: fmt.Errorf("auth failed")}
-	res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, "")
+	res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, refreshOptions{})
 	if res.err == nil {
 		t.Fatal("want error from ListIntegrations")
 	}
@@ -444,7 +1053,7 @@ func TestProcessOrgForRefresh_FetchProjectsError(t *testing.T) {
 		Integrations: map[string]string{},
 		ProjectsErr:  fmt.Errorf("rate limited"),
 	}
-	res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, "")
+	res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, refreshOptions{})
 	if res.err == nil {
 		t.Fatal("want error from FetchProjects")
 	}
@@ -465,7 +1074,7 @@ func TestProcessOrgForRefresh_WithTestdataIntegrations(t *testing.T) {
 			{Name: "owner/repo:package.json", Origin: "github", Branch: "main"},
 		},
 	}
-	res := processOrgForRefresh(ctx, mock, org, "")
+	res := processOrgForRefresh(ctx, mock, org, refreshOptions{})
 	if res.err != nil {
 		t.Fatalf("processOrgForRefresh: %v", res.err)
 	}
@@ -493,7 +1102,7 @@ func TestProcessOrgForRefresh_WithTestdataProjects(t *testing.T) {
 		Integrations: integrations,
 		Projects:     projects,
 	}
-	res := processOrgForRefresh(ctx, mock, org, "")
+	res := processOrgForRefresh(ctx, mock, org, refreshOptions{})
 	if res.err != nil {
 		t.Fatalf("processOrgForRefresh: %v", res.err)
 	}
@@ -563,6 +1172,63 @@ func TestWriteRefreshOutput(t *testing.T) {
 	}
 }
 
+func TestRefreshWriter_MatchesMarshalIndent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export-targets.json")
+	w, err := newRefreshWriter(path, "group-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch1 := []internal.ImportTarget{
+		{Target: internal.Target{Owner: "u", Name: "r1", Branch: "main"}, OrgID: "org-1", IntegrationID: "int-1"},
+	}
+	batch2 := []internal.ImportTarget{
+		{Target: internal.Target{Owner: "u", Name: "r2"}, OrgID: "org-2", IntegrationID: "int-2"},
+		{Target: internal.Target{Name: "nginx:1.25"}, OrgID: "org-2", IntegrationID: "int-3"},
+	}
+	mergeRefreshMeta(&w.meta, refreshOrgResult{orgMeta: map[string]OrgMeta{"org-1": {Name: "O1"}}, intMeta: map[string]string{"int-1": "github"}})
+	mergeRefreshMeta(&w.meta, refreshOrgResult{orgMeta: map[string]OrgMeta{"org-2": {Name: "O2", Slug: "o2"}}, intMeta: map[string]string{"int-2": "github", "int-3": "docker-hub"}})
+	if err := w.writeTargets(batch1); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.writeTargets(batch2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	want := w.meta
+	want.Targets = append(batch1, batch2...)
+	wantJSON, _ := json.MarshalIndent(want, "", "  ")
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(wantJSON) {
+		t.Errorf("streamed output differs from MarshalIndent:\n%s\nwant:\n%s", got, wantJSON)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRefreshWriter_NoTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export-targets.json")
+	if _, err := writeRefreshOutput(RefreshOutput{Orgs: map[string]OrgMeta{}, Integrations: map[string]string{}}, path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	if string(decoded["targets"]) != "[]" {
+		t.Errorf("targets = %s, want []", decoded["targets"])
+	}
+}
+
 // TestWriteRefreshOutput_InvalidPath verifies that path traversal is rejected.
 // The caller of writeRefreshOutput must pass a path from sanitizeOutputPath;
 // sanitizeOutputPath is what rejects paths like "../evil.json".
@@ -1025,3 +1691,962 @@ func TestRefreshOutput_JSONRoundTrip(t *testing.T) {
 		t.Errorf("Targets mismatch: got %+v", decoded.Targets)
 	}
 }
+
+// --- Transform hook ---
+
+func TestHookResponseApply(t *testing.T) {
+	it := internal.ImportTarget{Target: internal.Target{Owner: "o", Name: "r"}, OrgID: "org-1", IntegrationID: "int-1"}
+	modified := internal.ImportTarget{Target: internal.Target{Owner: "o", Name: "r"}, OrgID: "org-1", IntegrationID: "int-2"}
+
+	tests := []struct {
+		name     string
+		resp     hookResponse
+		want     internal.ImportTarget
+		wantKeep bool
+		wantErr  bool
+	}{
+		{"accept", hookResponse{Action: "accept"}, it, true, false},
+		{"reject", hookResponse{Action: "reject"}, it, false, false},
+		{"modify", hookResponse{Action: "modify", Target: &modified}, modified, true, false},
+		{"modify without target", hookResponse{Action: "modify"}, it, false, true},
+		{"modify without integration", hookResponse{Action: "modify", Target: &internal.ImportTarget{OrgID: "org-1"}}, it, false, true},
+		{"unknown action", hookResponse{Action: "maybe"}, it, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, keep, err := tt.resp.apply(it)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (keep != tt.wantKeep || got != tt.want) {
+				t.Errorf("apply = %+v, %v; want %+v, %v", got, keep, tt.want, tt.wantKeep)
+			}
+		})
+	}
+}
+
+// TestProcessOrgForRefresh_TransformHook checks that rejected targets are dropped
+// and that modified targets are deduplicated against each other.
+func TestProcessOrgForRefresh_TransformHook(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockSnykAPI{
+		Integrations: map[string]string{"github": "int-github", "github-enterprise": "int-ghe"},
+		Projects: []internal.Project{
+			{Name: "archived/repo:package.json", Origin: "github"},
+			{Name: "acme/a:package.json", Origin: "github"},
+			{Name: "acme/a:go.mod", Origin: "github-enterprise"},
+		},
+	}
+	calls := 0
+	transform := func(_ context.Context, _ internal.Org, p internal.Project, it internal.ImportTarget) (internal.ImportTarget, bool, error) {
+		calls++
+		if it.Target.Owner == "archived" {
+			return it, false, nil
+		}
+		it.IntegrationID = "int-ghe" // route everything in acme to GHE
+		return it, true, nil
+	}
+	res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, refreshOptions{transform: transform})
+	if res.err != nil {
+		t.Fatalf("processOrgForRefresh: %v", res.err)
+	}
+	if calls != 3 {
+		t.Errorf("transform called %d times, want 3", calls)
+	}
+	if len(res.targets) != 1 || res.targets[0].IntegrationID != "int-ghe" {
+		t.Errorf("targets = %+v, want one acme/a target on int-ghe", res.targets)
+	}
+}
+
+// TestProcessOrgForRefresh_TransformHookInvalidTarget checks that a hook
+// cannot move a target to another org or to an integration the org lacks.
+func TestProcessOrgForRefresh_TransformHookInvalidTarget(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockSnykAPI{
+		Integrations: map[string]string{"github": "int-github"},
+		Projects:     []internal.Project{{Name: "acme/a:package.json", Origin: "github"}},
+	}
+	for _, tt := range []struct {
+		name   string
+		modify func(it *internal.ImportTarget)
+		want   string
+	}{
+		{"other org", func(it *internal.ImportTarget) { it.OrgID = "org-2" }, `moved to org "org-2"`},
+		{"unknown integration", func(it *internal.ImportTarget) { it.IntegrationID = "int-gitlab" }, `integration "int-gitlab"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			transform := func(_ context.Context, _ internal.Org, _ internal.Project, it internal.ImportTarget) (internal.ImportTarget, bool, error) {
+				tt.modify(&it)
+				return it, true, nil
+			}
+			res := processOrgForRefresh(ctx, mock, internal.Org{ID: "org-1"}, refreshOptions{transform: transform})
+			if res.err == nil || !strings.Contains(res.err.Error(), tt.want) || len(res.targets) != 0 {
+				t.Errorf("err = %v, targets = %+v; want error containing %q", res.err, res.targets, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecTransform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script hook")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	body := `#!/bin/sh
+input=$(cat)
+case "$input" in
+  *'"owner":"skip"'*) echo '{"action":"reject"}' ;;
+  *'"origin":"github"'*) echo '{"action":"accept"}' ;;
+  *) echo "bad input" >&2; exit 3 ;;
+esac
+`
+	if err := os.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	transform, err := newExecTransform(script, 5*time.Second)
+	if err != nil {
+		t.Fatalf("newExecTransform: %v", err)
+	}
+	ctx := context.Background()
+	org := internal.Org{ID: "org-1"}
+
+	_, keep, err := transform(ctx, org, internal.Project{Origin: "github"}, internal.ImportTarget{Target: internal.Target{Owner: "acme"}})
+	if err != nil || !keep {
+		t.Errorf("accept: keep=%v err=%v", keep, err)
+	}
+	_, keep, err = transform(ctx, org, internal.Project{Origin: "github"}, internal.ImportTarget{Target: internal.Target{Owner: "skip"}})
+	if err != nil || keep {
+		t.Errorf("reject: keep=%v err=%v", keep, err)
+	}
+	if _, _, err := transform(ctx, org, internal.Project{Origin: "azure-repos"}, internal.ImportTarget{}); err == nil {
+		t.Error("non-zero exit: want error")
+	}
+
+	if _, err := newExecTransform(filepath.Join(dir, "missing"), time.Second); err == nil {
+		t.Error("missing executable: want error")
+	}
+}
+
+// mockDoctorAPI adds the doctor-only calls to mockSnykAPI.
+type mockDoctorAPI struct {
+	*mockSnykAPI
+	Self          internal.Self
+	SelfErr       error
+	Groups        []internal.Group
+	DeleteAllowed bool
+}
+
+func (m *mockDoctorAPI) FetchSelf(ctx context.Context) (internal.Self, error) {
+	return m.Self, m.SelfErr
+}
+
+func (m *mockDoctorAPI) FetchGroups(ctx context.Context) ([]internal.Group, error) {
+	return m.Groups, nil
+}
+
+func (m *mockDoctorAPI) ProbeListProjects(ctx context.Context, orgID string) error {
+	return m.ProjectsErr
+}
+
+func (m *mockDoctorAPI) ProbeProjectDelete(ctx context.Context, orgID string) (bool, error) {
+	return m.DeleteAllowed, nil
+}
+
+func TestRunDoctorChecks(t *testing.T) {
+	ctx := context.Background()
+	newAPI := func() *mockDoctorAPI {
+		return &mockDoctorAPI{
+			mockSnykAPI: &mockSnykAPI{
+				Orgs:         []internal.Org{{ID: "org-1", Name: "Org 1"}},
+				Integrations: map[string]string{"github": "int-gh", "docker-hub": "int-dh"},
+				Projects:     []internal.Project{{ID: "p1"}},
+			},
+			Self:          internal.Self{ID: "u1", Type: "user", Name: "Jo", Email: "jo@example.com"},
+			Groups:        []internal.Group{{ID: "group-1", Name: "Acme"}},
+			DeleteAllowed: true,
+		}
+	}
+	statuses := func(checks []doctorCheck) map[string]string {
+		out := make(map[string]string)
+		for _, c := range checks {
+			out[c.name] = c.status
+		}
+		return out
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		checks := runDoctorChecks(ctx, newAPI(), "https://api.snyk.io", "group-1", "")
+		if doctorFailed(checks) {
+			t.Fatalf("unexpected failure: %+v", checks)
+		}
+		for name, status := range statuses(checks) {
+			if status != checkOK {
+				t.Errorf("%s = %s, want OK", name, status)
+			}
+		}
+	})
+
+	t.Run("token rejected suggests other regions", func(t *testing.T) {
+		api := newAPI()
+		api.SelfErr = fmt.Errorf("fetch self: %w", &internal.APIError{Method: "GET", Path: "/rest/self", StatusCode: 401})
+		checks := runDoctorChecks(ctx, api, "https://api.snyk.io", "group-1", "")
+		if len(checks) != 1 || checks[0].status != checkFail {
+			t.Fatalf("checks = %+v", checks)
+		}
+		if !strings.Contains(checks[0].hint, "SNYK_API=https://api.eu.snyk.io") || strings.Contains(checks[0].hint, "SNYK_API=https://api.snyk.io") {
+			t.Errorf("hint = %q", checks[0].hint)
+		}
+	})
+
+	t.Run("unknown group and no delete permission", func(t *testing.T) {
+		api := newAPI()
+		api.DeleteAllowed = false
+		checks := runDoctorChecks(ctx, api, "https://api.snyk.io", "group-2", "")
+		got := statuses(checks)
+		if got["Groups"] != checkFail || got["Delete permission"] != checkWarn {
+			t.Errorf("statuses = %v", got)
+		}
+	})
+
+	t.Run("projects cannot be listed", func(t *testing.T) {
+		api := newAPI()
+		api.ProjectsErr = fmt.Errorf("list projects: %w", &internal.APIError{Method: "GET", Path: "/rest/orgs/org-1/projects", StatusCode: 403})
+		checks := runDoctorChecks(ctx, api, "https://api.snyk.io", "group-1", "")
+		if got := statuses(checks); got["Projects"] != checkFail {
+			t.Errorf("statuses = %v", got)
+		}
+	})
+
+	t.Run("no org given", func(t *testing.T) {
+		checks := runDoctorChecks(ctx, newAPI(), "https://api.snyk.io", "", "")
+		if got := statuses(checks); got["Org permissions"] != checkWarn || got["Projects"] != "" {
+			t.Errorf("statuses = %v", got)
+		}
+	})
+}
+
+func TestPrintDoctorChecks(t *testing.T) {
+	var buf bytes.Buffer
+	printDoctorChecks(&buf, []doctorCheck{
+		{name: "Credentials", status: checkOK, detail: "user Jo", hint: "hidden"},
+		{name: "Delete permission", status: checkWarn, detail: "denied", hint: "line one\nline two"},
+	})
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "[WARN] Delete permission") || !strings.Contains(out, "line two") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestRunSummary_Finish(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		processed     int
+		failed        int
+		deleteFailed  int
+		noop          bool
+		failOnPartial bool
+		status        runStatus
+		code          int
+	}{
+		{"success", 2, 0, 0, false, false, statusSuccess, exitOK},
+		{"noop", 2, 0, 0, true, false, statusNoop, exitNoop},
+		{"partial", 1, 1, 0, true, false, statusPartial, exitOK},
+		{"partial, failing", 1, 1, 0, false, true, statusPartial, exitPartial},
+		{"failed deletions", 2, 0, 1, false, true, statusPartial, exitPartial},
+		{"every org failed", 0, 2, 0, true, true, statusFailed, exitFatal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &runSummary{failOnPartial: tc.failOnPartial, Dedup: &dedupSummary{TargetDeleteFailures: tc.deleteFailed}}
+			s.Orgs.Processed = tc.processed
+			for i := 0; i < tc.failed; i++ {
+				s.orgFailed(fmt.Sprintf("org-%d", i), "", &internal.APIError{StatusCode: 500})
+			}
+			if code := s.finish(tc.noop); code != tc.code || s.Status != tc.status || s.ExitCode != tc.code {
+				t.Errorf("finish = %d (%s), want %d (%s)", code, s.Status, tc.code, tc.status)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	s := &runSummary{Command: "dedup", file: path, StartedAt: time.Now()}
+	if code := s.fail(errors.New("fetch orgs: boom")); code != exitFatal {
+		t.Errorf("fail = %d", code)
+	}
+	if got := readSummary(t, path); got.Status != statusFailed || got.Error != "fetch orgs: boom" || got.ExitCode != exitFatal {
+		t.Errorf("summary = %+v", got)
+	}
+}
+
+func TestOrgFailures(t *testing.T) {
+	f := orgFailures{}
+	f.add("org-a", fmt.Errorf("fetch projects: %w", &internal.APIError{StatusCode: 403}))
+	f.add("org-b", fmt.Errorf("list integrations: %w", &internal.APIError{StatusCode: 403}))
+	f.add("org-c", fmt.Errorf("fetch projects: %w", &internal.APIError{StatusCode: 502}))
+	if f.count() != 3 {
+		t.Errorf("count = %d, want 3", f.count())
+	}
+	var buf bytes.Buffer
+	f.print(&buf)
+	out := buf.String()
+	if !strings.Contains(out, "permission (2): org-a, org-b") || !strings.Contains(out, "server (1): org-c") {
+		t.Errorf("output:\n%s", out)
+	}
+	if strings.Index(out, "permission") > strings.Index(out, "server") {
+		t.Errorf("classes not sorted:\n%s", out)
+	}
+}
+
+func TestProjectGrouper_GroupWide(t *testing.T) {
+	g := newProjectGrouper(false)
+	o1 := g.addOrg("org-1", "Org 1")
+	o2 := g.addOrg("org-2", "Org 2")
+	o3 := g.addOrg("org-3", "Org 3")
+	g.add(o2, []internal.Project{{ID: "p2", Name: "repo", Origin: "github", Created: "2021-01-01", Tags: []internal.Tag{{Key: "k"}}}})
+	g.add(o1, []internal.Project{{ID: "p1", Name: "repo", Origin: "github", Created: "2020-01-01"}, {ID: "p4", Name: "solo", Created: "2020-01-01"}})
+	g.add(o3, []internal.Project{{ID: "p3", Name: "repo", Origin: "github", Created: "2019-01-01"}})
+	g.dropOrg(o3) // e.g. org 3 failed part way through
+
+	groups := g.groupWide()
+	if len(groups) != 1 || len(groups[0].items) != 2 {
+		t.Fatalf("groups = %+v", groups)
+	}
+	keep, dup := groups[0].items[0], groups[0].items[1]
+	if keep.orgID != "org-1" || keep.project.ID != "p1" || dup.orgLabel != "Org 2" || dup.project.Name != "repo" || dup.project.Origin != "github" {
+		t.Errorf("items = %+v", groups[0].items)
+	}
+	if dup.project.Tags != nil {
+		t.Error("compact projects should not keep tags")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"debug": slog.LevelDebug, "": slog.LevelInfo, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := parseLogLevel(in); err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestLogFlags_Setup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	logFile := filepath.Join(t.TempDir(), "run.log")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts := addLogFlags(fs)
+	if err := fs.Parse([]string{"--logFormat=json", "--logFile=" + logFile, "--quiet"}); err != nil {
+		t.Fatal(err)
+	}
+	closeLog, err := opts.setup()
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	slog.Warn("dropped by --quiet")
+	slog.Error("failed to process org", orgAttrs("org-1", "Org One"), "error_class", "permission")
+	closeLog()
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log lines = %q, want only the error", lines)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("not JSON: %s", lines[0])
+	}
+	if rec["level"] != "ERROR" || rec["org_id"] != "org-1" || rec["org"] != "Org One" || rec["error_class"] != "permission" {
+		t.Errorf("record = %v", rec)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	opts = addLogFlags(fs)
+	if err := fs.Parse([]string{"--logFormat=xml"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opts.setup(); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestProgressFlags_ResolveMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		tty  bool
+		want string
+	}{{"auto", true, "bar"}, {"auto", false, "log"}, {"bar", false, "bar"}, {"OFF", true, "off"}} {
+		mode := tc.mode
+		f := &progressFlags{mode: &mode}
+		if got, err := f.resolveMode(tc.tty); err != nil || got != tc.want {
+			t.Errorf("resolveMode(%q, tty=%v) = %q, %v, want %q", tc.mode, tc.tty, got, err, tc.want)
+		}
+	}
+	mode := "spinner"
+	if _, err := (&progressFlags{mode: &mode}).resolveMode(true); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestStatusWriter_KeepsStatusLast(t *testing.T) {
+	var buf bytes.Buffer
+	w := &statusWriter{w: &buf}
+	w.Write([]byte("before\n"))
+	w.setStatus("[==  ] 1/2")
+	w.Write([]byte("log line\n"))
+	w.setStatus("")
+	want := "before\n[==  ] 1/2\r\033[Klog line\n[==  ] 1/2\r\033[K"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestProgress_ETA(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := newProgress(4, internal.NewRateLimiter(0, 1))
+	p.now = func() time.Time { return now }
+	p.started, p.lastSample = now, now
+
+	if s := p.snapshot(); s.ETA >= 0 || !strings.Contains(s.bar(), "ETA unknown") {
+		t.Errorf("ETA before any org finished = %v", s.ETA)
+	}
+	// Two orgs of 5 requests each finish in 10s; a third is 2 requests in.
+	for _, org := range []string{"a", "b", "c"} {
+		p.orgStarted(org)
+	}
+	for i := 0; i < 5; i++ {
+		p.request("a")
+		p.request("b")
+	}
+	p.request("c")
+	p.request("c")
+	p.orgFinished("a", nil)
+	p.orgFinished("b", nil)
+	p.page(100)
+	now = now.Add(12 * time.Second)
+
+	s := p.snapshot()
+	if s.Finished != 2 || s.InFlight != 1 || s.Pages != 1 || s.Projects != 100 || s.Rate != 1 {
+		t.Fatalf("snapshot = %+v", s)
+	}
+	// 2 orgs x 5 requests left, less the 2 already made, at 1 req/s.
+	if s.ETA != 8*time.Second {
+		t.Errorf("ETA = %v, want 8s", s.ETA)
+	}
+	if bar := s.bar(); !strings.HasPrefix(bar, "[==========          ] 2/4 orgs, 1 running, 0 failed") {
+		t.Errorf("bar = %q", bar)
+	}
+
+	// A slower limiter caps the estimate.
+	p.limiter = internal.NewRateLimiter(0.5, 1)
+	if s := p.snapshot(); s.ETA != 16*time.Second {
+		t.Errorf("ETA with a 0.5/s limiter = %v, want 16s", s.ETA)
+	}
+
+	p.orgFinished("c", errors.New("boom"))
+	p.orgStarted("d")
+	p.orgFinished("d", nil)
+	if s := p.snapshot(); s.ETA != 0 || s.Failed != 1 {
+		t.Errorf("when done: %+v", s)
+	}
+}
+
+func TestProgress_CountsPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	client := internal.NewClient(srv.Client(), internal.NewRateLimiter(0, 1))
+	client.BaseURL = srv.URL
+	mode := "off"
+	p, err := (&progressFlags{mode: &mode}).start(1, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.stop()
+
+	api := p.wrap(&mockSnykAPI{Projects: make([]internal.Project, 5), ProjectPageSize: 2})
+	err = api.StreamProjects(context.Background(), "org-1", internal.ProjectQuery{}, func([]internal.Project) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.snapshot(); s.Pages != 3 || s.Projects != 5 {
+		t.Errorf("snapshot = %+v, want 3 pages and 5 projects", s)
+	}
+}
+
+// --- End-to-end against the fake Snyk API ---
+
+func TestE2E_Refresh(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, nil)
+	const groupID = "g0000001-0001-4000-8000-000000000001"
+	for _, tt := range []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"all", nil, []string{"acme/api@github", "acme/api@github-cloud-app", "acme/search@github", "acme/web@github"}},
+		{"github only", []string{"--integrationType=github"}, []string{"acme/api@github", "acme/search@github", "acme/web@github"}},
+		{"with CLI in one org", []string{"--includeCLI", "--orgSlug=payments"}, []string{"acme/api@github", "acme/api@github-cloud-app", "acme/cli-app@github-cloud-app", "acme/web@github"}},
+		{"one target", []string{"--targetId=t0000003-0003-4000-8000-000000000003"}, []string{"acme/web@github"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "targets.json")
+			args := append([]string{"--groupId=" + groupID, "--output=" + out}, tt.args...)
+			_, stderr, code := runCLI(t, baseURL, args...)
+			if code != 0 {
+				t.Fatalf("exit %d\n%s", code, stderr)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got RefreshOutput
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			var targets []string
+			for _, it := range got.Targets {
+				targets = append(targets, it.Target.Owner+"/"+it.Target.Name+"@"+got.Integrations[it.IntegrationID])
+			}
+			sort.Strings(targets)
+			if strings.Join(targets, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("targets = %v, want %v", targets, tt.want)
+			}
+		})
+	}
+}
+
+func TestE2E_DedupDelete(t *testing.T) {
+	s, baseURL := startFakeSnyk(t, nil)
+	const orgID = "o0000001-0001-4000-8000-000000000001"
+
+	stdout, stderr, code := runCLI(t, baseURL, "dedup", "--orgId="+orgID)
+	if code != 0 || !strings.Contains(stdout, "delete:  p0000003-0003-4000-8000-000000000003") {
+		t.Fatalf("dry run: exit %d\n%s\n%s", code, stdout, stderr)
+	}
+	if len(s.Projects(orgID)) != 6 {
+		t.Fatal("dry run deleted projects")
+	}
+
+	stdout, stderr, code = runCLI(t, baseURL, "dedup", "--orgId="+orgID, "--delete")
+	if code != 0 {
+		t.Fatalf("delete: exit %d\n%s\n%s", code, stdout, stderr)
+	}
+	for _, p := range s.Projects(orgID) {
+		if p.ID == "p0000003-0003-4000-8000-000000000003" {
+			t.Error("duplicate project was not deleted")
+		}
+	}
+	for _, tg := range s.Targets(orgID) {
+		if tg.ID == "t0000002-0002-4000-8000-000000000002" {
+			t.Error("emptied duplicate target was not deleted")
+		}
+	}
+	if len(s.Targets(orgID)) != 4 {
+		t.Errorf("targets left = %d, want 4", len(s.Targets(orgID)))
+	}
+
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	stdout, _, code = runCLI(t, baseURL, "dedup", "--orgId="+orgID, "--summaryFile="+summaryFile)
+	if code != exitNoop || !strings.Contains(stdout, "No duplicates found.") {
+		t.Errorf("after delete: exit %d, want %d\n%s", code, exitNoop, stdout)
+	}
+	sum := readSummary(t, summaryFile)
+	if sum.Status != statusNoop || sum.Dedup == nil || !sum.Dedup.DryRun || sum.Orgs.Processed != 1 {
+		t.Errorf("summary = %+v", sum)
+	}
+}
+
+func TestE2E_DedupTargetID(t *testing.T) {
+	s, baseURL := startFakeSnyk(t, nil)
+	const orgID = "o0000001-0001-4000-8000-000000000001"
+
+	// The duplicate of acme/api is in target t0000002, which is filtered out.
+	stdout, stderr, code := runCLI(t, baseURL, "dedup", "--orgId="+orgID, "--delete",
+		"--targetId=t0000001-0001-4000-8000-000000000001,t0000003-0003-4000-8000-000000000003")
+	if code != exitNoop || !strings.Contains(stdout, "No duplicates found.") {
+		t.Fatalf("exit %d, want %d\n%s\n%s", code, exitNoop, stdout, stderr)
+	}
+	if len(s.Projects(orgID)) != 6 {
+		t.Error("projects outside --targetId were deleted")
+	}
+
+	stdout, stderr, code = runCLI(t, baseURL, "dedup", "--orgId="+orgID,
+		"--targetId=t0000001-0001-4000-8000-000000000001,t0000002-0002-4000-8000-000000000002")
+	if code != 0 || !strings.Contains(stdout, "delete:  p0000003-0003-4000-8000-000000000003") {
+		t.Errorf("exit %d\n%s\n%s", code, stdout, stderr)
+	}
+}
+
+// readSummary decodes a --summaryFile.
+func readSummary(t *testing.T, path string) runSummary {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum runSummary
+	if err := json.Unmarshal(data, &sum); err != nil {
+		t.Fatalf("decode summary: %v\n%s", err, data)
+	}
+	return sum
+}
+
+func TestE2E_PartialFailure(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) {
+		s.Faults = []fakesnyk.Fault{{Path: "/rest/orgs/o0000002-0002-4000-8000-000000000002/projects", Status: http.StatusForbidden}}
+	})
+	dir := t.TempDir()
+	args := []string{"--groupId=g0000001-0001-4000-8000-000000000001", "--output=" + filepath.Join(dir, "out.json"), "--summaryFile=" + filepath.Join(dir, "summary.json")}
+
+	stdout, stderr, code := runCLI(t, baseURL, args...)
+	if code != exitOK || !strings.Contains(stdout, "(1 org(s) failed)") {
+		t.Fatalf("exit %d\n%s\n%s", code, stdout, stderr)
+	}
+	sum := readSummary(t, filepath.Join(dir, "summary.json"))
+	if sum.Command != "refresh" || sum.Status != statusPartial || sum.ExitCode != exitOK || sum.GroupID == "" {
+		t.Errorf("summary = %+v", sum)
+	}
+	if sum.Orgs.Total != 2 || sum.Orgs.Processed != 1 || sum.Orgs.Failed != 1 || len(sum.Orgs.Failures) != 1 {
+		t.Fatalf("orgs = %+v", sum.Orgs)
+	}
+	if f := sum.Orgs.Failures[0]; f.OrgID != "o0000002-0002-4000-8000-000000000002" || f.Class != internal.ClassPermission || !strings.Contains(f.Error, "403") {
+		t.Errorf("failure = %+v", f)
+	}
+	if sum.Refresh == nil || sum.Refresh.Targets != 3 || sum.Refresh.Output == "" || sum.DurationSeconds <= 0 {
+		t.Errorf("refresh = %+v, duration %v", sum.Refresh, sum.DurationSeconds)
+	}
+
+	if _, stderr, code := runCLI(t, baseURL, append(args, "--failOnPartial")...); code != exitPartial {
+		t.Errorf("--failOnPartial: exit %d, want %d\n%s", code, exitPartial, stderr)
+	}
+}
+
+func TestE2E_JSONLogs(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) { s.RateLimitEvery = 3 })
+	stdout, stderr, code := runCLI(t, baseURL, "--orgId=o0000001-0001-4000-8000-000000000001",
+		"--output="+filepath.Join(t.TempDir(), "out.json"), "--logFormat=json", "--logLevel=debug")
+	if code != 0 {
+		t.Fatalf("exit %d\n%s", code, stderr)
+	}
+	if strings.Contains(stdout, `"level"`) {
+		t.Errorf("log records on stdout:\n%s", stdout)
+	}
+	var sawResponse, saw429 bool
+	for _, line := range strings.Split(strings.TrimSpace(stderr), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("stderr line is not JSON: %s", line)
+		}
+		switch rec["msg"] {
+		case "api response":
+			sawResponse = sawResponse || rec["org_id"] == "o0000001-0001-4000-8000-000000000001" && rec["attempt"] != nil
+		case "rate limited (429)":
+			saw429 = true
+		}
+	}
+	if !sawResponse || !saw429 {
+		t.Errorf("missing api response or 429 records:\n%s", stderr)
+	}
+}
+
+func TestE2E_Telemetry(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) { s.RateLimitEvery = 4 })
+	traces := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		traces <- body
+	}))
+	defer collector.Close()
+
+	dir := t.TempDir()
+	metricsFile := filepath.Join(dir, "snyk.prom")
+	_, stderr, code := runCLI(t, baseURL, "--groupId=g0000001-0001-4000-8000-000000000001", "--output="+filepath.Join(dir, "out.json"),
+		"--metricsFile="+metricsFile, "--otlpEndpoint="+collector.URL)
+	if code != 0 {
+		t.Fatalf("exit %d\n%s", code, stderr)
+	}
+
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`snyk_target_export_orgs_processed_total{result="ok"} 2`,
+		"snyk_target_export_targets_exported_total 4",
+		`snyk_target_export_api_rate_limited_total{endpoint=`,
+		`snyk_target_export_api_requests_total{method="GET",endpoint="/rest/orgs/{id}/projects",status="200"} `,
+		"snyk_target_export_run_duration_seconds ",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics missing %q:\n%s", want, data)
+		}
+	}
+
+	var body []byte
+	select {
+	case body = <-traces:
+	default:
+		t.Fatal("no traces exported")
+	}
+	var got struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct{ Name, SpanID, ParentSpanID string }
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]int{}
+	for _, s := range got.ResourceSpans[0].ScopeSpans[0].Spans {
+		names[s.Name]++
+	}
+	if names["refresh"] != 1 || names["org"] != 2 || names["GET /rest/orgs/{id}/projects"] < 2 || names["GET /rest/orgs"] == 0 {
+		t.Errorf("span names = %v", names)
+	}
+}
+
+func TestE2E_ConfigProfile(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) { s.Token = "eu-token" })
+	t.Setenv("E2E_EU_TOKEN", "eu-token")
+	dir := t.TempDir()
+	out := filepath.Join(dir, "targets.json")
+	config := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(`
+[profile.eu-prod]
+apiUrl = %q
+tokenEnv = "E2E_EU_TOKEN"
+groupId = "g0000001-0001-4000-8000-000000000001"
+
+[profile.eu-prod.refresh]
+integrationType = "github"
+output = %q
+`, baseURL, out)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// SNYK_API points nowhere: the profile's apiUrl and token must be used.
+	_, stderr, code := runCLI(t, "http://127.0.0.1:1", "--config="+config, "--profile=eu-prod")
+	if code != 0 {
+		t.Fatalf("exit %d\n%s", code, stderr)
+	}
+	var got RefreshOutput
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if len(got.Targets) != 3 {
+		t.Errorf("targets = %d, want the 3 github targets", len(got.Targets))
+	}
+}
+
+func TestE2E_MultiGroup(t *testing.T) {
+	const usGroup, euGroup = "g0000001-0001-4000-8000-000000000001", "g0000002-0001-4000-8000-000000000001"
+	_, usURL := startFakeSnyk(t, nil)
+	// A second tenant with its own group, org IDs and token.
+	raw, err := os.ReadFile(filepath.Join("testdata", "fakesnyk_data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	euData := filepath.Join(t.TempDir(), "eu.json")
+	raw = []byte(strings.NewReplacer("g0000001-", "g0000002-", "\"o0000", "\"o9000").Replace(string(raw)))
+	if err := os.WriteFile(euData, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fakesnyk.LoadData(euData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eu := fakesnyk.New(data)
+	eu.Token = "eu-token"
+	eu.MaxPageSize = 2
+	euSrv := httptest.NewServer(eu)
+	t.Cleanup(euSrv.Close)
+	t.Setenv("E2E_EU_TOKEN", "eu-token")
+
+	groups := []string{"--group=" + usGroup + ",name=us", "--group=" + euGroup + ",api=" + euSrv.URL + ",tokenEnv=E2E_EU_TOKEN,name=eu"}
+
+	t.Run("combined", func(t *testing.T) {
+		dir := t.TempDir()
+		out := filepath.Join(dir, "targets.json")
+		args := append([]string{"--output=" + out, "--summaryFile=" + filepath.Join(dir, "summary.json")}, groups...)
+		stdout, stderr, code := runCLI(t, usURL, args...)
+		if code != 0 {
+			t.Fatalf("exit %d\n%s", code, stderr)
+		}
+		var got RefreshOutput
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("decode output: %v", err)
+		}
+		if got.GroupID != "" || len(got.Groups) != 2 || got.Groups[euGroup].APIURL != euSrv.URL || got.Groups[usGroup].Name != "us" {
+			t.Errorf("groupId = %q, groups = %+v", got.GroupID, got.Groups)
+		}
+		perGroup := map[string]int{}
+		for _, it := range got.Targets {
+			perGroup[got.Orgs[it.OrgID].GroupID]++
+		}
+		if perGroup[usGroup] != 4 || perGroup[euGroup] != 4 {
+			t.Errorf("targets per group = %v, want 4 each", perGroup)
+		}
+		if !strings.Contains(stdout, "in 2 group(s)") || !strings.Contains(stdout, "spans several API URLs") {
+			t.Errorf("stdout:\n%s", stdout)
+		}
+		sum := readSummary(t, filepath.Join(dir, "summary.json"))
+		if len(sum.Groups) != 2 || sum.Refresh.Output != out {
+			t.Errorf("summary groups = %v, output = %q", sum.Groups, sum.Refresh.Output)
+		}
+	})
+
+	t.Run("per group", func(t *testing.T) {
+		dir := t.TempDir()
+		args := append([]string{"--output=" + filepath.Join(dir, "targets-{group}.json")}, groups...)
+		stdout, stderr, code := runCLI(t, usURL, args...)
+		if code != 0 {
+			t.Fatalf("exit %d\n%s", code, stderr)
+		}
+		for name, groupID := range map[string]string{"us": usGroup, "eu": euGroup} {
+			data, err := os.ReadFile(filepath.Join(dir, "targets-"+name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got RefreshOutput
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			if got.GroupID != groupID || len(got.Groups) != 1 || len(got.Targets) != 4 {
+				t.Errorf("%s: groupId = %q, groups = %+v, %d targets", name, got.GroupID, got.Groups, len(got.Targets))
+			}
+		}
+		if !strings.Contains(stdout, "SNYK_API="+euSrv.URL+" snyk-api-import import --file="+filepath.Join(dir, "targets-eu.json")) {
+			t.Errorf("stdout:\n%s", stdout)
+		}
+	})
+}
+
+func TestE2E_ShardAndMerge(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, nil)
+	const groupID = "g0000001-0001-4000-8000-000000000001"
+	dir := t.TempDir()
+	readOutput := func(path string) RefreshOutput {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out RefreshOutput
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+		return out
+	}
+
+	full := filepath.Join(dir, "full.json")
+	if _, stderr, code := runCLI(t, baseURL, "--groupId="+groupID, "--output="+full); code != 0 {
+		t.Fatalf("full run: exit %d\n%s", code, stderr)
+	}
+	var parts, summaries []string
+	orgs := 0
+	for i := 1; i <= 2; i++ {
+		part := filepath.Join(dir, fmt.Sprintf("part-%d.json", i))
+		summary := filepath.Join(dir, fmt.Sprintf("summary-%d.json", i))
+		// A shard may have no targets (exit 3).
+		if _, stderr, code := runCLI(t, baseURL, "--groupId="+groupID, "--output="+part, "--summaryFile="+summary, fmt.Sprintf("--shard=%d/2", i)); code != 0 && code != exitNoop {
+			t.Fatalf("shard %d: exit %d\n%s", i, code, stderr)
+		}
+		orgs += len(readOutput(part).Orgs)
+		parts = append(parts, part)
+		summaries = append(summaries, summary)
+	}
+	want := readOutput(full)
+	if orgs != len(want.Orgs) {
+		t.Errorf("shards have %d orgs, want %d", orgs, len(want.Orgs))
+	}
+
+	merged := filepath.Join(dir, "merged.json")
+	// Merging a part twice must not duplicate its targets.
+	stdout, stderr, code := runCLI(t, baseURL, append([]string{"merge", "--output=" + merged}, append(parts, parts[0])...)...)
+	if code != 0 {
+		t.Fatalf("merge: exit %d\n%s", code, stderr)
+	}
+	got := readOutput(merged)
+	if got.GroupID != groupID || len(got.Targets) != len(want.Targets) || len(got.Orgs) != len(want.Orgs) || !strings.Contains(stdout, "Output written to: "+merged) {
+		t.Errorf("merged: groupId %q, %d targets (want %d), %d orgs (want %d)\n%s", got.GroupID, len(got.Targets), len(want.Targets), len(got.Orgs), len(want.Orgs), stdout)
+	}
+
+	mergedSummary := filepath.Join(dir, "merged-summary.json")
+	if _, stderr, code := runCLI(t, baseURL, append([]string{"merge", "--output=" + mergedSummary}, summaries...)...); code != 0 {
+		t.Fatalf("merge summaries: exit %d\n%s", code, stderr)
+	}
+	sum := readSummary(t, mergedSummary)
+	if sum.Command != "refresh" || sum.Orgs.Total != len(want.Orgs) || sum.Refresh.Targets != len(want.Targets) || len(sum.Refresh.Outputs) != 2 {
+		t.Errorf("merged summary = %+v, refresh = %+v", sum, sum.Refresh)
+	}
+
+	if _, _, code := runCLI(t, baseURL, "merge", "--output="+filepath.Join(dir, "x.json"), parts[0], summaries[0]); code != exitFatal {
+		t.Errorf("mixed inputs: exit %d, want %d", code, exitFatal)
+	}
+	if _, stderr, code := runCLI(t, baseURL, "dedup", "--groupId="+groupID, "--shard=1/2", "--withinOrg=false"); code != exitFatal || !strings.Contains(stderr, "--shard requires --withinOrg") {
+		t.Errorf("dedup group-wide shard: exit %d\n%s", code, stderr)
+	}
+}
+
+func TestE2E_TelemetryOnFatalError(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) {
+		s.Faults = []fakesnyk.Fault{{Path: "/rest/orgs", Status: http.StatusForbidden}}
+	})
+	traces := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		traces <- body
+	}))
+	defer collector.Close()
+	dir := t.TempDir()
+	metricsFile := filepath.Join(dir, "snyk.prom")
+	_, stderr, code := runCLI(t, baseURL, "--groupId=g0000001-0001-4000-8000-000000000001", "--output="+filepath.Join(dir, "out.json"),
+		"--metricsFile="+metricsFile, "--otlpEndpoint="+collector.URL)
+	if code != exitFatal {
+		t.Fatalf("exit %d, want %d\n%s", code, exitFatal, stderr)
+	}
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("a failed run must still write metrics: %v", err)
+	}
+	for _, want := range []string{
+		`snyk_target_export_api_requests_total{method="GET",endpoint="/rest/orgs",status="403"} 1`,
+		"snyk_target_export_last_run_timestamp_seconds ",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics missing %q:\n%s", want, data)
+		}
+	}
+	select {
+	case body := <-traces:
+		// The run span ends with the error that stopped the run.
+		if !strings.Contains(string(body), `"name":"refresh"`) || !strings.Contains(string(body), `"code":2,"message":"fetch orgs`) {
+			t.Errorf("run span has no error status:\n%s", body)
+		}
+	default:
+		t.Fatal("no traces exported")
+	}
+}
+
+func TestE2E_WrongToken(t *testing.T) {
+	_, baseURL := startFakeSnyk(t, func(s *fakesnyk.Server) { s.Token = "another-token" })
+	_, stderr, code := runCLI(t, baseURL, "--groupId=g0000001-0001-4000-8000-000000000001", "--output="+filepath.Join(t.TempDir(), "out.json"))
+	if code != 1 || !strings.Contains(stderr, "status 401") {
+		t.Errorf("exit %d\n%s", code, stderr)
+	}
+}
@@ -0,0 +1,232 @@
+// merge.go implements the merge subcommand: combine the refresh outputs or
+// run summaries of several jobs, e.g. the shards of a --shard run.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// runMerge implements the merge subcommand.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("output", "export-targets.json", "Merged output file path")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: snyk-target-export merge [--output=<file>] <file>...\n\n"+
+			"Merges refresh outputs (targets deduplicated) or --summaryFile run summaries.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no files to merge\n")
+		fs.Usage()
+		return exitFatal
+	}
+	safePath, err := sanitizeOutputPath(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	msg, err := mergeFiles(fs.Args(), safePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	fmt.Printf("%s\nOutput written to: %s\n", msg, safePath)
+	return exitOK
+}
+
+// mergeFiles merges paths, which must all be refresh outputs or all run
+// summaries, into safePath and returns a one-line description of the result.
+func mergeFiles(paths []string, safePath string) (string, error) {
+	var outputs []RefreshOutput
+	var summaries []runSummary
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		switch {
+		case probe["targets"] != nil:
+			var out RefreshOutput
+			if err := json.Unmarshal(data, &out); err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			outputs = append(outputs, out)
+		case probe["command"] != nil:
+			var sum runSummary
+			if err := json.Unmarshal(data, &sum); err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			summaries = append(summaries, sum)
+		default:
+			return "", fmt.Errorf("%s: neither a refresh output nor a run summary", path)
+		}
+	}
+	if len(outputs) > 0 && len(summaries) > 0 {
+		return "", errors.New("cannot merge refresh outputs with run summaries")
+	}
+
+	if len(summaries) > 0 {
+		merged, err := mergeSummaries(summaries)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.MarshalIndent(merged, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("encoding summary: %w", err)
+		}
+		if err := os.WriteFile(safePath, append(data, '\n'), 0o644); err != nil {
+			return "", fmt.Errorf("writing summary: %w", err)
+		}
+		return fmt.Sprintf("Merged %d %s summaries: status %s, %d org(s), %d failed", len(summaries), merged.Command, merged.Status, merged.Orgs.Total, merged.Orgs.Failed), nil
+	}
+
+	merged, dropped := mergeRefreshOutputs(outputs)
+	if _, err := writeRefreshOutput(merged, safePath); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Merged %d outputs: %d target(s) across %d org(s), %d duplicate(s) dropped", len(outputs), len(merged.Targets), len(merged.Orgs), dropped), nil
+}
+
+// mergeRefreshOutputs combines refresh outputs, keeping the first of targets
+// with the same internal.TargetID, and returns the number dropped. When the
+// outputs are for different groups, each org records the group of its output.
+func mergeRefreshOutputs(outputs []RefreshOutput) (RefreshOutput, int) {
+	merged := RefreshOutput{
+		Orgs:         make(map[string]OrgMeta),
+		Integrations: make(map[string]string),
+		Targets:      []internal.ImportTarget{},
+	}
+	sameGroup := true
+	for _, out := range outputs[1:] {
+		sameGroup = sameGroup && out.GroupID == outputs[0].GroupID
+	}
+	if sameGroup {
+		merged.GroupID = outputs[0].GroupID
+	}
+	seen := make(map[string]bool)
+	dropped := 0
+	for _, out := range outputs {
+		for id, g := range out.Groups {
+			if merged.Groups == nil {
+				merged.Groups = make(map[string]GroupMeta)
+			}
+			merged.Groups[id] = g
+		}
+		for id, m := range out.Orgs {
+			if m.GroupID == "" && !sameGroup {
+				m.GroupID = out.GroupID
+			}
+			merged.Orgs[id] = m
+		}
+		for id, typ := range out.Integrations {
+			merged.Integrations[id] = typ
+		}
+		for _, t := range out.Targets {
+			tid := internal.TargetID(t.OrgID, t.IntegrationID, t.Target)
+			if seen[tid] {
+				dropped++
+				continue
+			}
+			seen[tid] = true
+			merged.Targets = append(merged.Targets, t)
+		}
+	}
+	return merged, dropped
+}
+
+// mergeSummaries combines the run summaries of one command: counts are
+// added up and the status is the worst of the inputs (failed, partial,
+// success, then noop, which requires every input to be a noop).
+func mergeSummaries(summaries []runSummary) (runSummary, error) {
+	merged := runSummary{Command: summaries[0].Command, GroupID: summaries[0].GroupID, StartedAt: summaries[0].StartedAt}
+	var end time.Time
+	var errs []string
+	rank := map[runStatus]int{statusNoop: 0, statusSuccess: 1, statusPartial: 2, statusFailed: 3}
+	merged.Status = statusNoop
+	groups := make(map[string]bool)
+	for _, s := range summaries {
+		if s.Command != merged.Command {
+			return runSummary{}, fmt.Errorf("cannot merge %s and %s summaries", merged.Command, s.Command)
+		}
+		if s.GroupID != merged.GroupID {
+			merged.GroupID = ""
+		}
+		for _, g := range s.Groups {
+			if !groups[g] {
+				groups[g] = true
+				merged.Groups = append(merged.Groups, g)
+			}
+		}
+		if s.StartedAt.Before(merged.StartedAt) {
+			merged.StartedAt = s.StartedAt
+		}
+		if e := s.StartedAt.Add(time.Duration(s.DurationSeconds * float64(time.Second))); e.After(end) {
+			end = e
+		}
+		switch {
+		case rank[s.Status] > rank[merged.Status]:
+			merged.Status, merged.ExitCode = s.Status, s.ExitCode
+		case s.Status == merged.Status && s.ExitCode > merged.ExitCode:
+			merged.ExitCode = s.ExitCode // a partial run with --failOnPartial
+		}
+		if s.Error != "" {
+			label := s.Shard
+			if label == "" {
+				label = s.Command
+			}
+			errs = append(errs, label+": "+s.Error)
+		}
+		merged.Orgs.Total += s.Orgs.Total
+		merged.Orgs.Processed += s.Orgs.Processed
+		merged.Orgs.Failed += s.Orgs.Failed
+		merged.Orgs.Failures = append(merged.Orgs.Failures, s.Orgs.Failures...)
+		if r := s.Refresh; r != nil {
+			if merged.Refresh == nil {
+				merged.Refresh = &refreshSummary{}
+			}
+			merged.Refresh.Targets += r.Targets
+			merged.Refresh.GitLabProjectsSkipped += r.GitLabProjectsSkipped
+			if r.Output != "" {
+				merged.Refresh.Outputs = append(merged.Refresh.Outputs, r.Output)
+			}
+			merged.Refresh.Outputs = append(merged.Refresh.Outputs, r.Outputs...)
+		}
+		if d := s.Dedup; d != nil {
+			if merged.Dedup == nil {
+				merged.Dedup = &dedupSummary{DryRun: true}
+			}
+			merged.Dedup.DryRun = merged.Dedup.DryRun && d.DryRun
+			merged.Dedup.DuplicateProjects += d.DuplicateProjects
+			merged.Dedup.ProjectsDeleted += d.ProjectsDeleted
+			merged.Dedup.ProjectDeleteFailures += d.ProjectDeleteFailures
+			merged.Dedup.EmptyTargets += d.EmptyTargets
+			merged.Dedup.TargetsDeleted += d.TargetsDeleted
+			merged.Dedup.TargetDeleteFailures += d.TargetDeleteFailures
+		}
+	}
+	if merged.Status == statusNoop {
+		merged.ExitCode = exitNoop
+	}
+	merged.Error = strings.Join(errs, "; ")
+	merged.DurationSeconds = end.Sub(merged.StartedAt).Seconds()
+	return merged, nil
+}
@@ -0,0 +1,349 @@
+// progress.go reports the progress of long org scans: a status line on a
+// terminal, otherwise a periodic "progress" log record.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// stderr is where logs are written when --logFile is not set. Writes pass
+// through unchanged unless a progress bar is shown, which is then redrawn
+// below each log line.
+var stderr = &statusWriter{w: os.Stderr}
+
+// statusWriter writes to w while keeping an optional status line as the
+// last line of output.
+type statusWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line == "" {
+		return s.w.Write(p)
+	}
+	io.WriteString(s.w, "\r\033[K")
+	n, err := s.w.Write(p)
+	io.WriteString(s.w, s.line)
+	return n, err
+}
+
+// setStatus replaces the status line; "" removes it.
+func (s *statusWriter) setStatus(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line != "" {
+		io.WriteString(s.w, "\r\033[K")
+	}
+	s.line = line
+	io.WriteString(s.w, line)
+}
+
+// progressFlags holds the raw values of the progress flags.
+type progressFlags struct {
+	mode     *string
+	interval *time.Duration
+}
+
+// addProgressFlags registers the progress flags on fs.
+func addProgressFlags(fs *flag.FlagSet) *progressFlags {
+	return &progressFlags{
+		mode:     fs.String("progress", "auto", "Progress display: bar, log, off, or auto (bar on a terminal, log otherwise)"),
+		interval: fs.Duration("progressInterval", 30*time.Second, "How often --progress=log logs progress"),
+	}
+}
+
+// resolveMode returns "bar", "log" or "off". tty reports whether stderr is
+// a terminal.
+func (f *progressFlags) resolveMode(tty bool) (string, error) {
+	switch mode := strings.ToLower(*f.mode); mode {
+	case "bar", "log", "off":
+		return mode, nil
+	case "auto", "":
+		if tty {
+			return "bar", nil
+		}
+		return "log", nil
+	}
+	return "", fmt.Errorf("invalid --progress %q: expected auto, bar, log or off", *f.mode)
+}
+
+// stderrIsTerminal reports whether stderr is an interactive terminal.
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// start begins reporting progress over total orgs, counting the requests
+// made by clients. The ETA is capped by the rate limiter only when there is
+// a single client. The caller must call stop before printing its report.
+func (f *progressFlags) start(total int, clients ...*internal.Client) (*progress, error) {
+	mode, err := f.resolveMode(stderrIsTerminal())
+	if err != nil {
+		return nil, err
+	}
+	var limiter *internal.RateLimiter
+	if len(clients) == 1 {
+		limiter = clients[0].Limiter
+	}
+	p := newProgress(total, limiter)
+	if mode == "off" {
+		return p, nil
+	}
+	for _, client := range clients {
+		addRequestObserver(client, func(ctx context.Context, info internal.RequestInfo) { p.request(info.OrgID) })
+	}
+	interval := *f.interval
+	if mode == "bar" {
+		interval = 500 * time.Millisecond
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("--progressInterval must be > 0")
+	}
+	p.done = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go p.run(mode, interval)
+	return p, nil
+}
+
+// progress tracks a scan over a fixed number of orgs.
+type progress struct {
+	total   int
+	limiter *internal.RateLimiter
+	now     func() time.Time
+
+	mu          sync.Mutex
+	started     time.Time
+	inFlight    int
+	finished    int
+	failed      int
+	pages       int
+	projects    int
+	requests    int
+	orgRequests map[string]int // requests made for each in-flight org
+	// Completed orgs' requests, for the requests-per-org estimate.
+	doneRequests int
+	doneOrgs     int
+	// Request rate, smoothed across samples.
+	rate         float64
+	lastSample   time.Time
+	lastRequests int
+
+	done    chan struct{} // closed by stop; nil when not displayed
+	stopped chan struct{} // closed when run returns
+}
+
+func newProgress(total int, limiter *internal.RateLimiter) *progress {
+	p := &progress{total: total, limiter: limiter, now: time.Now, orgRequests: make(map[string]int)}
+	p.started = p.now()
+	p.lastSample = p.started
+	return p
+}
+
+// orgStarted records that a worker began processing orgID.
+func (p *progress) orgStarted(orgID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight++
+	if _, ok := p.orgRequests[orgID]; !ok {
+		p.orgRequests[orgID] = 0
+	}
+}
+
+// orgFinished records that orgID is done; err is its failure, if any.
+func (p *progress) orgFinished(orgID string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight--
+	p.finished++
+	if err != nil {
+		p.failed++
+	} else {
+		p.doneRequests += p.orgRequests[orgID]
+		p.doneOrgs++
+	}
+	delete(p.orgRequests, orgID)
+}
+
+// page records a fetched page of n projects.
+func (p *progress) page(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages++
+	p.projects += n
+}
+
+// request records an API request attempt, attributed to orgID if it is in flight.
+func (p *progress) request(orgID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	if n, ok := p.orgRequests[orgID]; ok {
+		p.orgRequests[orgID] = n + 1
+	}
+}
+
+// progressSnapshot is the state shown to the user.
+type progressSnapshot struct {
+	Total, Finished, InFlight, Failed int
+	Pages, Projects                   int
+	Rate                              float64       // requests per second
+	ETA                               time.Duration // < 0 if unknown
+	Elapsed                           time.Duration
+}
+
+// snapshot samples the request rate and returns the current state.
+func (p *progress) snapshot() progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if dt := now.Sub(p.lastSample).Seconds(); dt > 0 {
+		sample := float64(p.requests-p.lastRequests) / dt
+		if p.lastRequests == 0 && p.rate == 0 {
+			p.rate = sample
+		} else {
+			p.rate = 0.3*sample + 0.7*p.rate
+		}
+		p.lastSample, p.lastRequests = now, p.requests
+	}
+	return progressSnapshot{
+		Total:    p.total,
+		Finished: p.finished,
+		InFlight: p.inFlight,
+		Failed:   p.failed,
+		Pages:    p.pages,
+		Projects: p.projects,
+		Rate:     p.rate,
+		ETA:      p.eta(now),
+		Elapsed:  now.Sub(p.started),
+	}
+}
+
+// eta estimates the time left from the requests the remaining orgs are
+// expected to need -- the observed requests (mostly pages) per completed
+// org -- and the request rate, capped by what the rate limiter currently
+// allows. Caller holds mu.
+func (p *progress) eta(now time.Time) time.Duration {
+	if p.finished >= p.total {
+		return 0
+	}
+	if p.doneOrgs == 0 || p.rate <= 0 {
+		return -1
+	}
+	perOrg := float64(p.doneRequests) / float64(p.doneOrgs)
+	remaining := float64(p.total-p.finished) * perOrg
+	for _, n := range p.orgRequests {
+		remaining -= min(float64(n), perOrg)
+	}
+	rate := p.rate
+	var pause time.Duration
+	if p.limiter != nil {
+		state := p.limiter.State()
+		if state.ConfiguredRPS > 0 && state.EffectiveRPS < rate {
+			rate = state.EffectiveRPS
+		}
+		if state.PausedUntil.After(now) {
+			pause = state.PausedUntil.Sub(now)
+		}
+	}
+	if remaining <= 0 {
+		return pause
+	}
+	return pause + time.Duration(remaining/rate*float64(time.Second))
+}
+
+// bar renders s as a one-line progress bar.
+func (s progressSnapshot) bar() string {
+	const width = 20
+	filled := 0
+	if s.Total > 0 {
+		filled = s.Finished * width / s.Total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d orgs, %d running, %d failed | %d pages, %d projects | %.1f req/s | ETA %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		s.Finished, s.Total, s.InFlight, s.Failed, s.Pages, s.Projects, s.Rate, formatETA(s.ETA))
+}
+
+// attrs returns s as log attributes.
+func (s progressSnapshot) attrs() []any {
+	return []any{
+		"orgs_done", s.Finished, "orgs_total", s.Total, "orgs_in_flight", s.InFlight, "orgs_failed", s.Failed,
+		"pages", s.Pages, "projects", s.Projects, "request_rate", fmt.Sprintf("%.2f/s", s.Rate),
+		"elapsed", s.Elapsed.Round(time.Second), "eta", formatETA(s.ETA),
+	}
+}
+
+// formatETA formats an estimate to the second; negative means unknown.
+func formatETA(d time.Duration) string {
+	if d < 0 {
+		return "unknown"
+	}
+	return d.Round(time.Second).String()
+}
+
+// run displays progress every interval until stop is called.
+func (p *progress) run(mode string, interval time.Duration) {
+	defer close(p.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			if mode == "bar" {
+				stderr.setStatus("")
+			}
+			return
+		case <-ticker.C:
+			s := p.snapshot()
+			if mode == "bar" {
+				stderr.setStatus(s.bar())
+			} else {
+				slog.Info("progress", s.attrs()...)
+			}
+		}
+	}
+}
+
+// stop ends the display, removing the progress bar. Safe to call more than once.
+func (p *progress) stop() {
+	if p.done == nil {
+		return
+	}
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	<-p.stopped
+}
+
+// wrap returns api with project pages counted towards p.
+func (p *progress) wrap(api SnykAPI) SnykAPI {
+	return &progressAPI{SnykAPI: api, progress: p}
+}
+
+// progressAPI counts the project pages streamed through it.
+type progressAPI struct {
+	SnykAPI
+	progress *progress
+}
+
+func (a *progressAPI) StreamProjects(ctx context.Context, orgID string, q internal.ProjectQuery, fn func([]internal.Project) error) error {
+	return a.SnykAPI.StreamProjects(ctx, orgID, q, func(page []internal.Project) error {
+		a.progress.page(len(page))
+		return fn(page)
+	})
+}
@@ -3,26 +3,33 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/snyk-playground/snyk-target-export/internal"
 )
 
 // OrgMeta holds display metadata for an org in the output JSON.
 type OrgMeta struct {
-	Name string `json:"name,omitempty"`
-	Slug string `json:"slug,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Slug    string `json:"slug,omitempty"`
+	GroupID string `json:"groupId,omitempty"` // set in --group runs
 }
 
 // RefreshOutput is the JSON structure written to the output file.
 type RefreshOutput struct {
 	GroupID      string                  `json:"groupId,omitempty"`
+	Groups       map[string]GroupMeta    `json:"groups,omitempty"` // by group ID; set in --group runs
 	Orgs         map[string]OrgMeta      `json:"orgs"`
 	Integrations map[string]string       `json:"integrations"`
 	Targets      []internal.ImportTarget `json:"targets"`
@@ -37,55 +44,158 @@ type refreshOrgResult struct {
 	err         error
 	orgID       string
 	orgLabel    string
+	groupID     string // the --group the org belongs to
+}
+
+// refreshOptions controls which projects refresh turns into import targets.
+type refreshOptions struct {
+	integrationType string   // only export targets for this integration type ("" = all)
+	includeCLI      bool     // convert CLI-monitored projects via their remote repo URL
+	gheHosts        []string // GitHub Enterprise hosts for CLI remote repo URLs
+	includeImages   bool     // export container registry projects as image-name targets
+	filters         []internal.ProjectFilter
+	query           internal.ProjectQuery // sent to the projects endpoint; see refreshQuery
+	where           *internal.Expr        // evaluated against each project and its import target
+	transform       targetTransform       // optional external hook run on each unique target
+}
+
+// refreshQuery narrows the filter query q to the origins refresh can export
+// with opts, so projects it would drop are not fetched at all. gitlab is kept
+// so skipped GitLab projects are still reported.
+func refreshQuery(q internal.ProjectQuery, opts refreshOptions) internal.ProjectQuery {
+	if opts.integrationType != "" {
+		q.Origins = internal.OriginsForIntegration(opts.integrationType)
+	} else {
+		q.Origins = append(internal.SCMOrigins(), "gitlab")
+		if opts.includeImages {
+			q.Origins = append(q.Origins, internal.ContainerOrigins()...)
+		}
+	}
+	if opts.includeCLI {
+		q.Origins = append(q.Origins, "cli")
+	}
+	return q
+}
+
+// targetCandidate is an import target together with the first project that produced it.
+type targetCandidate struct {
+	target  internal.ImportTarget
+	project internal.Project
+}
+
+// projectTarget converts a single project into an import target and the
+// integration key it belongs to. CLI projects are only converted when
+// opts.includeCLI is set and they carry a remote repo URL that matches one of
+// the org's SCM integrations; container projects only when opts.includeImages is set.
+func projectTarget(p internal.Project, integrations map[string]string, opts refreshOptions) (internal.Target, string, bool) {
+	branch := p.Branch
+	if branch == "" {
+		branch = p.TargetReference
+	}
+	if p.Origin == "cli" {
+		if !opts.includeCLI || p.RemoteRepoURL == "" {
+			return internal.Target{}, "", false
+		}
+		return internal.RemoteRepoToTarget(p.RemoteRepoURL, branch, integrations, opts.gheHosts)
+	}
+	if !internal.IsSCMOrigin(p.Origin) && !(opts.includeImages && internal.IsContainerOrigin(p.Origin)) {
+		return internal.Target{}, "", false
+	}
+	target, ok := internal.ProjectToTarget(p.Name, p.Origin, branch)
+	if !ok {
+		return internal.Target{}, "", false
+	}
+	return target, internal.OriginToIntegrationKey(p.Origin), true
 }
 
 // projectsToImportTargets converts Snyk projects to import targets for the given org,
-// applying SCM filtering, integration-type filter, and deduplication. Returns targets and gitlab skipped count.
-func projectsToImportTargets(org internal.Org, projects []internal.Project, integrations map[string]string, integrationType string) ([]internal.ImportTarget, int) {
+// applying project filters, SCM filtering, integration-type filter, and deduplication.
+// Returns targets and gitlab skipped count.
+func projectsToImportTargets(org internal.Org, projects []internal.Project, integrations map[string]string, opts refreshOptions) ([]internal.ImportTarget, int) {
+	cands, gitlabSkipped := projectsToCandidates(org, projects, integrations, opts)
 	var targets []internal.ImportTarget
-	seen := make(map[string]bool)
-	gitlabSkipped := 0
+	for _, c := range cands {
+		targets = append(targets, c.target)
+	}
+	return targets, gitlabSkipped
+}
+
+// projectsToCandidates does the work of projectsToImportTargets, keeping the
+// source project of each target so it can be passed to the transform hook.
+func projectsToCandidates(org internal.Org, projects []internal.Project, integrations map[string]string, opts refreshOptions) ([]targetCandidate, int) {
+	c := newTargetCollector(org, integrations, opts, true)
+	c.add(projects)
+	return c.cands, c.gitlabSkipped
+}
+
+// targetCollector converts projects to unique import targets incrementally,
+// one page at a time, so only the targets (not the projects) stay in memory.
+type targetCollector struct {
+	org           internal.Org
+	integrations  map[string]string
+	opts          refreshOptions
+	keepProjects  bool // keep each target's source project (for the transform hook)
+	seen          map[string]bool
+	cands         []targetCandidate
+	gitlabSkipped int
+}
+
+func newTargetCollector(org internal.Org, integrations map[string]string, opts refreshOptions, keepProjects bool) *targetCollector {
+	return &targetCollector{
+		org:          org,
+		integrations: integrations,
+		opts:         opts,
+		keepProjects: keepProjects,
+		seen:         make(map[string]bool),
+	}
+}
 
+// add converts a page of projects, skipping filtered, unsupported and duplicate ones.
+func (c *targetCollector) add(projects []internal.Project) {
+	opts := c.opts
 	for _, p := range projects {
+		if !internal.MatchAll(p, opts.filters) {
+			continue
+		}
 		if p.Origin == "gitlab" {
-			gitlabSkipped++
+			c.gitlabSkipped++
 			continue
 		}
-		if !internal.IsSCMOrigin(p.Origin) {
+		target, intKey, ok := projectTarget(p, c.integrations, opts)
+		if !ok {
 			continue
 		}
-		if integrationType != "" && p.Origin != integrationType && internal.OriginToIntegrationKey(p.Origin) != integrationType {
+		if opts.integrationType != "" && intKey != opts.integrationType && p.Origin != opts.integrationType {
 			continue
 		}
-		intKey := internal.OriginToIntegrationKey(p.Origin)
-		integrationID, ok := integrations[intKey]
+		integrationID, ok := c.integrations[intKey]
 		if !ok || integrationID == "" {
 			continue
 		}
-		branch := p.Branch
-		if branch == "" {
-			branch = p.TargetReference
+		it := internal.ImportTarget{
+			Target:        target,
+			OrgID:         c.org.ID,
+			IntegrationID: integrationID,
 		}
-		target, ok := internal.ProjectToTarget(p.Name, p.Origin, branch)
-		if !ok {
+		if opts.where != nil && !opts.where.Match(p, &it) {
 			continue
 		}
-		tid := internal.TargetID(org.ID, integrationID, target)
-		if seen[tid] {
+		tid := internal.TargetID(c.org.ID, integrationID, target)
+		if c.seen[tid] {
 			continue
 		}
-		seen[tid] = true
-		targets = append(targets, internal.ImportTarget{
-			Target:        target,
-			OrgID:         org.ID,
-			IntegrationID: integrationID,
-		})
+		c.seen[tid] = true
+		cand := targetCandidate{target: it}
+		if c.keepProjects {
+			cand.project = p
+		}
+		c.cands = append(c.cands, cand)
 	}
-	return targets, gitlabSkipped
 }
 
-// processOrgForRefresh fetches integrations and projects for one org and converts projects to import targets.
-func processOrgForRefresh(ctx context.Context, api SnykAPI, org internal.Org, integrationType string) refreshOrgResult {
+// processOrgForRefresh fetches integrations and then streams the org's
+// projects page by page, converting each page to import targets.
+func processOrgForRefresh(ctx context.Context, api SnykAPI, org internal.Org, opts refreshOptions) refreshOrgResult {
 	res := refreshOrgResult{
 		orgID:    org.ID,
 		orgLabel: orgLabel(org),
@@ -96,36 +206,39 @@ func processOrgForRefresh(ctx context.Context, api SnykAPI, org internal.Org, in
 		res.orgMeta[org.ID] = OrgMeta{Name: org.Name, Slug: org.Slug}
 	}
 
-	var integrations map[string]string
-	var projects []internal.Project
-	var intErr, projErr error
-	var innerWg sync.WaitGroup
-	innerWg.Add(2)
-	go func() {
-		defer innerWg.Done()
-		integrations, intErr = api.ListIntegrations(ctx, org.ID)
-	}()
-	go func() {
-		defer innerWg.Done()
-		projects, projErr = api.FetchProjects(ctx, org.ID)
-	}()
-	innerWg.Wait()
-	if intErr != nil {
-		res.err = fmt.Errorf("list integrations: %w", intErr)
-		return res
-	}
-	if projErr != nil {
-		res.err = fmt.Errorf("fetch projects: %w", projErr)
+	// Integrations are needed to convert projects, so they come first.
+	integrations, err := api.ListIntegrations(ctx, org.ID)
+	if err != nil {
+		res.err = fmt.Errorf("list integrations: %w", err)
 		return res
 	}
 	for intType, intID := range integrations {
 		res.intMeta[intID] = intType
 	}
-	if len(projects) == 0 {
+
+	collector := newTargetCollector(org, integrations, opts, opts.transform != nil)
+	err = api.StreamProjects(ctx, org.ID, opts.query, func(page []internal.Project) error {
+		collector.add(page)
+		return nil
+	})
+	if err != nil {
+		res.err = fmt.Errorf("fetch projects: %w", err)
 		return res
 	}
+	res.gitlabCount = collector.gitlabSkipped
 
-	res.targets, res.gitlabCount = projectsToImportTargets(org, projects, integrations, integrationType)
+	if opts.transform == nil {
+		for _, c := range collector.cands {
+			res.targets = append(res.targets, c.target)
+		}
+		return res
+	}
+	targets, err := applyTransform(ctx, opts.transform, org, integrations, collector.cands)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.targets = targets
 	return res
 }
 
@@ -134,16 +247,26 @@ func mergeRefreshResult(out *RefreshOutput, res refreshOrgResult) {
 	if res.err != nil {
 		return
 	}
+	logRefreshResult(res)
+	mergeRefreshMeta(out, res)
+	out.Targets = append(out.Targets, res.targets...)
+}
+
+// logRefreshResult logs the outcome of one successfully processed org.
+func logRefreshResult(res refreshOrgResult) {
 	if res.gitlabCount > 0 {
-		log.Printf("WARNING: Org %s: skipping %d GitLab project(s) -- Snyk API does not provide numeric GitLab project ID required for re-import",
-			res.orgLabel, res.gitlabCount)
+		slog.Warn("skipping GitLab projects: the Snyk API does not provide the numeric GitLab project ID required for re-import",
+			orgAttrs(res.orgID, res.orgLabel), "projects", res.gitlabCount)
 	}
 	if len(res.targets) > 0 {
-		log.Printf("Org %s: %d target(s)", res.orgLabel, len(res.targets))
+		slog.Info("org exported", orgAttrs(res.orgID, res.orgLabel), "targets", len(res.targets))
 	} else if res.gitlabCount == 0 {
-		log.Printf("Org %s: no SCM projects found", res.orgLabel)
+		slog.Info("no exportable projects found", orgAttrs(res.orgID, res.orgLabel))
 	}
-	out.Targets = append(out.Targets, res.targets...)
+}
+
+// mergeRefreshMeta merges an org's org and integration metadata into out.
+func mergeRefreshMeta(out *RefreshOutput, res refreshOrgResult) {
 	for k, v := range res.orgMeta {
 		out.Orgs[k] = v
 	}
@@ -152,73 +275,387 @@ func mergeRefreshResult(out *RefreshOutput, res refreshOrgResult) {
 	}
 }
 
-// writeRefreshOutput marshals out to JSON and writes it to safePath.
+// refreshWriter streams a RefreshOutput to disk. Targets are spilled to a
+// temporary file as each org completes; close assembles the final file once
+// the org and integration metadata is known and renames it into place. The
+// result is formatted like json.MarshalIndent(out, "", "  ").
+type refreshWriter struct {
+	path  string
+	spill *os.File
+	buf   *bufio.Writer
+	count int
+	meta  RefreshOutput // GroupID, Groups, Orgs and Integrations; Targets is unused
+}
+
+// newRefreshWriter starts streaming output to path, which must have been
+// produced by sanitizeOutputPath.
+func newRefreshWriter(path, groupID string) (*refreshWriter, error) {
+	spill, err := os.CreateTemp(filepath.Dir(path), ".export-targets-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	return &refreshWriter{
+		path:  path,
+		spill: spill,
+		buf:   bufio.NewWriter(spill),
+		meta: RefreshOutput{
+			GroupID:      groupID,
+			Orgs:         make(map[string]OrgMeta),
+			Integrations: make(map[string]string),
+		},
+	}, nil
+}
+
+// writeTargets appends targets to the output.
+func (w *refreshWriter) writeTargets(targets []internal.ImportTarget) error {
+	for _, t := range targets {
+		data, err := json.MarshalIndent(t, "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling JSON: %w", err)
+		}
+		if w.count > 0 {
+			w.buf.WriteString(",\n")
+		}
+		w.buf.WriteString("    ")
+		if _, err := w.buf.Write(data); err != nil {
+			return fmt.Errorf("writing temporary file: %w", err)
+		}
+		w.count++
+	}
+	return nil
+}
+
+// close writes the complete output file and removes the temporary file.
+func (w *refreshWriter) close() error {
+	defer w.abort()
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("writing temporary file: %w", err)
+	}
+	if _, err := w.spill.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("reading temporary file: %w", err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(w.path), ".export-targets-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	bw := bufio.NewWriter(out)
+	bw.WriteString("{\n")
+	if w.meta.GroupID != "" {
+		groupID, _ := json.Marshal(w.meta.GroupID)
+		fmt.Fprintf(bw, "  \"groupId\": %s,\n", groupID)
+	}
+	if len(w.meta.Groups) > 0 {
+		groups, err := json.MarshalIndent(w.meta.Groups, "  ", "  ")
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("marshaling JSON: %w", err)
+		}
+		fmt.Fprintf(bw, "  \"groups\": %s,\n", groups)
+	}
+	orgs, err := json.MarshalIndent(w.meta.Orgs, "  ", "  ")
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	integrations, err := json.MarshalIndent(w.meta.Integrations, "  ", "  ")
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	fmt.Fprintf(bw, "  \"orgs\": %s,\n  \"integrations\": %s,\n", orgs, integrations)
+	if w.count == 0 {
+		bw.WriteString("  \"targets\": []\n}")
+	} else {
+		bw.WriteString("  \"targets\": [\n")
+		if _, err := io.Copy(bw, w.spill); err != nil {
+			out.Close()
+			return fmt.Errorf("copying targets: %w", err)
+		}
+		bw.WriteString("\n  ]\n}")
+	}
+	if err := bw.Flush(); err != nil {
+		out.Close()
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.Rename(out.Name(), w.path); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// abort discards the temporary file without writing the output.
+func (w *refreshWriter) abort() {
+	w.spill.Close()
+	os.Remove(w.spill.Name())
+}
+
+// writeRefreshOutput writes out as JSON to safePath.
 // safePath must have been produced by sanitizeOutputPath to avoid path traversal.
 // Returns the sanitized path on success so the caller can print it.
 func writeRefreshOutput(out RefreshOutput, safePath string) (string, error) {
-	jsonData, err := json.MarshalIndent(out, "", "  ")
+	w, err := newRefreshWriter(safePath, out.GroupID)
 	if err != nil {
-		return "", fmt.Errorf("marshaling JSON: %w", err)
+		return "", err
 	}
-	if err := os.WriteFile(safePath, jsonData, 0600); err != nil {
-		return "", fmt.Errorf("writing output file: %w", err)
+	w.meta.Groups, w.meta.Orgs, w.meta.Integrations = out.Groups, out.Orgs, out.Integrations
+	if err := w.writeTargets(out.Targets); err != nil {
+		w.abort()
+		return "", err
+	}
+	if err := w.close(); err != nil {
+		return "", err
 	}
 	return safePath, nil
 }
 
 // runRefresh implements the refresh subcommand (default behavior).
-func runRefresh(args []string) {
+func runRefresh(args []string) int {
 	fs := flag.NewFlagSet("refresh", flag.ExitOnError)
 	showVersion := fs.Bool("version", false, "Print version information and exit")
 	groupID := fs.String("groupId", "", "Snyk group ID (all orgs in this group will be scanned)")
 	orgID := fs.String("orgId", "", "Single Snyk org ID to scan (alternative to --groupId)")
+	var groupValues stringList
+	fs.Var(&groupValues, "group", "Snyk group to scan, as <groupId>[,api=<url>][,tokenEnv=<VAR>][,tokenFile=<path>][,name=<label>]; repeat to scan several groups or regions (alternative to --groupId)")
+	orgQuery := addOrgFilterFlags(fs, groupID)
+	shardOf := addShardFlag(fs)
 	integrationType := fs.String("integrationType", "", "Filter to a specific integration type (e.g. github-cloud-app)")
+	includeCLI := fs.Bool("includeCLI", false, "Also export CLI-monitored projects whose remote repo URL matches an SCM integration in the org")
+	gheHosts := fs.String("gheHost", "", "GitHub Enterprise hosts, comma-separated, whose CLI project remote URLs --includeCLI maps to the org's github-enterprise integration")
+	includeImages := fs.Bool("includeContainerImages", false, "Also export container registry projects (docker-hub, ecr, acr, gcr, artifactory-cr, harbor-cr, quay-cr) as image targets")
 	concurrency := fs.Int("concurrency", 5, "Number of orgs to process in parallel")
-	output := fs.String("output", "export-targets.json", "Output file path")
+	output := fs.String("output", "export-targets.json", "Output file path; with --group, "+groupPlaceholder+" in the path writes one file per group")
+	filterFlags := addProjectFilterFlags(fs)
+	clientOpts := addClientFlags(fs)
+	logOpts := addLogFlags(fs)
+	progressOpts := addProgressFlags(fs)
+	telemetryOpts := addTelemetryFlags(fs)
+	summaryOpts := addSummaryFlags(fs)
+	configOpts := addConfigFlags(fs)
+	transformHook := fs.String("transformHook", "", "Executable that receives each candidate target as JSON on stdin and replies accept, reject or a modified target")
+	transformHookTimeout := fs.Duration("transformHookTimeout", 30*time.Second, "Maximum run time of one transform hook invocation")
 	if err := fs.Parse(args); err != nil {
-		os.Exit(1)
+		return exitFatal
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if err := configOpts.apply(fs, "refresh"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
 	}
+	closeLog, err := logOpts.setup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer closeLog()
+	sum := summaryOpts.begin("refresh")
+	sum.GroupID = *groupID
+	sum.Refresh = &refreshSummary{}
 
 	if *showVersion {
 		printVersion()
-		os.Exit(0)
+		return exitOK
 	}
 
-	if err := validateGroupOrOrg(*groupID, *orgID); err != nil {
+	groups, err := parseGroupSpecs(groupValues)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return sum.fail(err)
+	}
+	if err := validateGroups(groups, orgQuery(), *orgID); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		fs.Usage()
-		os.Exit(1)
+		return sum.fail(err)
+	}
+	sh, err := shardOf()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return sum.fail(err)
+	}
+	sum.Shard = sh.String()
+	perGroup := strings.Contains(*output, groupPlaceholder)
+	switch {
+	case perGroup && len(groups) == 0:
+		err = fmt.Errorf("%s in --output requires --group", groupPlaceholder)
+	case len(groups) > 1 && *clientOpts.record != "":
+		// Each group has its own client, and their recordings would collide.
+		err = fmt.Errorf("--record supports a single group")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return sum.fail(err)
+	}
+	for _, g := range groups {
+		sum.Groups = append(sum.Groups, g.id)
 	}
 
-	token, err := internal.GetSnykToken()
+	filters, err := filterFlags.build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fs.Usage()
+		return sum.fail(err)
+	}
+	where, err := filterFlags.whereExpr()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return sum.fail(err)
+	}
+
+	opts := refreshOptions{
+		integrationType: *integrationType,
+		includeCLI:      *includeCLI,
+		gheHosts:        splitList(*gheHosts),
+		includeImages:   *includeImages,
+		filters:         filters,
+		where:           where,
+	}
+	opts.query = refreshQuery(filterFlags.query(), opts)
+	if *transformHook != "" {
+		opts.transform, err = newExecTransform(*transformHook, *transformHookTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return sum.fail(err)
+		}
 	}
 
+	// Without --group the run is a single scan with the global settings.
+	specs := groups
+	if len(specs) == 0 {
+		specs = []groupSpec{{id: *groupID}}
+	}
+	// groupErr names the group of a failure when there is more than one.
+	groupErr := func(g groupSpec, err error) error {
+		if len(groups) > 1 {
+			return fmt.Errorf("group %s: %w", g.label(), err)
+		}
+		return err
+	}
 	ctx := context.Background()
-	api := newSnykAPI(internal.NewHTTPClient(), token)
+	scans := make([]*groupScan, len(specs))
+	clients := make([]*internal.Client, len(specs))
+	for i, g := range specs {
+		client, err := clientOpts.forGroup(g).newClient()
+		if err != nil {
+			err = groupErr(g, err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return sum.fail(err)
+		}
+		scans[i] = &groupScan{spec: g, client: client, api: newSnykAPI(client)}
+		clients[i] = client
+	}
+	ctx, tel := telemetryOpts.start(ctx, "refresh", clients[0])
+	for _, client := range clients[1:] {
+		tel.instrument(client)
+	}
 
-	orgs, err := resolveOrgs(ctx, api, *groupID, *orgID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error fetching orgs: %v\n", err)
-		os.Exit(1)
+	totalOrgs := 0
+	for _, s := range scans {
+		q := orgQuery()
+		q.GroupID = s.spec.id
+		s.orgs, err = resolveOrgs(ctx, s.api, q, *orgID)
+		if err != nil {
+			err = groupErr(s.spec, err)
+			fmt.Fprintf(os.Stderr, "Error fetching orgs: %v\n", err)
+			return tel.fail(sum, err)
+		}
+		if sh.count > 1 {
+			all := len(s.orgs)
+			s.orgs = sh.filter(s.orgs)
+			slog.Info("shard selected", "shard", sh.String(), "orgs", len(s.orgs), "of", all)
+		}
+		totalOrgs += len(s.orgs)
+	}
+
+	// Targets are streamed to disk as each org completes rather than held
+	// until the end: to one file, or with {group} to one file per group.
+	writers := make(map[string]*refreshWriter) // by group ID; "" for the combined output
+	var writerKeys []string
+	writerKey := func(groupID string) string {
+		if perGroup {
+			return groupID
+		}
+		return ""
+	}
+	abortWriters := func() {
+		for _, w := range writers {
+			w.abort()
+		}
+	}
+	for _, s := range scans {
+		key := writerKey(s.spec.id)
+		w := writers[key]
+		if w == nil {
+			path := *output
+			if perGroup {
+				path = groupOutputPath(path, s.spec)
+			}
+			safePath, err := sanitizeOutputPath(path)
+			for _, other := range writers {
+				if err == nil && other.path == safePath {
+					err = fmt.Errorf("groups %s and %s write the same output %s; give them distinct names", other.meta.GroupID, s.spec.id, safePath)
+				}
+			}
+			if err == nil {
+				outGroupID := s.spec.id
+				if !perGroup && len(scans) > 1 {
+					outGroupID = ""
+				}
+				w, err = newRefreshWriter(safePath, outGroupID)
+			}
+			if err != nil {
+				abortWriters()
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return tel.fail(sum, err)
+			}
+			writers[key] = w
+			writerKeys = append(writerKeys, key)
+		}
+		if len(groups) > 0 {
+			if w.meta.Groups == nil {
+				w.meta.Groups = make(map[string]GroupMeta)
+			}
+			w.meta.Groups[s.spec.id] = groupMeta(s.spec, s.client.BaseURL)
+		}
 	}
 
-	log.Printf("Processing %d organization(s) with concurrency %d...", len(orgs), *concurrency)
+	slog.Info("processing orgs", "orgs", totalOrgs, "groups", len(scans), "concurrency", *concurrency)
+	sum.Orgs.Total = totalOrgs
+	prog, err := progressOpts.start(totalOrgs, clients...)
+	if err != nil {
+		abortWriters()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return tel.fail(sum, err)
+	}
+	defer prog.stop()
 
-	results := make(chan refreshOrgResult, len(orgs))
+	results := make(chan refreshOrgResult, totalOrgs)
 	sem := make(chan struct{}, *concurrency)
 	var wg sync.WaitGroup
 
-	for _, org := range orgs {
-		wg.Add(1)
-		go func(o internal.Org) {
-			defer wg.Done()
-			sem <- struct{}{}        // acquire
-			defer func() { <-sem }() // release
-			results <- processOrgForRefresh(ctx, api, o, *integrationType)
-		}(org)
+	for _, s := range scans {
+		api := prog.wrap(s.api)
+		for _, org := range s.orgs {
+			wg.Add(1)
+			go func(groupID string, o internal.Org) {
+				defer wg.Done()
+				sem <- struct{}{}        // acquire
+				defer func() { <-sem }() // release
+				prog.orgStarted(o.ID)
+				orgCtx, endOrg := tel.startOrg(ctx, o)
+				res := processOrgForRefresh(orgCtx, api, o, opts)
+				res.groupID = groupID
+				endOrg(res.err)
+				prog.orgFinished(o.ID, res.err)
+				results <- res
+			}(s.spec.id, org)
+		}
 	}
 
 	go func() {
@@ -226,47 +663,95 @@ func runRefresh(args []string) {
 		close(results)
 	}()
 
-	out := RefreshOutput{
-		Orgs:         make(map[string]OrgMeta),
-		Integrations: make(map[string]string),
-	}
-	if *groupID != "" {
-		out.GroupID = *groupID
-	}
-
-	failedOrgs := 0
+	failures := orgFailures{}
 	processedOrgs := 0
 
 	for res := range results {
 		if res.err != nil {
-			failedOrgs++
-			log.Printf("WARNING: Failed to process org %s: %v", res.orgLabel, res.err)
+			failures.add(res.orgLabel, res.err)
+			sum.orgFailed(res.orgID, res.orgLabel, res.err)
+			slog.Warn("failed to process org", orgAttrs(res.orgID, res.orgLabel), "error_class", internal.ClassifyError(res.err), "error", res.err)
 			continue
 		}
 		processedOrgs++
-		mergeRefreshResult(&out, res)
+		sum.Refresh.GitLabProjectsSkipped += res.gitlabCount
+		logRefreshResult(res)
+		w := writers[writerKey(res.groupID)]
+		mergeRefreshMeta(&w.meta, res)
+		if len(groups) > 0 {
+			m := w.meta.Orgs[res.orgID]
+			m.GroupID = res.groupID
+			w.meta.Orgs[res.orgID] = m
+		}
+		if err := w.writeTargets(res.targets); err != nil {
+			abortWriters()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return tel.fail(sum, err)
+		}
 	}
 
-	if len(out.Targets) == 0 {
-		log.Println("No targets found to refresh.")
+	prog.stop()
+	totalTargets := 0
+	for _, w := range writers {
+		totalTargets += w.count
 	}
-
-	safePath, err := sanitizeOutputPath(*output)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if totalTargets == 0 {
+		slog.Info("no targets found to refresh")
 	}
-	sanitizedOutput, err := writeRefreshOutput(out, safePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	for i, key := range writerKeys {
+		if err := writers[key].close(); err != nil {
+			for _, rest := range writerKeys[i+1:] {
+				writers[rest].abort()
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return tel.fail(sum, err)
+		}
 	}
+	for _, s := range scans {
+		if len(scans) > 1 {
+			slog.Info("rate limiter", "group_id", s.spec.id, "state", s.client.Limiter.State())
+		} else {
+			slog.Info("rate limiter", "state", s.client.Limiter.State())
+		}
+	}
+	tel.add(metricTargets, totalTargets)
+	sum.Orgs.Processed = processedOrgs
+	tel.finish(sum.orgsError())
 
-	fmt.Printf("\nTotal: %d target(s) across %d org(s)", len(out.Targets), processedOrgs)
-	if failedOrgs > 0 {
-		fmt.Printf(" (%d org(s) failed)", failedOrgs)
+	fmt.Printf("\nTotal: %d target(s) across %d org(s)", totalTargets, processedOrgs)
+	if len(scans) > 1 {
+		fmt.Printf(" in %d group(s)", len(scans))
+	}
+	if n := failures.count(); n > 0 {
+		fmt.Printf(" (%d org(s) failed)", n)
+	}
+	fmt.Println()
+	for _, key := range writerKeys {
+		fmt.Printf("Output written to: %s\n", writers[key].path)
+	}
+	if len(failures) > 0 {
+		fmt.Println("\nFailed orgs by error class:")
+		failures.print(os.Stdout)
 	}
-	fmt.Printf("\nOutput written to: %s\n", sanitizedOutput)
 	fmt.Println("\nTo import, run:")
-	fmt.Printf("  snyk-api-import import --file=%s\n", sanitizedOutput)
+	for _, key := range writerKeys {
+		w := writers[key]
+		env := ""
+		if apiURL, ok := importAPIURL(w.meta.Groups); ok {
+			env = "SNYK_API=" + apiURL + " "
+		} else if len(w.meta.Groups) > 0 {
+			fmt.Printf("  (the output spans several API URLs; snyk-api-import imports one region at a time, so use %s in --output)\n", groupPlaceholder)
+		}
+		fmt.Printf("  %ssnyk-api-import import --file=%s\n", env, w.path)
+	}
+
+	sum.Refresh.Targets = totalTargets
+	if perGroup {
+		for _, key := range writerKeys {
+			sum.Refresh.Outputs = append(sum.Refresh.Outputs, writers[key].path)
+		}
+	} else {
+		sum.Refresh.Output = writers[""].path
+	}
+	return sum.finish(totalTargets == 0)
 }
@@ -0,0 +1,73 @@
+// shard.go splits the org list of refresh and dedup across parallel jobs
+// (--shard=i/n). The merge subcommand combines their outputs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// shard selects the orgs of one job out of count. index is 1-based; the
+// zero value selects every org.
+type shard struct {
+	index, count int
+}
+
+// addShardFlag registers --shard on fs. Call the returned function after
+// parsing to get the shard.
+func addShardFlag(fs *flag.FlagSet) func() (shard, error) {
+	v := fs.String("shard", "", "Only process the orgs of shard i out of n (e.g. 2/4), so n parallel jobs each handle a slice; combine their outputs with merge")
+	return func() (shard, error) { return parseShard(*v) }
+}
+
+// parseShard parses "i/n" with 1 <= i <= n; "" is no sharding.
+func parseShard(s string) (shard, error) {
+	if s == "" {
+		return shard{}, nil
+	}
+	i, n, ok := strings.Cut(s, "/")
+	index, err1 := strconv.Atoi(strings.TrimSpace(i))
+	count, err2 := strconv.Atoi(strings.TrimSpace(n))
+	if !ok || err1 != nil || err2 != nil || count < 1 || index < 1 || index > count {
+		return shard{}, fmt.Errorf("invalid --shard %q: expected i/n with 1 <= i <= n, e.g. 1/4", s)
+	}
+	return shard{index: index, count: count}, nil
+}
+
+func (s shard) String() string {
+	if s.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// includes reports whether orgID belongs to s. Orgs are assigned by a
+// stable hash of their ID, so every job computes the same partition
+// regardless of the order in which the API lists the orgs.
+func (s shard) includes(orgID string) bool {
+	if s.count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(orgID))
+	return int(h.Sum32()%uint32(s.count)) == s.index-1
+}
+
+// filter returns the orgs that belong to s.
+func (s shard) filter(orgs []internal.Org) []internal.Org {
+	if s.count <= 1 {
+		return orgs
+	}
+	var out []internal.Org
+	for _, o := range orgs {
+		if s.includes(o.ID) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
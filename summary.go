@@ -0,0 +1,176 @@
+// summary.go decides the exit code of refresh and dedup and writes the
+// optional machine-readable run summary (--summaryFile).
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0 // success; also a partial failure without --failOnPartial
+	exitFatal   = 1 // the run could not complete, or every org failed
+	exitPartial = 2 // some orgs or deletions failed (with --failOnPartial)
+	exitNoop    = 3 // completed without failures, but there was nothing to export or remove
+)
+
+// runStatus is the outcome of a run, as recorded in the summary.
+type runStatus string
+
+const (
+	statusSuccess runStatus = "success"
+	statusPartial runStatus = "partial"
+	statusNoop    runStatus = "noop"
+	statusFailed  runStatus = "failed"
+)
+
+// runSummary is the JSON document written to --summaryFile.
+type runSummary struct {
+	Command         string          `json:"command"`
+	Status          runStatus       `json:"status"`
+	ExitCode        int             `json:"exitCode"`
+	Error           string          `json:"error,omitempty"` // why a failed run stopped
+	StartedAt       time.Time       `json:"startedAt"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	GroupID         string          `json:"groupId,omitempty"`
+	Groups          []string        `json:"groups,omitempty"` // --group runs
+	Shard           string          `json:"shard,omitempty"`  // i/n with --shard
+	Orgs            orgSummary      `json:"orgs"`
+	Refresh         *refreshSummary `json:"refresh,omitempty"`
+	Dedup           *dedupSummary   `json:"dedup,omitempty"`
+
+	file          string
+	failOnPartial bool
+}
+
+// orgSummary counts the orgs of a run.
+type orgSummary struct {
+	Total     int                 `json:"total"`
+	Processed int                 `json:"processed"` // completed without error
+	Failed    int                 `json:"failed"`
+	Failures  []orgFailureSummary `json:"failures,omitempty"`
+}
+
+// orgFailureSummary is one failed org and why it failed.
+type orgFailureSummary struct {
+	OrgID string              `json:"orgId"`
+	Org   string              `json:"org,omitempty"`
+	Class internal.ErrorClass `json:"class"`
+	Error string              `json:"error"`
+}
+
+// refreshSummary holds the refresh-specific results.
+type refreshSummary struct {
+	Targets               int      `json:"targets"`
+	Output                string   `json:"output,omitempty"`
+	Outputs               []string `json:"outputs,omitempty"` // one per group with {group} in --output
+	GitLabProjectsSkipped int      `json:"gitlabProjectsSkipped,omitempty"`
+}
+
+// dedupSummary holds the dedup-specific results. In a dry run nothing is
+// deleted and the counts say what would be.
+type dedupSummary struct {
+	DryRun                bool `json:"dryRun"`
+	DuplicateProjects     int  `json:"duplicateProjects"`
+	ProjectsDeleted       int  `json:"projectsDeleted"`
+	ProjectDeleteFailures int  `json:"projectDeleteFailures"`
+	EmptyTargets          int  `json:"emptyTargets"`
+	TargetsDeleted        int  `json:"targetsDeleted"`
+	TargetDeleteFailures  int  `json:"targetDeleteFailures"`
+}
+
+// summaryFlags holds the raw values of the summary and exit code flags.
+type summaryFlags struct {
+	file          *string
+	failOnPartial *bool
+}
+
+// addSummaryFlags registers the summary and exit code flags on fs.
+func addSummaryFlags(fs *flag.FlagSet) *summaryFlags {
+	return &summaryFlags{
+		file:          fs.String("summaryFile", "", "Write a JSON summary of the run (status, orgs, failures, results, duration) to this file"),
+		failOnPartial: fs.Bool("failOnPartial", false, "Exit with code 2 when some orgs or deletions failed (default: 0)"),
+	}
+}
+
+// begin starts the summary of a run of command.
+func (f *summaryFlags) begin(command string) *runSummary {
+	return &runSummary{Command: command, StartedAt: time.Now(), file: *f.file, failOnPartial: *f.failOnPartial}
+}
+
+// orgFailed records a failed org.
+func (s *runSummary) orgFailed(orgID, label string, err error) {
+	s.Orgs.Failed++
+	s.Orgs.Failures = append(s.Orgs.Failures, orgFailureSummary{
+		OrgID: orgID,
+		Org:   label,
+		Class: internal.ClassifyError(err),
+		Error: err.Error(),
+	})
+}
+
+// fail ends a run that could not complete: it writes the summary with err
+// and returns exitFatal. The caller reports err to the user.
+func (s *runSummary) fail(err error) int {
+	s.Status, s.ExitCode, s.Error = statusFailed, exitFatal, err.Error()
+	s.write()
+	return exitFatal
+}
+
+// orgsError returns an error if every org of a completed run failed.
+func (s *runSummary) orgsError() error {
+	if s.Orgs.Failed > 0 && s.Orgs.Processed == 0 {
+		return errors.New("every org failed")
+	}
+	return nil
+}
+
+// finish ends a completed run, writes the summary and returns the exit
+// code. noop reports that there was nothing to export or remove.
+func (s *runSummary) finish(noop bool) int {
+	deleteFailures := 0
+	if s.Dedup != nil {
+		deleteFailures = s.Dedup.ProjectDeleteFailures + s.Dedup.TargetDeleteFailures
+	}
+	switch err := s.orgsError(); {
+	case err != nil:
+		s.Status, s.ExitCode, s.Error = statusFailed, exitFatal, err.Error()
+	case s.Orgs.Failed > 0 || deleteFailures > 0:
+		s.Status, s.ExitCode = statusPartial, exitOK
+		if s.failOnPartial {
+			s.ExitCode = exitPartial
+		}
+	case noop:
+		s.Status, s.ExitCode = statusNoop, exitNoop
+	default:
+		s.Status, s.ExitCode = statusSuccess, exitOK
+	}
+	if err := s.write(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	return s.ExitCode
+}
+
+// write saves the summary to the --summaryFile, if set.
+func (s *runSummary) write() error {
+	if s.file == "" {
+		return nil
+	}
+	s.DurationSeconds = time.Since(s.StartedAt).Seconds()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding summary: %w", err)
+	}
+	if err := os.WriteFile(s.file, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// telemetry.go exports run metrics (Prometheus textfile or Pushgateway) and
+// OTLP trace spans for scheduled runs. Everything is off unless a flag asks
+// for it.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/snyk-playground/snyk-target-export/internal"
+)
+
+// Names of the run metrics recorded by the subcommands.
+const (
+	metricOrgs              = "snyk_target_export_orgs_processed_total"
+	metricTargets           = "snyk_target_export_targets_exported_total"
+	metricDuplicates        = "snyk_target_export_duplicate_projects_total"
+	metricDuplicatesDeleted = "snyk_target_export_duplicate_projects_deleted_total"
+	metricEmptyTargets      = "snyk_target_export_empty_targets_total"
+	metricRunDuration       = "snyk_target_export_run_duration_seconds"
+	metricLastRunTimestamp  = "snyk_target_export_last_run_timestamp_seconds"
+)
+
+const (
+	telemetryJob           = "snyk_target_export" // Pushgateway job name
+	telemetryService       = "snyk-target-export" // OTLP service.name
+	telemetryExportTimeout = 10 * time.Second
+)
+
+// telemetryFlags holds the raw values of the metrics and tracing flags.
+type telemetryFlags struct {
+	metricsFile  *string
+	pushURL      *string
+	otlpEndpoint *string
+}
+
+// addTelemetryFlags registers the metrics and tracing flags on fs.
+func addTelemetryFlags(fs *flag.FlagSet) *telemetryFlags {
+	return &telemetryFlags{
+		metricsFile:  fs.String("metricsFile", "", "Write Prometheus metrics to this file when the run ends (node_exporter textfile collector)"),
+		pushURL:      fs.String("metricsPushUrl", "", "Push Prometheus metrics to this Pushgateway URL when the run ends"),
+		otlpEndpoint: fs.String("otlpEndpoint", "", "Send trace spans for the run, each org and each API request to this OTLP/HTTP collector (e.g. http://localhost:4318)"),
+	}
+}
+
+// telemetry records the metrics and spans of one run. All methods are
+// no-ops for the parts that are disabled.
+type telemetry struct {
+	command string
+	flags   *telemetryFlags
+	start   time.Time
+	metrics *internal.Metrics // nil unless --metricsFile or --metricsPushUrl
+	tracer  *internal.Tracer  // nil unless --otlpEndpoint
+	run     *internal.Span
+}
+
+// start begins recording the run of command, instrumenting client's
+// requests. The returned context carries the run span.
+func (f *telemetryFlags) start(ctx context.Context, command string, client *internal.Client) (context.Context, *telemetry) {
+	t := &telemetry{command: command, flags: f, start: time.Now()}
+	if *f.metricsFile != "" || *f.pushURL != "" {
+		t.metrics = internal.NewMetrics()
+		t.metrics.Counter(metricOrgs, "Orgs processed, by result (ok or failed).")
+		t.metrics.Counter(metricTargets, "Import targets written by refresh.")
+		t.metrics.Counter(metricDuplicates, "Duplicate projects found by dedup.")
+		t.metrics.Counter(metricDuplicatesDeleted, "Duplicate projects deleted by dedup.")
+		t.metrics.Counter(metricEmptyTargets, "Empty duplicate targets found (and with --delete, removed) by dedup.")
+		t.metrics.Gauge(metricRunDuration, "Duration of the run.")
+		t.metrics.Gauge(metricLastRunTimestamp, "Unix time the run ended.")
+	}
+	if *f.otlpEndpoint != "" {
+		t.tracer = internal.NewTracer(telemetryService)
+		ctx, t.run = t.tracer.Start(ctx, command)
+	}
+	t.instrument(client)
+	return ctx, t
+}
+
+// instrument records the requests of client, for runs with more than one client.
+func (t *telemetry) instrument(client *internal.Client) {
+	if t.metrics == nil && t.tracer == nil {
+		return
+	}
+	addRequestObserver(client, func(ctx context.Context, info internal.RequestInfo) {
+		if t.metrics != nil {
+			t.metrics.ObserveRequest(info)
+		}
+		if t.tracer != nil {
+			t.tracer.RecordRequest(ctx, info)
+		}
+	})
+}
+
+// addRequestObserver adds fn to the functions called after each API request attempt.
+func addRequestObserver(client *internal.Client, fn func(context.Context, internal.RequestInfo)) {
+	prev := client.OnRequest
+	client.OnRequest = func(ctx context.Context, info internal.RequestInfo) {
+		if prev != nil {
+			prev(ctx, info)
+		}
+		fn(ctx, info)
+	}
+}
+
+// startOrg begins the span of one org. Call the returned function with the
+// org's outcome when it is done.
+func (t *telemetry) startOrg(ctx context.Context, org internal.Org) (context.Context, func(error)) {
+	var span *internal.Span
+	if t.tracer != nil {
+		ctx, span = t.tracer.Start(ctx, "org")
+		span.SetAttr("snyk.org_id", org.ID)
+		if org.Name != "" {
+			span.SetAttr("snyk.org_name", org.Name)
+		}
+	}
+	return ctx, func(err error) {
+		result := "ok"
+		if err != nil {
+			result = "failed"
+		}
+		t.add(metricOrgs, 1, "result", result)
+		if span != nil {
+			span.End(err)
+		}
+	}
+}
+
+// add adds n to a run counter.
+func (t *telemetry) add(name string, n int, labels ...string) {
+	if t.metrics != nil {
+		t.metrics.Add(name, float64(n), labels...)
+	}
+}
+
+// fail ends a run that failed with err after telemetry started: unlike
+// runSummary.fail on its own, it still finishes the run, so failed
+// scheduled runs report metrics and spans. It returns the exit code.
+func (t *telemetry) fail(sum *runSummary, err error) int {
+	t.finish(err)
+	return sum.fail(err)
+}
+
+// finish ends the run span and writes, pushes and exports what was
+// recorded. Failures are logged, not returned: telemetry never fails a run.
+func (t *telemetry) finish(err error) {
+	if t.run != nil {
+		t.run.End(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryExportTimeout)
+	defer cancel()
+	httpClient := &http.Client{Timeout: telemetryExportTimeout}
+	if t.metrics != nil {
+		t.metrics.Set(metricRunDuration, time.Since(t.start).Seconds())
+		t.metrics.Set(metricLastRunTimestamp, float64(time.Now().Unix()))
+		if *t.flags.metricsFile != "" {
+			if err := t.metrics.WriteFile(*t.flags.metricsFile); err != nil {
+				slog.Warn("writing metrics failed", "error", err)
+			}
+		}
+		if *t.flags.pushURL != "" {
+			if err := t.metrics.Push(ctx, httpClient, *t.flags.pushURL, telemetryJob, "command", t.command); err != nil {
+				slog.Warn("pushing metrics failed", "error", err)
+			}
+		}
+	}
+	if t.tracer != nil {
+		if err := t.tracer.Export(ctx, httpClient, *t.flags.otlpEndpoint); err != nil {
+			slog.Warn("exporting traces failed", "error", err)
+		}
+	}
+}